@@ -14,7 +14,6 @@ import (
 	cfg "github.com/arne314/inbox-collab/internal/config"
 	db "github.com/arne314/inbox-collab/internal/db"
 	model "github.com/arne314/inbox-collab/internal/db/generated"
-	modelcustom "github.com/arne314/inbox-collab/internal/db/sqlc"
 	"github.com/arne314/inbox-collab/internal/mail"
 	"github.com/arne314/inbox-collab/internal/matrix"
 )
@@ -24,6 +23,10 @@ var (
 	ThreadSortingStage      *PipelineStage
 	MatrixNotificationStage *PipelineStage
 	MatrixOverviewStages    map[string]*PipelineStage
+	ThreadSnoozeStage       *PipelineStage
+	OutboxStage             *PipelineStage
+	ThreadReminderStage     *PipelineStage
+	DigestStage             *PipelineStage
 	recreatedThreads        sync.Map
 )
 
@@ -40,6 +43,9 @@ type recreatedThreadHead struct {
 	roomId      string
 	threadId    string
 	intentional bool
+	split       bool
+	notifiedOld bool // split has been linked in the old thread
+	notifiedNew bool // split has been linked in the new thread
 }
 
 type FetcherStateStorageImpl struct {
@@ -80,6 +86,10 @@ func (ic *InboxCollab) Setup(
 	ic.setupThreadSortingStage()
 	ic.setupMatrixNotificationsStage()
 	ic.setupMatrixOverviewStage()
+	ic.setupThreadSnoozeStage()
+	ic.setupOutboxStage()
+	ic.setupThreadReminderStage()
+	ic.setupDigestStage()
 }
 
 func modelMailForDb(mail *mail.Mail) *model.Mail {
@@ -94,20 +104,36 @@ func modelMailForDb(mail *mail.Mail) *model.Mail {
 		NameFrom:         mail.NameFrom,
 		AddrFrom:         mail.AddrFrom,
 		AddrTo:           mail.AddrTo,
+		AddrCc:           mail.AddrCc,
+		AddrReplyTo:      mail.AddrReplyTo,
 		Body:             &mail.Text,
+		BodyHtml:         mail.Html,
+		HtmlOnly:         mail.HtmlOnly,
 	}
 }
 
+func modelAttachmentsForDb(mail *mail.Mail) []*model.Attachment {
+	attachments := make([]*model.Attachment, len(mail.Files))
+	for i, file := range mail.Files {
+		attachments[i] = &model.Attachment{
+			Filename: file.Name, ContentType: file.ContentType, Content: file.Content, Inline: file.Inline,
+		}
+	}
+	return attachments
+}
+
 func (ic *InboxCollab) storeMails(waitGroup *sync.WaitGroup) {
 	defer waitGroup.Done()
 	ctx := context.Background()
 	initial := true
 	for chunk := range ic.fetchedMails {
 		modelled := make([]*model.Mail, len(chunk))
+		attachments := make([][]*model.Attachment, len(chunk))
 		for i, mail := range chunk {
 			modelled[i] = modelMailForDb(mail)
+			attachments[i] = modelAttachmentsForDb(mail)
 		}
-		nFetched := ic.dbHandler.AddMails(ctx, modelled)
+		nFetched := ic.dbHandler.AddMails(ctx, modelled, attachments)
 		if nFetched > 0 || initial {
 			log.Infof("Added %v new messages to db", nFetched)
 			ThreadSortingStage.QueueWork()
@@ -143,6 +169,81 @@ func (ic *InboxCollab) ForceCloseThread(ctx context.Context, roomId string, thre
 	return ok
 }
 
+func (ic *InboxCollab) AssignThread(ctx context.Context, roomId string, threadId string, assignee string) bool {
+	ok := ic.dbHandler.UpdateThreadAssignee(ctx, roomId, threadId, assignee)
+	if ok {
+		ic.QueueMatrixOverviewUpdate([]string{roomId}, true)
+	}
+	return ok
+}
+
+func (ic *InboxCollab) UnassignThread(ctx context.Context, roomId string, threadId string) bool {
+	return ic.AssignThread(ctx, roomId, threadId, "")
+}
+
+func (ic *InboxCollab) TagThread(ctx context.Context, roomId string, threadId string, labels []string) bool {
+	thread := ic.dbHandler.GetThreadByMatrixId(ctx, threadId)
+	if thread == nil || !ic.dbHandler.AddThreadLabels(ctx, thread.ID, labels) {
+		return false
+	}
+	ic.QueueMatrixOverviewUpdate([]string{roomId}, true)
+	return true
+}
+
+func (ic *InboxCollab) UntagThread(ctx context.Context, roomId string, threadId string, labels []string) bool {
+	thread := ic.dbHandler.GetThreadByMatrixId(ctx, threadId)
+	if thread == nil || !ic.dbHandler.RemoveThreadLabels(ctx, thread.ID, labels) {
+		return false
+	}
+	ic.QueueMatrixOverviewUpdate([]string{roomId}, true)
+	return true
+}
+
+// whether the message is the head of a known thread in the given room
+func (ic *InboxCollab) IsThreadRoot(ctx context.Context, roomId string, messageId string) bool {
+	thread := ic.dbHandler.GetThreadByMatrixId(ctx, messageId)
+	return thread != nil && thread.MatrixRoomID.String == roomId
+}
+
+func (ic *InboxCollab) ThreadSeen(ctx context.Context, roomId string, eventId string, reader string, seen time.Time) {
+	thread := ic.dbHandler.GetThreadByMatrixEvent(ctx, roomId, eventId)
+	if thread == nil { // not part of a thread
+		return
+	}
+	if ic.dbHandler.UpdateThreadReader(ctx, thread.ID, reader, seen) {
+		log.Debugf("Thread %v has been seen by %v", thread.ID, reader)
+		ic.QueueMatrixOverviewUpdate([]string{roomId}, false)
+	}
+}
+
+func (ic *InboxCollab) GetThreadReaders(ctx context.Context, roomId string, threadId string) ([]*matrix.ThreadReader, error) {
+	thread := ic.dbHandler.GetThreadByMatrixId(ctx, threadId)
+	if thread == nil {
+		return nil, fmt.Errorf("this thread is unknown")
+	}
+	rows := ic.dbHandler.GetThreadReaders(ctx, thread.ID)
+	readers := make([]*matrix.ThreadReader, len(rows))
+	for i, row := range rows {
+		readers[i] = &matrix.ThreadReader{User: row.Reader, Seen: row.Seen.Time, SeenLatest: row.SeenLatest}
+	}
+	return readers, nil
+}
+
+// matrix ids of the posted mails of a thread
+func (ic *InboxCollab) GetThreadMailIds(ctx context.Context, roomId string, threadId string) []string {
+	thread := ic.dbHandler.GetThreadByMatrixId(ctx, threadId)
+	if thread == nil || thread.MatrixRoomID.String != roomId {
+		return nil
+	}
+	ids := []string{}
+	for _, mail := range ic.dbHandler.GetMailsByThread(ctx, thread.ID) {
+		if mail.MatrixID.Valid {
+			ids = append(ids, mail.MatrixID.String)
+		}
+	}
+	return ids
+}
+
 func (ic *InboxCollab) MoveThread(ctx context.Context, roomId string, threadId string, query string) bool {
 	var targetRoom string
 	query = strings.ToLower(query)
@@ -187,62 +288,117 @@ func (ic *InboxCollab) MoveThread(ctx context.Context, roomId string, threadId s
 	return true
 }
 
-func (ic *InboxCollab) ReplyToMailInThread(ctx context.Context, roomId string, originalMessageId string, replyToId string, text string, cite bool) error {
-	sender := ic.mailHandler.GetMailSender(ic.Config.Matrix.GetRoomSender(roomId))
-	if sender == nil {
-		return fmt.Errorf("no sender is configured for this room")
+func (ic *InboxCollab) AddNote(ctx context.Context, roomId string, threadId string, author string, text string) bool {
+	thread := ic.dbHandler.GetThreadByMatrixId(ctx, threadId)
+	if thread == nil || !ic.dbHandler.AddNote(ctx, thread.ID, author, text) {
+		return false
+	}
+	MatrixNotificationStage.QueueWork()
+	return true
+}
+
+func (ic *InboxCollab) MergeThread(ctx context.Context, roomId string, threadId string, otherThreadId string) bool {
+	if threadId == otherThreadId {
+		return false
 	}
-	if existing := ic.dbHandler.GetMailByMatrixId(ctx, originalMessageId); existing != nil {
-		return fmt.Errorf("your edit has been ignored as this reply had already been sent. Send a new message to add another reply")
+	thread := ic.dbHandler.GetThreadByMatrixId(ctx, threadId)
+	other := ic.dbHandler.GetThreadByMatrixId(ctx, otherThreadId)
+	if thread == nil || other == nil || !ic.dbHandler.MergeThreads(ctx, other.ID, thread.ID) {
+		return false
 	}
-	original := ic.dbHandler.GetMailByMatrixId(ctx, replyToId)
-	if original == nil {
-		return fmt.Errorf("this is not a valid mail to reply to. Choose one by directly replying to it on matrix")
+	otherRoomId := other.MatrixRoomID.String
+	if !ic.matrixHandler.NotifyMerge(otherRoomId, otherThreadId, roomId, threadId) {
+		log.Errorf("Failed to link merged thread %v to %v", otherThreadId, threadId)
 	}
+	MatrixNotificationStage.QueueWork() // post the merged mails into the remaining thread
+	ic.QueueMatrixOverviewUpdate([]string{roomId, otherRoomId}, true)
+	return true
+}
 
-	// send mail
-	ic.LockThreadSorting() // we are manually sorting this mail
-	defer ic.UnlockThreadSorting()
-	var cited string
-	if cite {
-		cited = *original.Body
+// check whether `mail` can be split off `thread`
+func checkSplit(thread *model.Thread, mail *model.Mail) error {
+	if thread == nil || !mail.Thread.Valid || thread.ID != mail.Thread.Int64 {
+		return fmt.Errorf("the mail does not belong to this thread")
 	}
-	newMail, message, raw, err := sender.SendReplyMail(
-		text, cited, original.Subject, original.Timestamp.Time, original.HeaderID, original.HeaderReferences,
-		original.NameFrom, original.AddrFrom,
-	)
-	if err != nil {
+	if thread.FirstMail.Int64 == mail.ID {
+		return fmt.Errorf("the first mail of a thread cannot be split off")
+	}
+	return nil
+}
+
+func (ic *InboxCollab) SplitThread(ctx context.Context, roomId string, threadId string, mailId string, includeLater bool) error {
+	mail := ic.dbHandler.GetMailByMatrixId(ctx, mailId)
+	if mail == nil {
+		return fmt.Errorf("this is not a valid mail to split off. Choose one by directly replying to it on matrix")
+	}
+	thread := ic.dbHandler.GetThreadByMatrixId(ctx, threadId)
+	if err := checkSplit(thread, mail); err != nil {
 		return err
 	}
 
-	// store mail in imap mailboxes
-	var errorMessage string
-	if !ic.mailHandler.StoreSentMail(sender.Name, newMail, raw) {
-		errorMessage += "Failed to store mail in mailbox. "
+	ic.LockThreadSorting() // prevent new mails from being sorted into the old thread meanwhile
+	newThreadId, ok := ic.dbHandler.SplitThread(ctx, thread.ID, mail.ID, includeLater, roomId)
+	ic.UnlockThreadSorting()
+	if !ok {
+		return fmt.Errorf("failed to split the thread")
 	}
+	recreatedThreads.Store(newThreadId, &recreatedThreadHead{ // to link both threads once created
+		roomId:   roomId,
+		threadId: threadId,
+		split:    true,
+	})
+	MatrixNotificationStage.QueueWork()
+	ic.QueueMatrixOverviewUpdate([]string{roomId}, true)
+	return nil
+}
 
-	// properly add mail to db
-	ic.dbHandler.AddMails(ctx, []*model.Mail{modelMailForDb(newMail)})
-	var newMailModel *model.Mail
-	if byId := ic.dbHandler.GetMailsByMessageIds(ctx, []string{newMail.MessageId}); len(byId) > 0 {
-		newMailModel = byId[0]
-		newMailModel.Messages = &modelcustom.ExtractedMessages{
-			Messages: []*modelcustom.Message{
-				{Author: newMailModel.NameFrom, Timestamp: &newMailModel.Timestamp.Time, Content: &message},
-			},
-		}
-		ic.dbHandler.UpdateExtractedMessages(ctx, newMailModel)
-		ic.dbHandler.AddMailToThread(ctx, newMailModel, original.Thread.Int64)
-		ic.dbHandler.UpdateMailMatrixId(ctx, newMailModel.ID, originalMessageId)
-	} else {
-		errorMessage += "Failed to store mail in database. "
+const maxSearchResults = 10
+
+// rooms whose threads may be searched from `roomId`: the room itself and the targets of its overview
+func (ic *InboxCollab) searchableRooms(roomId string) []string {
+	rooms := slices.Clone(ic.Config.Matrix.GetOverviewRoomTargets(roomId))
+	if slices.Contains(ic.Config.Matrix.AllTargetRooms(), roomId) && !slices.Contains(rooms, roomId) {
+		rooms = append(rooms, roomId)
 	}
+	return rooms
+}
 
-	ic.QueueMatrixOverviewUpdate([]string{roomId}, true)
-	if errorMessage != "" {
-		return fmt.Errorf("reply was sent successfully but there was an issue processing it afterwards: %s", errorMessage)
+// search threads visible from `roomId`
+func (ic *InboxCollab) SearchThreads(ctx context.Context, roomId string, query matrix.SearchQuery,
+) ([]*matrix.SearchResult, error) {
+	rooms := ic.searchableRooms(roomId)
+	if len(rooms) == 0 {
+		return nil, fmt.Errorf("search is only available in mail and overview rooms")
 	}
-	return nil
+	if query.Room != "" {
+		roomQuery := strings.ToLower(query.Room)
+		matching := []string{}
+		for _, r := range ic.dbHandler.GetRooms(ctx, rooms) {
+			if strings.Contains(strings.ToLower(r.Name.String), roomQuery) {
+				matching = append(matching, r.ID)
+			}
+		}
+		if len(matching) == 0 {
+			return nil, fmt.Errorf("there is no room matching '%s' visible from here", query.Room)
+		}
+		rooms = matching
+	}
+	threads := ic.dbHandler.SearchThreads(
+		ctx, query.Text, query.From, rooms, query.Before, query.After, maxSearchResults,
+	)
+	results := make([]*matrix.SearchResult, len(threads))
+	for i, thread := range threads {
+		results[i] = &matrix.SearchResult{
+			RoomId:    thread.MatrixRoomID.String,
+			ThreadId:  thread.MatrixID.String,
+			Author:    thread.NameFrom,
+			Subject:   thread.Subject,
+			Snippet:   thread.Snippet,
+			Timestamp: thread.Timestamp.Time,
+			Open:      thread.Enabled,
+		}
+	}
+	return results, nil
 }
 
 func (ic *InboxCollab) ResendThreadOverview(ctx context.Context, roomId string) bool {
@@ -252,7 +408,7 @@ func (ic *InboxCollab) ResendThreadOverview(ctx context.Context, roomId string)
 	}
 	room := ic.dbHandler.GetRoom(ctx, roomId)
 	if room != nil {
-		ok = ic.matrixHandler.RemoveThreadOverview(roomId, room.OverviewMessageID.String)
+		ok = ic.matrixHandler.RemoveThreadOverview(roomId, room.OverviewMessageIds)
 		if ok {
 			MatrixOverviewStages[roomId].QueueWorkBlocking()
 		}
@@ -264,7 +420,7 @@ func (ic *InboxCollab) ResendThreadOverviewAll(ctx context.Context) bool {
 	ok := true
 	roomIds := ic.Config.Matrix.AllOverviewRooms()
 	for _, room := range ic.dbHandler.GetRooms(ctx, roomIds) {
-		if !ic.matrixHandler.RemoveThreadOverview(room.ID, room.OverviewMessageID.String) {
+		if !ic.matrixHandler.RemoveThreadOverview(room.ID, room.OverviewMessageIds) {
 			ok = false
 		}
 	}
@@ -288,10 +444,14 @@ func (ic *InboxCollab) Run(waitGroup *sync.WaitGroup) {
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	go ic.storeMails(wg)
-	wg.Add(3)
+	wg.Add(7)
 	go MessageExtractionStage.Run(wg)
 	go ThreadSortingStage.Run(wg)
 	go MatrixNotificationStage.Run(wg)
+	go ThreadSnoozeStage.Run(wg)
+	go OutboxStage.Run(wg)
+	go ThreadReminderStage.Run(wg)
+	go DigestStage.Run(wg)
 	wg.Add(len(MatrixOverviewStages))
 	for _, stage := range MatrixOverviewStages {
 		go stage.Run(wg)
@@ -303,6 +463,10 @@ func (ic *InboxCollab) Stop() {
 	ThreadSortingStage.Stop()
 	MessageExtractionStage.ForceStop()
 	MatrixNotificationStage.ForceStop()
+	ThreadSnoozeStage.ForceStop()
+	OutboxStage.Stop() // don't interrupt sending
+	ThreadReminderStage.ForceStop()
+	DigestStage.ForceStop()
 	for _, stage := range MatrixOverviewStages {
 		stage.ForceStop()
 	}
@@ -0,0 +1,35 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	model "github.com/arne314/inbox-collab/internal/db/generated"
+)
+
+func Test_checkSplit(t *testing.T) {
+	thread := &model.Thread{ID: 1, FirstMail: pgtype.Int8{Int64: 10, Valid: true}}
+	inThread := func(mailId int64, threadId int64) *model.Mail {
+		return &model.Mail{ID: mailId, Thread: pgtype.Int8{Int64: threadId, Valid: threadId != 0}}
+	}
+	tests := []struct {
+		name    string
+		thread  *model.Thread
+		mail    *model.Mail
+		wantErr bool
+	}{
+		{"valid", thread, inThread(11, 1), false},
+		{"first_mail", thread, inThread(10, 1), true},
+		{"other_thread", thread, inThread(20, 2), true},
+		{"unsorted", thread, inThread(11, 0), true},
+		{"unknown_thread", nil, inThread(11, 1), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkSplit(tt.thread, tt.mail); (err != nil) != tt.wantErr {
+				t.Errorf("checkSplit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
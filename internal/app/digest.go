@@ -0,0 +1,99 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	model "github.com/arne314/inbox-collab/internal/db/generated"
+	"github.com/arne314/inbox-collab/internal/matrix"
+)
+
+// sort the threads into the configured sections; `threads` are expected to be ordered by their first mail
+func (ic *InboxCollab) buildDigest(threads []*model.GetDigestThreadsRow, since time.Time,
+	sectionNames []string, limit int,
+) []*matrix.DigestSection {
+	sections := make([]*matrix.DigestSection, len(sectionNames))
+	for i, name := range sectionNames {
+		section := &matrix.DigestSection{Name: name, Threads: []*matrix.DigestThread{}}
+		for _, thread := range threads {
+			var timestamp time.Time
+			switch name {
+			case "new":
+				if !thread.Created.Time.After(since) {
+					continue
+				}
+				timestamp = thread.FirstTimestamp.Time
+			case "closed":
+				if thread.Enabled || thread.SnoozedUntil.Valid { // snoozed threads will reopen
+					continue
+				}
+				timestamp = thread.Closed.Time
+			case "unanswered":
+				if !thread.Enabled || thread.Answered {
+					continue
+				}
+				timestamp = thread.LastTimestamp.Time
+			case "oldest":
+				if !thread.Enabled {
+					continue
+				}
+				timestamp = thread.FirstTimestamp.Time
+			}
+			section.Total++
+			if len(section.Threads) < limit {
+				section.Threads = append(section.Threads, &matrix.DigestThread{
+					RoomId: thread.MatrixRoomID.String, ThreadId: thread.MatrixID.String,
+					Author: thread.NameFrom, Subject: thread.Subject, Timestamp: timestamp,
+					NoteAuthor: thread.NoteAuthor, Note: thread.NoteBody,
+				})
+			}
+		}
+		sections[i] = section
+	}
+	return sections
+}
+
+func (ic *InboxCollab) setupDigestStage() {
+	setup := func(ctx context.Context) {
+		DigestStage.queuePeriodically(ctx, time.Minute)
+	}
+
+	work := func(ctx context.Context) bool {
+		if ic.Config.Matrix.VerifySession {
+			return true
+		}
+		zone, _ := time.LoadLocation(ic.Config.Matrix.Timezone) // timezone has already been validated
+		now := time.Now().In(zone)
+		for _, roomId := range ic.Config.Matrix.AllOverviewRooms() {
+			overview := ic.Config.Matrix.GetOverviewConfig(roomId)
+			if overview.DigestSchedule == nil {
+				continue
+			}
+			room := ic.dbHandler.GetRoom(ctx, roomId)
+			if room == nil {
+				return stageFailed(ctx, fmt.Sprintf("room %v not found", roomId))
+			}
+			if !room.DigestLast.Valid { // the first digest covers the time from now on
+				ic.dbHandler.UpdateRoomDigest(ctx, roomId, now)
+				continue
+			}
+			since := room.DigestLast.Time
+			if !since.Before(overview.DigestSchedule.Latest(now)) {
+				continue
+			}
+			targets := ic.Config.Matrix.GetOverviewRoomTargets(roomId)
+			threads := ic.dbHandler.GetDigestThreads(ctx, targets, overview.Tags, since)
+			sections := ic.buildDigest(threads, since, overview.DigestSections, overview.DigestLimit)
+			if !ic.matrixHandler.PostDigest(roomId, since, sections) {
+				return stageFailed(ctx, fmt.Sprintf("posting digest in %v failed", roomId))
+			}
+			log.Infof("Posted digest in overview room %v", roomId)
+			ic.dbHandler.UpdateRoomDigest(ctx, roomId, now)
+		}
+		return true
+	}
+	DigestStage = NewStage("Digest", setup, work, true)
+}
@@ -0,0 +1,79 @@
+package app
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	model "github.com/arne314/inbox-collab/internal/db/generated"
+)
+
+func TestBuildDigest(t *testing.T) {
+	since := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	at := func(hours int) pgtype.Timestamp {
+		return pgtype.Timestamp{Time: since.Add(time.Duration(hours) * time.Hour), Valid: true}
+	}
+	digestThread := func(subject string, enabled bool, answered bool, created int, closed int) *model.GetDigestThreadsRow {
+		thread := &model.GetDigestThreadsRow{
+			Subject: subject, Enabled: enabled, Answered: answered,
+			Created: at(created), FirstTimestamp: at(created), LastTimestamp: at(created + 1),
+		}
+		if !enabled {
+			thread.Closed = at(closed)
+		}
+		return thread
+	}
+	snoozed := digestThread("snoozed", false, false, -48, -24)
+	snoozed.SnoozedUntil = at(24)
+	noted := digestThread("old open", true, false, -72, 0)
+	noted.NoteAuthor, noted.NoteBody = "@alice:example.com", "Waiting for accounting"
+	threads := []*model.GetDigestThreadsRow{
+		noted,
+		digestThread("old answered", true, true, -48, 0),
+		digestThread("new open", true, false, 2, 0),
+		digestThread("new closed", false, true, 1, 3),
+		digestThread("old closed", false, false, -24, 2),
+		snoozed,
+	}
+
+	tests := []struct {
+		name          string
+		section       string
+		limit         int
+		want          []string
+		wantTotal     int
+		wantTimestamp pgtype.Timestamp // of the first thread
+		wantNote      string           // of the first thread
+	}{
+		{"new", "new", 10, []string{"new open", "new closed"}, 2, at(2), ""},
+		{"closed", "closed", 10, []string{"new closed", "old closed"}, 2, at(3), ""},
+		{"unanswered", "unanswered", 10, []string{"old open", "new open"}, 2, at(-71), "Waiting for accounting"},
+		{"oldest", "oldest", 10, []string{"old open", "old answered", "new open"}, 3, at(-72), "Waiting for accounting"},
+		{"limit", "oldest", 1, []string{"old open"}, 3, at(-72), "Waiting for accounting"},
+	}
+	ic := &InboxCollab{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sections := ic.buildDigest(threads, since, []string{tt.section}, tt.limit)
+			if len(sections) != 1 || sections[0].Name != tt.section {
+				t.Fatalf("buildDigest() = %v, want a single %v section", sections, tt.section)
+			}
+			section := sections[0]
+			got := make([]string, len(section.Threads))
+			for i, thread := range section.Threads {
+				got[i] = thread.Subject
+			}
+			if !slices.Equal(got, tt.want) || section.Total != tt.wantTotal {
+				t.Fatalf("buildDigest() = %v (total %v), want %v (total %v)", got, section.Total, tt.want, tt.wantTotal)
+			}
+			if first := section.Threads[0].Timestamp; !first.Equal(tt.wantTimestamp.Time) {
+				t.Errorf("buildDigest() first timestamp = %v, want %v", first, tt.wantTimestamp.Time)
+			}
+			if note := section.Threads[0].Note; note != tt.wantNote {
+				t.Errorf("buildDigest() first note = %q, want %q", note, tt.wantNote)
+			}
+		})
+	}
+}
@@ -2,11 +2,17 @@ package app
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+
+	model "github.com/arne314/inbox-collab/internal/db/generated"
+	inboxmail "github.com/arne314/inbox-collab/internal/mail"
 )
 
+const maxAttachmentUploadFailures = 3
+
 func (ic *InboxCollab) setupMatrixNotificationsStage() {
 	setup := func(ctx context.Context) {
 		ic.dbHandler.AddAllRooms(ctx)
@@ -50,14 +56,26 @@ func (ic *InboxCollab) setupMatrixNotificationsStage() {
 				thread.NameFrom, thread.Subject, thread.MatrixRoomID.String,
 			)
 			if !ok {
-				return false
+				return stageFailed(ctx, fmt.Sprintf("creating matrix thread for thread %v failed", thread.ID))
 			}
 			ic.dbHandler.UpdateThreadMatrixIds(ctx, thread.ID, roomId, messageId)
 			touchedRooms = append(touchedRooms, roomId)
 
 			if v, ok := recreatedThreads.Load(thread.ID); ok {
 				if head, ok := v.(*recreatedThreadHead); ok {
-					if ic.matrixHandler.NotifyRecreation(head.roomId, head.threadId, roomId, messageId, head.intentional) {
+					var notified bool
+					if head.split { // only retry the links that failed
+						if !head.notifiedOld {
+							head.notifiedOld = ic.matrixHandler.NotifySplitOff(head.roomId, head.threadId, roomId, messageId)
+						}
+						if !head.notifiedNew {
+							head.notifiedNew = ic.matrixHandler.NotifySplitFrom(roomId, messageId, head.roomId, head.threadId)
+						}
+						notified = head.notifiedOld && head.notifiedNew
+					} else {
+						notified = ic.matrixHandler.NotifyRecreation(head.roomId, head.threadId, roomId, messageId, head.intentional)
+					}
+					if notified {
 						recreatedThreads.Delete(thread.ID)
 					}
 				} else {
@@ -66,16 +84,36 @@ func (ic *InboxCollab) setupMatrixNotificationsStage() {
 			}
 		}
 
-		// add messages to threads
+		// add messages and notes to threads
 		mails := ic.dbHandler.GetMatrixReadyMails(ctx)
+		pendingNotes := make(map[int64][]*model.GetMatrixReadyNotesRow)
+		for _, note := range ic.dbHandler.GetMatrixReadyNotes(ctx) {
+			pendingNotes[note.Thread] = append(pendingNotes[note.Thread], note)
+		}
+		postNotes := func(thread int64, before time.Time) bool { // keep chronological order with mails
+			notes := pendingNotes[thread]
+			for len(notes) > 0 && (before.IsZero() || notes[0].Timestamp.Time.Before(before)) {
+				note := notes[0]
+				ok, matrixId := ic.matrixHandler.AddNote(
+					note.RootMatrixRoomID.String, note.RootMatrixID.String,
+					note.Author, note.Timestamp.Time, note.Body,
+				)
+				if !ok {
+					return stageFailed(ctx, fmt.Sprintf("posting note %v failed", note.ID))
+				}
+				ic.dbHandler.UpdateNoteMatrixId(ctx, note.ID, matrixId)
+				notes = notes[1:]
+			}
+			pendingNotes[thread] = notes
+			return true
+		}
 		targetThreadValid := make(map[int64]bool)
 		for _, m := range mails {
 			targetThreadValid[m.Thread.Int64] = false
 		}
 	findValid:
 		for t := range targetThreadValid {
-			history := ic.dbHandler.GetMailsByThread(ctx, t)
-			for _, m := range history {
+			for _, m := range ic.dbHandler.GetMailsByThread(ctx, t) {
 				if m.Messages == nil {
 					continue findValid
 				}
@@ -86,10 +124,23 @@ func (ic *InboxCollab) setupMatrixNotificationsStage() {
 			if !targetThreadValid[mail.Thread.Int64] {
 				continue
 			}
+			if !postNotes(mail.Thread.Int64, mail.Timestamp.Time) {
+				return false // failure already recorded
+			}
+			var bodyHtml string
+			if mail.HtmlOnly && !mail.Messages.Forwarded { // render html-only mails with formatting
+				content := *mail.Messages.Messages[0].Content
+				if html, ok := inboxmail.SanitizeHtmlMessage(mail.BodyHtml, content); ok {
+					bodyHtml = html
+				} else {
+					log.Debugf("Extracted message of mail %v can't be located in its html, posting it as text", mail.ID)
+				}
+			}
 			ok, redacted, matrixId := ic.matrixHandler.AddReply(
-				mail.RootMatrixRoomID.String, mail.RootMatrixID.String, mail.NameFrom, mail.AddrFrom,
+				mail.RootMatrixRoomID.String, mail.RootMatrixID.String, mail.NameFrom,
+				inboxmail.ReplyAddress(mail.AddrFrom, mail.AddrReplyTo),
 				mail.Subject, mail.Timestamp.Time, mail.Attachments,
-				*mail.Messages, mail.IsFirst,
+				*mail.Messages, bodyHtml, mail.IsFirst,
 			)
 			if redacted && ic.dbHandler.RemoveMatrixMessageIdsOfThread(ctx, mail.Thread.Int64) {
 				log.Infof("Thread head of mail %v has been redacted, queueing recreation...", mail.ID)
@@ -98,11 +149,45 @@ func (ic *InboxCollab) setupMatrixNotificationsStage() {
 				})
 			}
 			if !ok {
-				return false
+				return stageFailed(ctx, fmt.Sprintf("posting mail %v failed", mail.ID))
 			}
 			ic.dbHandler.UpdateMailMatrixId(ctx, mail.ID, matrixId)
 			touchedRooms = append(touchedRooms, mail.RootMatrixRoomID.String)
 		}
+		for thread := range pendingNotes {
+			if valid, pending := targetThreadValid[thread]; pending && !valid {
+				continue
+			}
+			if !postNotes(thread, time.Time{}) {
+				return false // failure already recorded
+			}
+		}
+
+		// upload attachments of posted mails; failed uploads are skipped to not block other notifications
+		for _, attachment := range ic.dbHandler.GetMatrixReadyAttachments(ctx, maxAttachmentUploadFailures) {
+			var ok bool
+			var matrixId string
+			if attachment.Content != nil {
+				ok, matrixId = ic.matrixHandler.AddAttachment(
+					attachment.RootMatrixRoomID.String, attachment.RootMatrixID.String,
+					attachment.MailMessageID.String, attachment.Filename, attachment.ContentType, attachment.Content,
+				)
+			} else { // already uploaded before its mail has been moved by merging or splitting threads
+				ok, matrixId = ic.matrixHandler.RepostAttachment(
+					attachment.RootMatrixRoomID.String, attachment.RootMatrixID.String,
+					attachment.MailMessageID.String, attachment.Filename, attachment.ContentType,
+					attachment.MatrixRoomID.String, attachment.MatrixID.String,
+				)
+			}
+			if !ok {
+				log.Warnf("Failed to upload attachment %v (%s) of mail %v", attachment.ID, attachment.Filename, attachment.Mail)
+				ic.dbHandler.AddAttachmentUploadFailure(ctx, attachment.ID)
+				continue
+			}
+			ic.dbHandler.UpdateAttachmentMatrixId(
+				ctx, attachment.ID, matrixId, attachment.MailMessageID.String, attachment.RootMatrixRoomID.String,
+			)
+		}
 		updateOverview := len(threads) > 0 || len(mails) > 0
 		if updateOverview {
 			ic.QueueMatrixOverviewUpdate(touchedRooms, false)
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"sync"
+
+	"github.com/arne314/inbox-collab/internal/matrix"
 )
 
 // touchedRooms: rooms that have been updated (overview rooms will be determined by this function)
@@ -39,16 +41,30 @@ func (ic *InboxCollab) setupMatrixOverviewStage() {
 			if ic.Config.Matrix.VerifySession {
 				return true
 			}
-			messageId, authors, subjects, rooms, threadMsgs := ic.dbHandler.GetOverviewThreads(
-				ctx, roomId,
-			)
-			ok, messageId := ic.matrixHandler.UpdateThreadOverview(
-				roomId, messageId, authors, subjects, rooms, threadMsgs,
-			)
-			if ok {
-				ic.dbHandler.OverviewMessageUpdated(ctx, roomId, messageId)
-			} else {
-				return false
+			messageIds, threads := ic.dbHandler.GetOverviewThreads(ctx, roomId)
+			entries := make([]*matrix.OverviewEntry, len(threads))
+			for i, thread := range threads {
+				entries[i] = &matrix.OverviewEntry{
+					RoomId:         thread.MatrixRoomID.String,
+					RoomName:       thread.RoomName,
+					ThreadId:       thread.MessageID.String,
+					Author:         thread.NameFrom,
+					Subject:        thread.Subject,
+					LastAuthor:     thread.LastNameFrom,
+					FirstTimestamp: thread.FirstTimestamp.Time,
+					LastTimestamp:  thread.LastTimestamp.Time,
+					MailCount:      int(thread.MailCount),
+					Assignee:       thread.Assignee.String,
+					Labels:         thread.Labels,
+					Readers:        thread.Readers,
+					Answered:       thread.Answered,
+					Overdue:        thread.RemindedMail.Valid && thread.RemindedMail == thread.LastMail,
+				}
+			}
+			ok, messageIds := ic.matrixHandler.UpdateThreadOverview(roomId, messageIds, entries)
+			ic.dbHandler.OverviewMessageUpdated(ctx, roomId, messageIds) // also keep track of partial updates
+			if !ok {
+				return stageFailed(ctx, "updating overview messages failed")
 			}
 			return true
 		}
@@ -0,0 +1,153 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	log "github.com/sirupsen/logrus"
+
+	model "github.com/arne314/inbox-collab/internal/db/generated"
+	"github.com/arne314/inbox-collab/internal/matrix"
+)
+
+const countdownInterval = 10 * time.Second
+
+var (
+	sendingReplies  sync.Map // commands whose reply is being sent right now
+	replyCountdowns sync.Map // commands with a running countdown
+)
+
+// schedule the reply for `sendAt`; replies needing approval are drafted right away and scheduled once approved
+func (ic *InboxCollab) ScheduleReply(ctx context.Context, roomId string, threadId string, originalMessageId string,
+	replyToId string, author string, text string, cite bool, replyAll bool, files []string, sendAt time.Time,
+) (awaitingApproval bool, err error) {
+	if _, sending := sendingReplies.Load(originalMessageId); sending {
+		return false, fmt.Errorf("your edit has been ignored as this mail is being sent right now")
+	}
+	if _, _, err := ic.prepareOutgoingMail(ctx, roomId, threadId, originalMessageId, replyToId, files); err != nil {
+		return false, err
+	}
+	if ic.Config.Matrix.RequiresApproval(roomId) {
+		ic.dbHandler.DeleteOutboxMailByCommand(ctx, roomId, originalMessageId) // edits have to be approved again
+		return true, ic.draftReply(ctx, &model.Draft{
+			CommandID: originalMessageId, RoomID: roomId, ThreadID: threadId, ReplyToID: replyToId,
+			Author: author, Body: text, Cite: cite, ReplyAll: replyAll, Files: files,
+			SendAt: pgtype.Timestamp{Time: sendAt, Valid: true},
+		})
+	}
+	ok := ic.dbHandler.UpsertOutboxMail(ctx, &model.Outbox{
+		CommandID: originalMessageId, RoomID: roomId, ThreadID: threadId, ReplyToID: replyToId,
+		Author: author, Body: text, Cite: cite, ReplyAll: replyAll, Files: files,
+		SendAt: pgtype.Timestamp{Time: sendAt, Valid: true},
+	})
+	if !ok {
+		return false, fmt.Errorf("failed to store the scheduled reply")
+	}
+	log.Infof("Scheduled reply of command %v for %v", originalMessageId, sendAt)
+	return false, nil
+}
+
+// store the reply to be sent once the grace period is over; edits reset the grace period
+func (ic *InboxCollab) delayReply(ctx context.Context, delayed *model.Outbox) error {
+	if !ic.dbHandler.UpsertOutboxMail(ctx, delayed) {
+		return fmt.Errorf("failed to store the reply")
+	}
+	log.Infof("Delayed reply of command %v until %v", delayed.CommandID, delayed.SendAt.Time)
+	if _, running := replyCountdowns.LoadOrStore(delayed.CommandID, true); !running {
+		go ic.runReplyCountdown(ctx, delayed.RoomID, delayed.ThreadID, delayed.CommandID)
+	}
+	return nil
+}
+
+// keep a countdown message up to date and trigger sending when the delayed reply is due
+func (ic *InboxCollab) runReplyCountdown(ctx context.Context, roomId string, threadId string, commandId string) {
+	defer replyCountdowns.Delete(commandId)
+	var countdownId string
+	for {
+		delayed := ic.dbHandler.GetOutboxMailByCommand(ctx, roomId, commandId)
+		if delayed == nil { // sent or cancelled
+			break
+		}
+		wait := time.Until(delayed.SendAt.Time)
+		if wait <= 0 {
+			OutboxStage.QueueWork()
+			wait = time.Second
+		} else if ok, messageId := ic.matrixHandler.PostSendCountdown(roomId, threadId, countdownId, wait); ok {
+			countdownId = messageId
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(min(wait, countdownInterval)):
+		}
+	}
+	if countdownId != "" {
+		ic.matrixHandler.RemoveMessage(roomId, countdownId)
+	}
+}
+
+// cancel the scheduled reply of a command by its author or a member allowed to send mails;
+// reactions can't be set on redacted commands
+func (ic *InboxCollab) CancelScheduledReply(ctx context.Context, roomId string, commandId string,
+	canceller string, mayCancelOthers func() bool, redacted bool,
+) {
+	pending := ic.dbHandler.GetOutboxMailByCommand(ctx, roomId, commandId)
+	if pending == nil { // most reactions and redactions don't concern scheduled replies
+		return
+	}
+	if pending.Author != canceller && !mayCancelOthers() {
+		log.Warnf("Ignoring cancellation of scheduled reply %v by %v who isn't allowed to send mails", pending.ID, canceller)
+		return
+	}
+	scheduled := ic.dbHandler.DeleteOutboxMailByCommand(ctx, roomId, commandId)
+	if scheduled == nil { // sent in the meantime
+		return
+	}
+	log.Infof("Scheduled reply %v has been cancelled by %v", scheduled.ID, canceller)
+	if !redacted {
+		ic.matrixHandler.SetCommandState(roomId, commandId, matrix.Error)
+	}
+	ic.matrixHandler.NotifyScheduledReplyCancelled(roomId, scheduled.ThreadID, canceller)
+}
+
+func (ic *InboxCollab) setupOutboxStage() {
+	setup := func(ctx context.Context) {
+		OutboxStage.queuePeriodically(ctx, time.Minute)
+	}
+
+	work := func(ctx context.Context) bool {
+		if ic.Config.Matrix.VerifySession {
+			return true
+		}
+		for _, scheduled := range ic.dbHandler.GetDueOutboxMails(ctx) {
+			sendingReplies.Store(scheduled.CommandID, true)        // reject edits from now on
+			if !ic.dbHandler.DeleteOutboxMail(ctx, scheduled.ID) { // cancelled in the meantime
+				sendingReplies.Delete(scheduled.CommandID)
+				continue
+			}
+			// approval has already been checked when the reply was scheduled
+			sender, original, err := ic.prepareOutgoingMail(
+				ctx, scheduled.RoomID, scheduled.ThreadID, scheduled.CommandID, scheduled.ReplyToID, scheduled.Files,
+			)
+			if err == nil {
+				err = ic.sendReply(
+					ctx, sender, scheduled.RoomID, scheduled.CommandID, original,
+					scheduled.Body, scheduled.Cite, scheduled.ReplyAll, scheduled.Files,
+				)
+			}
+			sendingReplies.Delete(scheduled.CommandID)
+			if err != nil {
+				log.Errorf("Error sending scheduled reply %v: %v", scheduled.ID, err)
+				ic.matrixHandler.SetCommandState(scheduled.RoomID, scheduled.CommandID, matrix.Error)
+				ic.matrixHandler.NotifyScheduledReplyFailed(scheduled.RoomID, scheduled.ThreadID, err)
+			} else {
+				ic.matrixHandler.SetCommandState(scheduled.RoomID, scheduled.CommandID, matrix.Done)
+			}
+		}
+		return true
+	}
+	OutboxStage = NewStage("Outbox", setup, work, true)
+}
@@ -11,19 +11,29 @@ import (
 
 type contextKey string
 
-const retryKey contextKey = "retry"
+const (
+	retryKey   contextKey = "retry"
+	failureKey contextKey = "failure"
+)
 
 type PipelineStage struct {
 	name            string
 	setup           func(context.Context)
 	work            func(context.Context) bool
 	done            atomic.Bool
+	periodic        atomic.Bool // the latest work has been queued periodically
 	launch          chan struct{}
 	queuedTime      time.Time
 	queuedTimeMutex sync.RWMutex
 	isWorking       atomic.Bool
 	IsFirstWork     bool
 
+	statusMutex sync.RWMutex
+	lastRun     time.Time
+	lastFailure time.Time
+	lastError   string
+	retries     int
+
 	ctx            context.Context
 	cancelFunc     context.CancelFunc
 	active         bool
@@ -50,6 +60,10 @@ func NewStage(name string, setup func(context.Context), work func(context.Contex
 }
 
 func (s *PipelineStage) QueueWork() { // ensures that work is queued at most once
+	s.queueWork(false)
+}
+
+func (s *PipelineStage) queueWork(periodic bool) {
 	s.activeMutex.Lock()
 	defer s.activeMutex.Unlock()
 	if !s.active {
@@ -57,7 +71,8 @@ func (s *PipelineStage) QueueWork() { // ensures that work is queued at most onc
 	}
 	queue := s.done.CompareAndSwap(true, false)
 	if queue {
-		log.Infof("Queued pipeline stage '%s'", s.name)
+		s.periodic.Store(periodic)
+		s.logf("Queued pipeline stage '%s'", s.name)
 		s.launch <- struct{}{}
 		s.queuedTimeMutex.Lock()
 		s.queuedTime = time.Now().UTC()
@@ -65,6 +80,22 @@ func (s *PipelineStage) QueueWork() { // ensures that work is queued at most onc
 	}
 }
 
+// queue work every `interval` until ctx is done
+func (s *PipelineStage) queuePeriodically(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.queueWork(true)
+			}
+		}
+	}()
+}
+
 func (s *PipelineStage) QueueWorkBlocking() {
 	done := make(chan struct{})
 	s.blockingsMutex.Lock()
@@ -78,16 +109,33 @@ func (s *PipelineStage) Run(waitGroup *sync.WaitGroup) {
 	defer waitGroup.Done()
 	s.setup(s.ctx)
 	for range s.launch {
-		log.Infof("Executing pipeline stage '%s'...", s.name)
+		s.logf("Executing pipeline stage '%s'...", s.name)
 		s.done.Store(true)
 		s.isWorking.Store(true)
 		first := true
 		retry := false
+		s.setRetries(0)
 		for first || retry {
-			ctx := context.WithValue(s.ctx, retryKey, retry)
+			failure := new(string)
+			ctx := context.WithValue(context.WithValue(s.ctx, retryKey, retry), failureKey, failure)
+			if retry {
+				s.setRetries(s.Retries() + 1)
+			}
 			first = false
 			retry = !s.work(ctx) && ctx.Err() == nil
+			if retry {
+				if *failure == "" {
+					*failure = "unknown error"
+				}
+				s.statusMutex.Lock()
+				s.lastFailure = time.Now().UTC()
+				s.lastError = *failure
+				s.statusMutex.Unlock()
+			}
 		}
+		s.statusMutex.Lock()
+		s.lastRun = time.Now().UTC()
+		s.statusMutex.Unlock()
 		s.isWorking.Store(false)
 		s.IsFirstWork = false
 		s.blockingsMutex.Lock()
@@ -98,14 +146,69 @@ func (s *PipelineStage) Run(waitGroup *sync.WaitGroup) {
 			s.blockings = []chan struct{}{}
 		}
 		s.blockingsMutex.Unlock()
-		log.Infof("Done executing pipeline stage '%s'", s.name)
+		s.logf("Done executing pipeline stage '%s'", s.name)
+	}
+}
+
+// periodic work is logged at debug level as it would flood the log otherwise
+func (s *PipelineStage) logf(format string, args ...any) {
+	if s.periodic.Load() {
+		log.Debugf(format, args...)
+	} else {
+		log.Infof(format, args...)
+	}
+}
+
+// records why the current work attempt failed, returns false for convenience
+func stageFailed(ctx context.Context, reason string) bool {
+	if failure, ok := ctx.Value(failureKey).(*string); ok {
+		*failure = reason
 	}
+	return false
 }
 
 func (s *PipelineStage) Working() bool {
 	return s.isWorking.Load()
 }
 
+func (s *PipelineStage) Name() string {
+	return s.name
+}
+
+func (s *PipelineStage) setRetries(retries int) {
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
+	s.retries = retries
+}
+
+// retries of the current or most recent execution
+func (s *PipelineStage) Retries() int {
+	s.statusMutex.RLock()
+	defer s.statusMutex.RUnlock()
+	return s.retries
+}
+
+// time the most recent execution finished at
+func (s *PipelineStage) LastRun() time.Time {
+	s.statusMutex.RLock()
+	defer s.statusMutex.RUnlock()
+	return s.lastRun
+}
+
+// time of the most recent unsuccessful work attempt
+func (s *PipelineStage) LastFailure() time.Time {
+	s.statusMutex.RLock()
+	defer s.statusMutex.RUnlock()
+	return s.lastFailure
+}
+
+// reason of the most recent unsuccessful work attempt
+func (s *PipelineStage) LastError() string {
+	s.statusMutex.RLock()
+	defer s.statusMutex.RUnlock()
+	return s.lastError
+}
+
 func (s *PipelineStage) TimeSinceQueued() time.Duration {
 	s.queuedTimeMutex.RLock()
 	defer s.queuedTimeMutex.RUnlock()
@@ -0,0 +1,317 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	log "github.com/sirupsen/logrus"
+
+	model "github.com/arne314/inbox-collab/internal/db/generated"
+	modelcustom "github.com/arne314/inbox-collab/internal/db/sqlc"
+	"github.com/arne314/inbox-collab/internal/mail"
+	"github.com/arne314/inbox-collab/internal/matrix"
+)
+
+func (ic *InboxCollab) ReplyToMailInThread(ctx context.Context, roomId string, threadId string, originalMessageId string,
+	replyToId string, author string, text string, cite bool, replyAll bool, files []string,
+) (state matrix.CommandState, err error) {
+	if _, sending := sendingReplies.Load(originalMessageId); sending {
+		return matrix.Error, fmt.Errorf("your edit has been ignored as this mail is being sent right now")
+	}
+	delay := time.Duration(ic.Config.Matrix.SendDelay) * time.Second
+	return ic.replyToMail(ctx, roomId, threadId, originalMessageId, replyToId, author, text, cite, replyAll, files, delay)
+}
+
+// send the reply after `delay`, or draft it if it needs approval
+func (ic *InboxCollab) replyToMail(ctx context.Context, roomId string, threadId string, originalMessageId string,
+	replyToId string, author string, text string, cite bool, replyAll bool, files []string, delay time.Duration,
+) (state matrix.CommandState, err error) {
+	sender, original, err := ic.prepareOutgoingMail(ctx, roomId, threadId, originalMessageId, replyToId, files)
+	if err != nil {
+		return matrix.Error, err
+	}
+	if ic.Config.Matrix.RequiresApproval(roomId) {
+		return matrix.AwaitingApproval, ic.draftReply(ctx, &model.Draft{
+			CommandID: originalMessageId, RoomID: roomId, ThreadID: threadId, ReplyToID: replyToId,
+			Author: author, Body: text, Cite: cite, ReplyAll: replyAll, Files: files,
+		})
+	}
+	if delay > 0 {
+		return matrix.Pending, ic.delayReply(ctx, &model.Outbox{
+			CommandID: originalMessageId, RoomID: roomId, ThreadID: threadId, ReplyToID: replyToId,
+			Author: author, Body: text, Cite: cite, ReplyAll: replyAll, Files: files,
+			SendAt: pgtype.Timestamp{Time: time.Now().Add(delay), Valid: true},
+		})
+	}
+	return matrix.Done, ic.sendReply(ctx, sender, roomId, originalMessageId, original, text, cite, replyAll, files)
+}
+
+func (ic *InboxCollab) ForwardMail(ctx context.Context, roomId string, threadId string, originalMessageId string,
+	mailId string, author string, addrTo string, comment string,
+) (awaitingApproval bool, err error) {
+	sender, original, err := ic.prepareOutgoingMail(ctx, roomId, threadId, originalMessageId, mailId, nil)
+	if err != nil {
+		return false, err
+	}
+	if ic.Config.Matrix.RequiresApproval(roomId) {
+		return true, ic.draftReply(ctx, &model.Draft{
+			CommandID: originalMessageId, RoomID: roomId, ThreadID: threadId, ReplyToID: mailId,
+			Author: author, Body: comment, ForwardTo: pgtype.Text{String: addrTo, Valid: true}, Files: []string{},
+		})
+	}
+	return false, ic.sendForward(ctx, sender, roomId, originalMessageId, original, addrTo, comment)
+}
+
+// validate the mail to answer and get the sender of the room
+func (ic *InboxCollab) prepareOutgoingMail(ctx context.Context, roomId string, threadId string,
+	originalMessageId string, mailId string, files []string,
+) (*mail.MailSender, *model.Mail, error) {
+	sender := ic.mailHandler.GetMailSender(ic.Config.Matrix.GetRoomSender(roomId))
+	if sender == nil {
+		return nil, nil, fmt.Errorf("no sender is configured for this room")
+	}
+	if existing := ic.dbHandler.GetMailByMatrixId(ctx, originalMessageId); existing != nil {
+		return nil, nil, fmt.Errorf("your edit has been ignored as this mail had already been sent. Send a new message to send another one")
+	}
+	original := ic.getReplyTarget(ctx, threadId, mailId, files)
+	if original == nil {
+		return nil, nil, fmt.Errorf("this is not a valid mail. Choose one by directly replying to it on matrix")
+	}
+	return sender, original, nil
+}
+
+// get the mail to answer; when replying to an attached file, the latest mail of someone else is used
+func (ic *InboxCollab) getReplyTarget(ctx context.Context, threadId string, mailId string, files []string) *model.Mail {
+	if !slices.Contains(files, mailId) {
+		return ic.dbHandler.GetMailByMatrixId(ctx, mailId)
+	}
+	thread := ic.dbHandler.GetThreadByMatrixId(ctx, threadId)
+	if thread == nil {
+		return nil
+	}
+	mails := ic.dbHandler.GetMailsByThread(ctx, thread.ID)
+	for _, m := range slices.Backward(mails) {
+		if m.MatrixID.Valid && len(ic.mailHandler.FilterOwnAddresses([]string{m.AddrFrom})) > 0 {
+			return m
+		}
+	}
+	return nil
+}
+
+// store the reply and post a preview to be approved by another user
+func (ic *InboxCollab) draftReply(ctx context.Context, draft *model.Draft) error {
+	draft = ic.dbHandler.UpsertDraft(ctx, draft)
+	if draft == nil {
+		return fmt.Errorf("failed to store the reply draft")
+	}
+	ok, previewId := ic.matrixHandler.PostReplyDraft(
+		draft.RoomID, draft.ThreadID, draft.PreviewID.String, draft.Author, draft.Body, draft.ForwardTo.String,
+		len(draft.Files), draft.SendAt.Time,
+	)
+	if !ok {
+		return fmt.Errorf("failed to post the preview of the reply draft")
+	}
+	if previewId != draft.PreviewID.String {
+		ic.dbHandler.UpdateDraftPreview(ctx, draft.ID, previewId)
+	}
+	return nil
+}
+
+func (ic *InboxCollab) ApproveReply(ctx context.Context, roomId string, messageId string, approver string) {
+	draft := ic.dbHandler.GetDraftByMatrixId(ctx, messageId)
+	if draft == nil || draft.RoomID != roomId {
+		return
+	}
+	if approver == draft.Author {
+		ic.matrixHandler.NotifyReplyApproval(
+			roomId, draft.ThreadID, approver, time.Time{}, fmt.Errorf("replies have to be approved by a different member"),
+		)
+		return
+	}
+	if !ic.dbHandler.DeleteDraft(ctx, draft.ID) { // already approved by someone else
+		return
+	}
+	log.Infof("Reply draft %v has been approved by %v", draft.ID, approver)
+
+	if draft.SendAt.Valid && draft.SendAt.Time.After(time.Now()) {
+		var err error
+		if ic.dbHandler.UpsertOutboxMail(ctx, &model.Outbox{
+			CommandID: draft.CommandID, RoomID: roomId, ThreadID: draft.ThreadID, ReplyToID: draft.ReplyToID,
+			Author: draft.Author, Body: draft.Body, Cite: draft.Cite, ReplyAll: draft.ReplyAll, Files: draft.Files,
+			SendAt: draft.SendAt,
+		}) {
+			ic.matrixHandler.SetCommandState(roomId, draft.CommandID, matrix.Scheduled)
+		} else {
+			err = fmt.Errorf("failed to schedule the reply")
+			ic.matrixHandler.SetCommandState(roomId, draft.CommandID, matrix.Error)
+		}
+		ic.matrixHandler.NotifyReplyApproval(roomId, draft.ThreadID, approver, draft.SendAt.Time, err)
+		return
+	}
+
+	var err error
+	sender := ic.mailHandler.GetMailSender(ic.Config.Matrix.GetRoomSender(roomId))
+	original := ic.getReplyTarget(ctx, draft.ThreadID, draft.ReplyToID, draft.Files)
+	if sender == nil {
+		err = fmt.Errorf("no sender is configured for this room")
+	} else if original == nil {
+		err = fmt.Errorf("the mail to reply to does not exist anymore")
+	} else if draft.ForwardTo.Valid {
+		err = ic.sendForward(ctx, sender, roomId, draft.CommandID, original, draft.ForwardTo.String, draft.Body)
+	} else {
+		err = ic.sendReply(ctx, sender, roomId, draft.CommandID, original, draft.Body, draft.Cite, draft.ReplyAll, draft.Files)
+	}
+	if err == nil {
+		ic.matrixHandler.SetCommandState(roomId, draft.CommandID, matrix.Done)
+	} else {
+		log.Errorf("Error sending approved reply draft %v: %v", draft.ID, err)
+		ic.matrixHandler.SetCommandState(roomId, draft.CommandID, matrix.Error)
+	}
+	ic.matrixHandler.NotifyReplyApproval(roomId, draft.ThreadID, approver, time.Time{}, err)
+}
+
+func (ic *InboxCollab) sendReply(ctx context.Context, sender *mail.MailSender, roomId string,
+	originalMessageId string, original *model.Mail, text string, cite bool, replyAll bool, files []string,
+) error {
+	// download attachments
+	downloaded, err := ic.matrixHandler.DownloadFiles(roomId, files)
+	if err != nil {
+		return fmt.Errorf("failed to download the attachments: %w", err)
+	}
+	attachments := make([]*mail.Attachment, len(downloaded))
+	for i, file := range downloaded {
+		attachments[i] = &mail.Attachment{Name: file.Name, ContentType: file.ContentType, Content: file.Content}
+	}
+
+	// send mail
+	ic.LockThreadSorting() // we are manually sorting this mail
+	defer ic.UnlockThreadSorting()
+	var cited string
+	if cite { // only the original mail is cited, never the notes of the thread
+		cited = *original.Body
+	}
+	addrCc := []string{}
+	if replyAll {
+		addrCc = ic.mailHandler.FilterOwnAddresses(slices.Concat(original.AddrTo, original.AddrCc))
+	}
+	newMail, message, raw, err := sender.SendReplyMail(
+		text, matrix.RenderMarkdown(text), cited, original.Subject, original.Timestamp.Time, original.HeaderID, original.HeaderReferences,
+		original.NameFrom, original.AddrFrom, original.AddrReplyTo, addrCc, attachments,
+	)
+	if err != nil {
+		return err
+	}
+	return ic.recordSentMail(ctx, sender, roomId, originalMessageId, original, newMail, message, raw, false)
+}
+
+func (ic *InboxCollab) sendForward(ctx context.Context, sender *mail.MailSender, roomId string,
+	originalMessageId string, original *model.Mail, addrTo string, comment string,
+) error {
+	files, err := ic.getForwardedFiles(ctx, roomId, original)
+	if err != nil {
+		return err
+	}
+	ic.LockThreadSorting() // we are manually sorting this mail
+	defer ic.UnlockThreadSorting()
+	var commentHtml string
+	if comment != "" {
+		commentHtml = matrix.RenderMarkdown(comment)
+	}
+	newMail, message, raw, err := sender.SendForwardMail(comment, commentHtml, &mail.Mail{
+		NameFrom:    original.NameFrom,
+		AddrFrom:    original.AddrFrom,
+		AddrTo:      original.AddrTo,
+		AddrCc:      original.AddrCc,
+		Subject:     original.Subject,
+		Date:        original.Timestamp.Time,
+		Text:        *original.Body,
+		Html:        original.BodyHtml,
+		MessageId:   original.HeaderID,
+		References:  original.HeaderReferences,
+		Attachments: original.Attachments,
+		Files:       files,
+	}, addrTo)
+	if err != nil {
+		return err
+	}
+	return ic.recordSentMail(ctx, sender, roomId, originalMessageId, original, newMail, message, raw, true)
+}
+
+// get the stored attachments of `original`, those already uploaded to matrix are downloaded again
+func (ic *InboxCollab) getForwardedFiles(ctx context.Context, roomId string, original *model.Mail,
+) ([]*mail.Attachment, error) {
+	attachments := ic.dbHandler.GetAttachmentsByMail(ctx, original.ID)
+	for _, name := range original.Attachments {
+		if !slices.ContainsFunc(attachments, func(a *model.Attachment) bool { return a.Filename == name && !a.Inline }) {
+			return nil, fmt.Errorf(
+				"the attachment %s has not been stored (e.g. due to its size), forward the mail using a mail client", name,
+			)
+		}
+	}
+	files := make([]*mail.Attachment, len(attachments))
+	for i, attachment := range attachments {
+		files[i] = &mail.Attachment{
+			Name: attachment.Filename, ContentType: attachment.ContentType, Content: attachment.Content,
+			Inline: attachment.Inline,
+		}
+		if attachment.Content != nil {
+			continue
+		}
+		fileRoomId := attachment.MatrixRoomID.String
+		if !attachment.MatrixRoomID.Valid { // uploaded into the room of the thread
+			fileRoomId = roomId
+		}
+		if !attachment.MatrixID.Valid {
+			return nil, fmt.Errorf("the attachment %s is not available", attachment.Filename)
+		}
+		downloaded, err := ic.matrixHandler.DownloadFiles(fileRoomId, []string{attachment.MatrixID.String})
+		if err != nil {
+			return nil, fmt.Errorf("failed to download the attachment %s: %w", attachment.Filename, err)
+		}
+		files[i].Content = downloaded[0].Content
+	}
+	return files, nil
+}
+
+// store a sent mail in the mailboxes and add it to the thread of `original`;
+// forwards don't reply to the correspondent and thus never close the thread
+func (ic *InboxCollab) recordSentMail(ctx context.Context, sender *mail.MailSender, roomId string,
+	originalMessageId string, original *model.Mail, newMail *mail.Mail, message string, raw string, forward bool,
+) error {
+	// store mail in imap mailboxes
+	var errorMessage string
+	if !ic.mailHandler.StoreSentMail(sender.Name, newMail, raw) {
+		errorMessage += "Failed to store mail in mailbox. "
+	}
+
+	// properly add mail to db
+	dbMail := modelMailForDb(newMail)
+	dbMail.Forwarded = forward
+	ic.dbHandler.AddMails(ctx, []*model.Mail{dbMail}, nil)
+	var newMailModel *model.Mail
+	if byId := ic.dbHandler.GetMailsByMessageIds(ctx, []string{newMail.MessageId}); len(byId) > 0 {
+		newMailModel = byId[0]
+		newMailModel.Messages = &modelcustom.ExtractedMessages{
+			Messages: []*modelcustom.Message{
+				{Author: newMailModel.NameFrom, Timestamp: &newMailModel.Timestamp.Time, Content: &message},
+			},
+		}
+		ic.dbHandler.UpdateExtractedMessages(ctx, newMailModel)
+		ic.dbHandler.AddMailToThread(ctx, newMailModel, original.Thread.Int64)
+		if !forward {
+			ic.closeAnsweredThread(ctx, original.Thread.Int64)
+		}
+		ic.dbHandler.UpdateMailMatrixId(ctx, newMailModel.ID, originalMessageId)
+	} else {
+		errorMessage += "Failed to store mail in database. "
+	}
+
+	ic.QueueMatrixOverviewUpdate([]string{roomId}, true)
+	if errorMessage != "" {
+		return fmt.Errorf("mail was sent successfully but there was an issue processing it afterwards: %s", errorMessage)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/arne314/inbox-collab/internal/matrix"
+	textprocessor "github.com/arne314/inbox-collab/internal/textprocessor"
+)
+
+func (ic *InboxCollab) GetStatus(ctx context.Context) *matrix.Status {
+	status := &matrix.Status{}
+
+	// pipeline
+	stages := []*PipelineStage{
+		ThreadSortingStage, MessageExtractionStage, MatrixNotificationStage, ThreadSnoozeStage, OutboxStage,
+		ThreadReminderStage, DigestStage,
+	}
+	for _, room := range slices.Sorted(maps.Keys(MatrixOverviewStages)) {
+		stages = append(stages, MatrixOverviewStages[room])
+	}
+	for _, stage := range stages {
+		status.Stages = append(status.Stages, matrix.StageStatus{
+			Name:        stage.Name(),
+			Working:     stage.Working(),
+			LastRun:     stage.LastRun(),
+			LastFailure: stage.LastFailure(),
+			LastError:   stage.LastError(),
+			Retries:     stage.Retries(),
+		})
+	}
+
+	// mail
+	for _, fetcher := range ic.mailHandler.GetMailFetchers() {
+		status.Fetchers = append(status.Fetchers, matrix.FetcherStatus{
+			Name:         fetcher.Name(),
+			Idle:         fetcher.IsIdle(),
+			Reconnecting: fetcher.IsReconnecting(),
+			UidLast:      fetcher.UidLast(),
+			LastFetch:    fetcher.LastFetch(),
+		})
+	}
+
+	// llm
+	ctxLLM, cancelLLM := context.WithTimeout(ctx, 10*time.Second)
+	defer cancelLLM()
+	llmStatus, err := textprocessor.GetLLMStatus(ctxLLM, ic.Config.LLM.ApiUrl)
+	if err == nil {
+		status.LLMPassthrough = llmStatus.Passthrough
+		status.LLMConcurrentPrompts = llmStatus.ConcurrentPrompts
+	} else {
+		status.LLMError = err
+	}
+
+	// db
+	status.PendingSorting = len(ic.dbHandler.GetMailsRequiringSorting(ctx))
+	status.PendingExtraction = len(ic.dbHandler.GetMailsRequiringMessageExtraction(ctx))
+	status.PendingMatrixThreads = len(ic.dbHandler.GetMatrixReadyThreads(ctx))
+	status.PendingMatrixMails = len(ic.dbHandler.GetMatrixReadyMails(ctx))
+	return status
+}
@@ -0,0 +1,41 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func (ic *InboxCollab) setupThreadReminderStage() {
+	setup := func(ctx context.Context) {
+		ThreadReminderStage.queuePeriodically(ctx, time.Minute)
+	}
+
+	work := func(ctx context.Context) bool {
+		rooms := ic.Config.Matrix.ResponseTargetRooms()
+		if ic.Config.Matrix.VerifySession || len(rooms) == 0 {
+			return true
+		}
+		touchedRooms := []string{}
+		for _, thread := range ic.dbHandler.GetUnansweredThreads(ctx, rooms) {
+			roomId := thread.MatrixRoomID.String
+			waiting := time.Since(thread.MailTimestamp.Time)
+			if waiting < ic.Config.Matrix.GetResponseTarget(roomId) {
+				continue
+			}
+			if !ic.matrixHandler.NotifyResponseOverdue(roomId, thread.MatrixID.String, thread.Assignee.String, waiting) {
+				return stageFailed(ctx, fmt.Sprintf("reminding thread %v failed", thread.ID))
+			}
+			log.Infof("Reminded thread %v of its unanswered mail %v", thread.ID, thread.LastMail.Int64)
+			ic.dbHandler.UpdateThreadReminded(ctx, thread.ID, thread.LastMail.Int64)
+			touchedRooms = append(touchedRooms, roomId)
+		}
+		if len(touchedRooms) > 0 {
+			ic.QueueMatrixOverviewUpdate(touchedRooms, false)
+		}
+		return true
+	}
+	ThreadReminderStage = NewStage("ThreadReminder", setup, work, true)
+}
@@ -0,0 +1,40 @@
+package app
+
+import (
+	"context"
+	"time"
+)
+
+func (ic *InboxCollab) SnoozeThread(ctx context.Context, roomId string, threadId string, until time.Time) bool {
+	ic.dbHandler.UpdateThreadEnabled(ctx, roomId, threadId, false, false) // thread might already be closed
+	ok := ic.dbHandler.UpdateThreadSnooze(ctx, roomId, threadId, until)   // fails for force closed threads
+	if ok {
+		ic.QueueMatrixOverviewUpdate([]string{roomId}, true)
+	}
+	return ok
+}
+
+func (ic *InboxCollab) setupThreadSnoozeStage() {
+	setup := func(ctx context.Context) {
+		ThreadSnoozeStage.queuePeriodically(ctx, time.Minute)
+	}
+
+	work := func(ctx context.Context) bool {
+		if ic.Config.Matrix.VerifySession {
+			return true
+		}
+		threads := ic.dbHandler.ReopenSnoozedThreads(ctx)
+		touchedRooms := make([]string, 0, len(threads))
+		for _, thread := range threads {
+			if thread.MatrixID.Valid {
+				ic.matrixHandler.NotifySnoozeEnded(thread.MatrixRoomID.String, thread.MatrixID.String)
+			}
+			touchedRooms = append(touchedRooms, thread.MatrixRoomID.String)
+		}
+		if len(touchedRooms) > 0 {
+			ic.QueueMatrixOverviewUpdate(touchedRooms, false)
+		}
+		return true
+	}
+	ThreadSnoozeStage = NewStage("ThreadSnooze", setup, work, true)
+}
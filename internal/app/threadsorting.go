@@ -29,7 +29,7 @@ func (ic *InboxCollab) setupThreadSortingStage() {
 		if waitForCompleteData {
 			log.Infof("Waiting for complete data to sort threads...")
 			time.Sleep(2 * time.Second)
-			return false
+			return stageFailed(ctx, "waiting for complete mail data")
 		}
 
 		ic.dbHandler.AutoUpdateMailSorting(ctx)
@@ -58,6 +58,7 @@ func (ic *InboxCollab) setupThreadSortingStage() {
 			}
 			if threadId != 0 {
 				ic.dbHandler.AddMailToThread(ctx, mail, threadId)
+				ic.closeAnsweredThread(ctx, threadId)
 				continue
 			}
 			headAllowed := true
@@ -83,3 +84,10 @@ func (ic *InboxCollab) setupThreadSortingStage() {
 		false, // initial queueing happens in storeMails()
 	)
 }
+
+// close the thread if configured and its last mail has been sent by us
+func (ic *InboxCollab) closeAnsweredThread(ctx context.Context, threadId int64) {
+	if ic.Config.Matrix.CloseAnswered && ic.dbHandler.CloseAnsweredThread(ctx, threadId) {
+		log.Infof("Closed thread %v as the last mail has been sent by us", threadId)
+	}
+}
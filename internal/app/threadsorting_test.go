@@ -0,0 +1,118 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	cfg "github.com/arne314/inbox-collab/internal/config"
+	"github.com/arne314/inbox-collab/internal/db"
+	model "github.com/arne314/inbox-collab/internal/db/generated"
+)
+
+// connect to TEST_DATABASE_URL using a new schema that is dropped afterwards
+func newTestDbHandler(t *testing.T, config *cfg.Config) (*db.DbHandler, *pgxpool.Pool) {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	separator := "?"
+	if strings.Contains(url, "?") {
+		separator = "&"
+	}
+	config.DatabaseUrl = url + separator + "search_path=" + schema
+	pool, err := pgxpool.New(ctx, config.DatabaseUrl)
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	t.Cleanup(func() {
+		pool.Exec(context.Background(), fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE", schema))
+		pool.Close()
+	})
+	schemaSql, err := os.ReadFile("../db/sqlc/schema.sql")
+	if err != nil {
+		t.Fatalf("Failed to read schema: %v", err)
+	}
+	if _, err = pool.Exec(ctx, fmt.Sprintf("CREATE SCHEMA %s", schema)); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	if _, err = pool.Exec(ctx, string(schemaSql)); err != nil {
+		t.Fatalf("Failed to apply schema: %v", err)
+	}
+	dh := &db.DbHandler{Config: config}
+	dh.Setup()
+	return dh, pool
+}
+
+func TestCloseAnsweredThread(t *testing.T) {
+	config := &cfg.Config{
+		Mail:   &cfg.MailConfig{OwnAddresses: []string{"support@example.com"}},
+		Matrix: &cfg.MatrixConfig{CloseAnswered: true},
+	}
+	dh, pool := newTestDbHandler(t, config)
+	ic := &InboxCollab{Config: config, dbHandler: dh}
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	type testMail struct {
+		sender    string
+		forwarded bool
+	}
+	tests := []struct {
+		name  string
+		mails []testMail
+		want  bool // closed
+	}{
+		{"replied", []testMail{{"customer@example.com", false}, {"support@example.com", false}}, true},
+		{"correspondent_last", []testMail{{"support@example.com", false}, {"customer@example.com", false}}, false},
+		{"forwarded", []testMail{{"customer@example.com", false}, {"support@example.com", true}}, false},
+		{"replied_forwarded", []testMail{
+			{"customer@example.com", false}, {"support@example.com", false}, {"support@example.com", true},
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var threadId int64
+			for i, m := range tt.mails {
+				body := "Hello"
+				headerId := fmt.Sprintf("%s-%d@example.com", tt.name, i)
+				dh.AddMails(ctx, []*model.Mail{{
+					HeaderID: headerId, HeaderReferences: []string{},
+					Timestamp: pgtype.Timestamp{Time: start.Add(time.Duration(i) * time.Hour), Valid: true},
+					NameFrom:  "Someone", AddrFrom: m.sender, AddrTo: []string{}, AddrCc: []string{}, AddrReplyTo: []string{},
+					Subject: "Test", Body: &body, Attachments: []string{}, Forwarded: m.forwarded,
+				}}, nil)
+				mails := dh.GetMailsByMessageIds(ctx, []string{headerId})
+				if len(mails) != 1 {
+					t.Fatalf("Failed to add mail %v", headerId)
+				}
+				if i == 0 {
+					dh.CreateThread(ctx, mails[0])
+					threadId = dh.GetMailsByMessageIds(ctx, []string{headerId})[0].Thread.Int64
+				} else {
+					dh.AddMailToThread(ctx, mails[0], threadId)
+				}
+			}
+			ic.closeAnsweredThread(ctx, threadId)
+
+			var enabled bool
+			var closed pgtype.Timestamp
+			err := pool.QueryRow(ctx, "SELECT enabled, closed FROM thread WHERE id = $1", threadId).Scan(&enabled, &closed)
+			if err != nil {
+				t.Fatalf("Failed to get thread %v: %v", threadId, err)
+			}
+			if enabled == tt.want || closed.Valid != tt.want {
+				t.Errorf("enabled = %v, closed = %v, want closed %v", enabled, closed.Valid, tt.want)
+			}
+		})
+	}
+}
@@ -1,11 +1,15 @@
 package config
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"maps"
+	"net/mail"
 	"os"
 	"regexp"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,10 +22,23 @@ var (
 	allRooms         []string
 	allOverviewRooms []string
 	allTargetRooms   []string
-	roomAliases      map[string]string   // alias -> room
-	roomAliasesInv   map[string]string   // room -> alias
-	roomsOverviewInv map[string][]string // target -> overview rooms
-	roomSender       map[string]string   // room -> sender
+	roomAliases      map[string]string        // alias -> room
+	roomAliasesInv   map[string]string        // room -> alias
+	roomsOverviewInv map[string][]string      // target -> overview rooms
+	roomSender       map[string]string        // room -> sender
+	roomsApproval    map[string]bool          // rooms requiring reply approval
+	sendersApproval  map[string]bool          // senders requiring reply approval
+	roomsSenders     map[string][]string      // room -> users that may always send mails
+	sendersUsers     map[string][]string      // sender -> users that may always send mails
+	roomsResponse    map[string]time.Duration // room -> time to answer new mails within
+
+	// sections a digest can consist of
+	DigestSections = []string{"new", "closed", "unanswered", "oldest"}
+
+	// commands that can be run by reacting to a thread and undone by removing the reaction
+	threadReactionCommands = []string{"open", "close", "forceclose", "claim"}
+	// reactions the bot uses to show the state of commands (see matrix.CommandStateReactions)
+	stateReactions = []string{"👀", "⏳", "✅", "❌", "🔏", "🕓"}
 )
 
 type LLMConfig struct {
@@ -29,15 +46,17 @@ type LLMConfig struct {
 }
 
 type MailSenderConfig struct {
-	Hostname string   `toml:"hostname"`
-	Port     int      `toml:"port"`
-	AddrFrom string   `toml:"addr_from"`
-	AddrCC   []string `toml:"addr_cc"`
-	AddrBCC  []string `toml:"addr_bcc"`
-	Store    []string `toml:"store"`
-	Storers  []Storer
-	Username string
-	Password string
+	Hostname        string   `toml:"hostname"`
+	Port            int      `toml:"port"`
+	AddrFrom        string   `toml:"addr_from"`
+	AddrCC          []string `toml:"addr_cc"`
+	AddrBCC         []string `toml:"addr_bcc"`
+	Store           []string `toml:"store"`
+	RequireApproval bool     `toml:"require_approval"`
+	AllowedUsers    []string `toml:"allowed_users"` // may send mails regardless of their power level
+	Storers         []Storer
+	Username        string
+	Password        string
 }
 
 type MailSourceConfig struct {
@@ -49,29 +68,66 @@ type MailSourceConfig struct {
 }
 
 type MailConfig struct {
-	MaxAge        int                          `toml:"max_age"`
-	Senders       map[string]*MailSenderConfig `toml:"senders"`
-	Sources       map[string]*MailSourceConfig `toml:"sources"`
-	Timezone      string                       `toml:"timezone"`
-	ListMailboxes bool
+	MaxAge            int                          `toml:"max_age"`
+	Senders           map[string]*MailSenderConfig `toml:"senders"`
+	Sources           map[string]*MailSourceConfig `toml:"sources"`
+	Timezone          string                       `toml:"timezone"`
+	AttachmentMaxSize float64                      `toml:"attachment_max_size"` // in MB, 0 disables uploads
+	AttachmentTypes   []string                     `toml:"attachment_types"`    // mime types like "image/*"
+	OwnAddresses      []string                     `toml:"own_addresses"`       // defaults to the senders' addresses
+	ListMailboxes     bool
+}
+
+type OverviewConfig struct {
+	Rooms           []string `toml:"rooms"`
+	Tags            []string `toml:"tags"` // only list threads with any of these labels
+	UnassignedFirst bool     `toml:"unassigned_first"`
+	Digest          string   `toml:"digest"`          // schedule like "8:00" (daily) or "monday 8:00" (weekly)
+	DigestSections  []string `toml:"digest_sections"` // any of DigestSections
+	DigestLimit     int      `toml:"digest_limit"`    // maximum number of threads listed per section
+	DigestSchedule  *DigestSchedule
+}
+
+// point in time a digest is posted at, either daily or weekly
+type DigestSchedule struct {
+	Weekly  bool
+	Weekday time.Weekday
+	Hour    int
+	Minute  int
 }
 
 type MatrixConfig struct {
-	Aliases       map[string]string   `toml:"aliases"`
-	DefaultRoom   string              `toml:"default_room"`
-	DefaultSender string              `toml:"default_sender"`
-	RoomsAddrFrom map[string]string   `toml:"rooms_addr_from"`
-	RoomsAddrTo   map[string]string   `toml:"rooms_addr_to"`
-	RoomsMailbox  map[string]string   `toml:"rooms_mailbox"`
-	SenderRooms   map[string][]string `toml:"sender"`   // sender -> rooms
-	RoomsOverview map[string][]string `toml:"overview"` // overview room -> targets
-	HeadBlacklist []string            `toml:"head_blacklist"`
-	Timezone      string              `toml:"timezone"`
+	Aliases          map[string]string   `toml:"aliases"`
+	DefaultRoom      string              `toml:"default_room"`
+	DefaultSender    string              `toml:"default_sender"`
+	RoomsAddrFrom    map[string]string   `toml:"rooms_addr_from"`
+	RoomsAddrTo      map[string]string   `toml:"rooms_addr_to"`
+	RoomsMailbox     map[string]string   `toml:"rooms_mailbox"`
+	SenderRooms      map[string][]string `toml:"sender"`   // sender -> rooms
+	RoomsOverviewRaw map[string]any      `toml:"overview"` // overview room -> targets or OverviewConfig
+	HeadBlacklist    []string            `toml:"head_blacklist"`
+	Timezone         string              `toml:"timezone"`
+	RequireApproval  []string            `toml:"require_approval"`  // rooms whose replies need approval
+	ApprovalReaction string              `toml:"approval_reaction"` // emoji to approve replies with
+	SendDelay        int                 `toml:"send_delay"`        // seconds to wait before sending replies
+	ThreadReactions  map[string]string   `toml:"thread_reactions"`  // emoji -> command run when reacting to a thread, disabled by default
+	CloseAnswered    bool                `toml:"close_answered"`    // close threads once the last mail is our own
+
+	// permissions
+	AdminPowerLevelRaw *int                `toml:"admin_power_level"` // required for admin commands
+	SendPowerLevelRaw  *int                `toml:"send_power_level"`  // required to send mails
+	Admins             []string            `toml:"admins"`            // may run admin commands regardless of their power level
+	AllowedSendersRaw  map[string][]string `toml:"allowed_senders"`   // room -> users that may always send mails
+
+	ResponseTargetsRaw map[string]string `toml:"response_targets"` // room -> duration like "48h" or "2d"
 
 	RoomsAddrFromRegex map[*regexp.Regexp]string
 	RoomsAddrToRegex   map[*regexp.Regexp]string
 	RoomsMailboxRegex  map[*regexp.Regexp]string
 	HeadBlacklistRegex []*regexp.Regexp
+	RoomsOverview      map[string]*OverviewConfig // overview room -> config
+	AdminPowerLevel    int
+	SendPowerLevel     int
 
 	HomeServer    string
 	Username      string
@@ -125,15 +181,23 @@ func (c *MatrixConfig) AllOverviewRooms() (rooms []string) {
 
 // Get the rooms that the `overviewRoom` provides an overview of
 func (c *MatrixConfig) GetOverviewRoomTargets(overviewRoom string) []string {
-	if rooms, ok := c.RoomsOverview[overviewRoom]; ok {
-		if len(rooms) == 0 {
+	if overview, ok := c.RoomsOverview[overviewRoom]; ok {
+		if len(overview.Rooms) == 0 {
 			return c.AllTargetRooms()
 		}
-		return rooms
+		return overview.Rooms
 	}
 	return []string{}
 }
 
+// Get the options of the `overviewRoom`
+func (c *MatrixConfig) GetOverviewConfig(overviewRoom string) *OverviewConfig {
+	if overview, ok := c.RoomsOverview[overviewRoom]; ok {
+		return overview
+	}
+	return &OverviewConfig{}
+}
+
 // Get the rooms that provide an overview of `target`
 func (c *MatrixConfig) GetOverviewRooms(target string) []string {
 	if rooms, ok := roomsOverviewInv[target]; ok {
@@ -150,6 +214,41 @@ func (c *MatrixConfig) GetRoomSender(room string) string {
 	return c.DefaultSender
 }
 
+// Check whether replies sent from a room have to be approved by another user
+func (c *MatrixConfig) RequiresApproval(room string) bool {
+	return roomsApproval[room] || sendersApproval[c.GetRoomSender(room)]
+}
+
+// Check whether a user may run admin commands regardless of their power level
+func (c *MatrixConfig) IsAdmin(user string) bool {
+	return slices.Contains(c.Admins, user)
+}
+
+// Check whether a user may send mails from a room regardless of their power level
+func (c *MatrixConfig) IsAllowedSender(room string, user string) bool {
+	return slices.Contains(roomsSenders[room], user) || slices.Contains(sendersUsers[c.GetRoomSender(room)], user)
+}
+
+// Get the time new mails of a room should be answered within, 0 if there is no target
+func (c *MatrixConfig) GetResponseTarget(room string) time.Duration {
+	return roomsResponse[room]
+}
+
+// Get all rooms with a response target
+func (c *MatrixConfig) ResponseTargetRooms() []string {
+	return slices.Collect(maps.Keys(roomsResponse))
+}
+
+// parse durations like "48h", "90m" or "2d"
+func parseResponseTarget(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if days, found := strings.CutSuffix(value, "d"); found {
+		n, err := strconv.Atoi(days)
+		return time.Duration(n) * 24 * time.Hour, err
+	}
+	return time.ParseDuration(value)
+}
+
 func resolveRoomValue(room string) (res string) {
 	if roomId, ok := roomAliases[room]; ok {
 		res = roomId
@@ -172,6 +271,89 @@ func filterRooms(rooms []string) []string {
 	return slices.Compact(res)
 }
 
+// overview rooms are configured either by a list of targets or by a table of options
+func parseOverviewConfig(room string, value any) *OverviewConfig {
+	if targets, ok := value.([]any); ok {
+		value = map[string]any{"rooms": targets}
+	}
+	if _, ok := value.(map[string]any); !ok {
+		log.Fatalf("Overview config of room '%s' has to be a list of rooms or a table", room)
+	}
+	encoded, err := toml.Marshal(value)
+	if err != nil {
+		log.Fatalf("Error encoding overview config of room '%s': %v", room, err)
+	}
+	overview := &OverviewConfig{}
+	decoder := toml.NewDecoder(bytes.NewReader(encoded)).DisallowUnknownFields()
+	if err := decoder.Decode(overview); err != nil {
+		log.Fatalf("Overview config of room '%s' is invalid: %v", room, err)
+	}
+	for i, tag := range overview.Tags {
+		overview.Tags[i] = strings.ToLower(strings.TrimSpace(tag))
+	}
+	if overview.Digest != "" {
+		if overview.DigestSchedule, err = ParseDigestSchedule(overview.Digest); err != nil {
+			log.Fatalf("Digest schedule of overview room '%s' is invalid: %v", room, err)
+		}
+	}
+	if len(overview.DigestSections) == 0 {
+		overview.DigestSections = DigestSections
+	}
+	for _, section := range overview.DigestSections {
+		if !slices.Contains(DigestSections, section) {
+			log.Fatalf("Digest section '%s' of overview room '%s' is invalid, use any of %v", section, room, DigestSections)
+		}
+	}
+	if overview.DigestLimit <= 0 {
+		overview.DigestLimit = 10
+	}
+	return overview
+}
+
+// parse schedules like "8:00" or "daily 8:00" (daily) and "monday 8:00" or "mon 8:00" (weekly)
+func ParseDigestSchedule(value string) (*DigestSchedule, error) {
+	fields := strings.Fields(strings.ToLower(value))
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, fmt.Errorf("expected a time like \"8:00\" optionally preceded by a weekday")
+	}
+	schedule := &DigestSchedule{}
+	if len(fields) == 2 && fields[0] != "daily" {
+		weekday := slices.IndexFunc([]time.Weekday{
+			time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday,
+		}, func(day time.Weekday) bool {
+			name := strings.ToLower(day.String())
+			return fields[0] == name || fields[0] == name[:3]
+		})
+		if weekday < 0 {
+			return nil, fmt.Errorf("unknown weekday '%s'", fields[0])
+		}
+		schedule.Weekly, schedule.Weekday = true, time.Weekday(weekday)
+	}
+	clock, err := time.Parse("15:04", fields[len(fields)-1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid time '%s'", fields[len(fields)-1])
+	}
+	schedule.Hour, schedule.Minute = clock.Hour(), clock.Minute()
+	return schedule, nil
+}
+
+// the latest point in time at or before `now` the digest has been due at (in the location of `now`)
+func (s *DigestSchedule) Latest(now time.Time) time.Time {
+	year, month, day := now.Date()
+	due := time.Date(year, month, day, s.Hour, s.Minute, 0, 0, now.Location())
+	if !s.Weekly {
+		if due.After(now) {
+			due = due.AddDate(0, 0, -1)
+		}
+		return due
+	}
+	due = due.AddDate(0, 0, -((int(now.Weekday()) - int(s.Weekday) + 7) % 7))
+	if due.After(now) {
+		due = due.AddDate(0, 0, -7)
+	}
+	return due
+}
+
 func (c *Config) Load() {
 	// load config.toml
 	file, err := os.ReadFile("config/config.toml")
@@ -230,6 +412,20 @@ func (c *Config) Load() {
 		}
 	}
 
+	// own addresses mark threads as answered
+	if c.Mail.OwnAddresses == nil {
+		for _, sender := range c.Mail.Senders {
+			c.Mail.OwnAddresses = append(c.Mail.OwnAddresses, sender.AddrFrom)
+		}
+	}
+	for i, raw := range c.Mail.OwnAddresses {
+		addr, err := mail.ParseAddress(raw)
+		if err != nil {
+			log.Fatalf("Own address '%s' is invalid: %v", raw, err)
+		}
+		c.Mail.OwnAddresses[i] = strings.ToLower(addr.Address)
+	}
+
 	// regex validation
 	c.Matrix.HeadBlacklistRegex = make([]*regexp.Regexp, len(c.Matrix.HeadBlacklist))
 	for i, addr := range c.Matrix.HeadBlacklist {
@@ -269,31 +465,36 @@ func (c *Config) Load() {
 	validateRoomsRegex(c.Matrix.RoomsMailbox, c.Matrix.RoomsMailboxRegex)
 
 	// load overview config
-	roomsOverview := make(map[string][]string)
+	roomsOverview := make(map[string]*OverviewConfig)
 	roomsOverviewInv = make(map[string][]string)
-	c.Matrix.RoomsOverview[""] = []string{c.Matrix.DefaultRoom} // also a target
+	if c.Matrix.RoomsOverviewRaw == nil {
+		c.Matrix.RoomsOverviewRaw = make(map[string]any)
+	}
+	c.Matrix.RoomsOverviewRaw[""] = []any{c.Matrix.DefaultRoom} // also a target
 
 	// handle aliases and populate lists
 	roomsWithFullOverview := []string{} // rooms that provide an overview over all rooms
-	for overview, ts := range c.Matrix.RoomsOverview {
+	for overview, raw := range c.Matrix.RoomsOverviewRaw {
+		overviewConfig := parseOverviewConfig(overview, raw)
 		overview = resolveRoomValue(overview)
 		allOverviewRooms = append(allOverviewRooms, overview)
-		targets := make([]string, len(ts))
-		for i, t := range ts {
+		targets := make([]string, len(overviewConfig.Rooms))
+		for i, t := range overviewConfig.Rooms {
 			target := resolveRoomValue(t)
 			targets[i] = target
 			allTargetRooms = append(allTargetRooms, target)
 		}
-		if len(ts) == 0 {
+		if len(overviewConfig.Rooms) == 0 {
 			roomsWithFullOverview = append(roomsWithFullOverview, overview)
 		}
-		roomsOverview[overview] = filterRooms(targets)
+		overviewConfig.Rooms = filterRooms(targets)
+		roomsOverview[overview] = overviewConfig
 	}
 	roomsWithFullOverview = filterRooms(roomsWithFullOverview)
 
 	// fill inverse map
-	for overview, targets := range roomsOverview {
-		for _, target := range targets {
+	for overview, overviewConfig := range roomsOverview {
+		for _, target := range overviewConfig.Rooms {
 			roomsOverviewInv[target] = append(roomsOverviewInv[target], overview)
 		}
 	}
@@ -322,6 +523,60 @@ func (c *Config) Load() {
 		}
 	}
 
+	// reply approval
+	roomsApproval = make(map[string]bool)
+	sendersApproval = make(map[string]bool)
+	for _, alias := range c.Matrix.RequireApproval {
+		roomsApproval[resolveRoomValue(alias)] = true
+	}
+	for name, sender := range c.Mail.Senders {
+		sendersApproval[name] = sender.RequireApproval
+	}
+	if c.Matrix.ApprovalReaction == "" {
+		c.Matrix.ApprovalReaction = "👍"
+	}
+
+	// permissions
+	c.Matrix.AdminPowerLevel = 50
+	if c.Matrix.AdminPowerLevelRaw != nil {
+		c.Matrix.AdminPowerLevel = *c.Matrix.AdminPowerLevelRaw
+	}
+	if c.Matrix.SendPowerLevelRaw != nil {
+		c.Matrix.SendPowerLevel = *c.Matrix.SendPowerLevelRaw
+	}
+	roomsSenders = make(map[string][]string)
+	sendersUsers = make(map[string][]string)
+	for alias, users := range c.Matrix.AllowedSendersRaw {
+		room := resolveRoomValue(alias)
+		roomsSenders[room] = append(roomsSenders[room], users...)
+	}
+	for name, sender := range c.Mail.Senders {
+		sendersUsers[name] = sender.AllowedUsers
+	}
+
+	// response targets
+	roomsResponse = make(map[string]time.Duration)
+	for alias, value := range c.Matrix.ResponseTargetsRaw {
+		target, err := parseResponseTarget(value)
+		if err != nil || target <= 0 {
+			log.Fatalf("Response target '%s' of room '%s' is invalid, use a duration like \"48h\" or \"2d\"", value, alias)
+		}
+		roomsResponse[resolveRoomValue(alias)] = target
+	}
+
+	// thread reactions (opt-in)
+	for emoji, command := range c.Matrix.ThreadReactions {
+		if !slices.Contains(threadReactionCommands, command) {
+			log.Fatalf("Thread reaction %s uses unsupported command '%s', use one of %v", emoji, command, threadReactionCommands)
+		}
+		if emoji == c.Matrix.ApprovalReaction || slices.Contains(stateReactions, emoji) {
+			log.Fatalf("Thread reaction %s is already used to approve replies or to show command states", emoji)
+		}
+	}
+	if c.Matrix.SendDelay < 0 {
+		log.Fatalf("The matrix send delay must not be negative")
+	}
+
 	// validate sender store and fill storers
 	for name, sender := range c.Mail.Senders {
 		sender.Storers = make([]Storer, len(sender.Store))
@@ -0,0 +1,35 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseResponseTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"hours", "48h", 48 * time.Hour, false},
+		{"minutes", "90m", 90 * time.Minute, false},
+		{"days", "2d", 48 * time.Hour, false},
+		{"spaces", " 3d ", 72 * time.Hour, false},
+		{"spaces_hours", " 12h", 12 * time.Hour, false},
+		{"fractional_days", "1.5d", 0, true},
+		{"no_unit", "48", 0, true},
+		{"empty", "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseResponseTarget(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseResponseTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseResponseTarget() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arne314/inbox-collab/internal/config"
+)
+
+func TestDigestSchedule(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 30, 0, 0, time.UTC) // wednesday
+	tests := []struct {
+		name     string
+		schedule string
+		wantOk   bool
+		want     time.Time
+	}{
+		{"daily_passed", "8:00", true, time.Date(2026, 10, 14, 8, 0, 0, 0, time.UTC)},
+		{"daily_upcoming", "daily 18:15", true, time.Date(2026, 10, 13, 18, 15, 0, 0, time.UTC)},
+		{"daily_now", "12:30", true, now},
+		{"weekly_today", "wednesday 9:00", true, time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC)},
+		{"weekly_today_upcoming", "Wed 13:00", true, time.Date(2026, 10, 7, 13, 0, 0, 0, time.UTC)},
+		{"weekly_past", "mon 8:00", true, time.Date(2026, 10, 12, 8, 0, 0, 0, time.UTC)},
+		{"weekly_later", "friday 8:00", true, time.Date(2026, 10, 9, 8, 0, 0, 0, time.UTC)},
+		{"invalid_weekday", "someday 8:00", false, time.Time{}},
+		{"invalid_time", "monday 25:00", false, time.Time{}},
+		{"empty", "", false, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := config.ParseDigestSchedule(tt.schedule)
+			if (err == nil) != tt.wantOk {
+				t.Fatalf("ParseDigestSchedule() error = %v, want ok %v", err, tt.wantOk)
+			}
+			if err != nil {
+				return
+			}
+			if got := schedule.Latest(now); !got.Equal(tt.want) {
+				t.Errorf("Latest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
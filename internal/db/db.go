@@ -50,9 +50,10 @@ func defaultContext(ctx context.Context) (context.Context, context.CancelFunc) {
 	return context.WithTimeout(ctx, dbTimeout)
 }
 
-func (dh *DbHandler) AddMails(ctx context.Context, mails []*db.Mail) int {
+// add mails and the attachments of the newly inserted ones, `attachments` can be nil
+func (dh *DbHandler) AddMails(ctx context.Context, mails []*db.Mail, attachments [][]*db.Attachment) int {
 	count := 0
-	for _, mail := range mails {
+	for i, mail := range mails {
 		ctxAdd, cancelAdd := defaultContext(ctx)
 		defer cancelAdd()
 		inserted, err := dh.queries.AddMail(ctxAdd, db.AddMailParams{
@@ -65,14 +66,34 @@ func (dh *DbHandler) AddMails(ctx context.Context, mails []*db.Mail) int {
 			NameFrom:         mail.NameFrom,
 			AddrFrom:         mail.AddrFrom,
 			AddrTo:           mail.AddrTo,
+			AddrCc:           mail.AddrCc,
+			AddrReplyTo:      mail.AddrReplyTo,
 			Subject:          mail.Subject,
 			Body:             mail.Body,
+			BodyHtml:         mail.BodyHtml,
+			HtmlOnly:         mail.HtmlOnly,
+			Forwarded:        mail.Forwarded,
 		})
 		if err == nil {
 			count += len(inserted)
 		} else {
 			log.Errorf("Error adding mail to db: %v", err)
 		}
+		if len(inserted) == 0 || attachments == nil {
+			continue
+		}
+		for _, attachment := range attachments[i] {
+			err = dh.queries.AddAttachment(ctxAdd, db.AddAttachmentParams{
+				Mail:        inserted[0].ID,
+				Filename:    attachment.Filename,
+				ContentType: attachment.ContentType,
+				Content:     attachment.Content,
+				Inline:      attachment.Inline,
+			})
+			if err != nil {
+				log.Errorf("Error adding attachment %v of mail %v to db: %v", attachment.Filename, inserted[0].ID, err)
+			}
+		}
 	}
 	return count
 }
@@ -130,6 +151,30 @@ func (dh *DbHandler) GetMailsByMessageIds(ctx context.Context, messageIds []stri
 	return getMails(ctx, get, fmt.Sprintf("with message ids %v", messageIds))
 }
 
+func (dh *DbHandler) SearchThreads(ctx context.Context, query string, sender string,
+	rooms []string, before time.Time, after time.Time, maxResults int,
+) []*db.SearchThreadsRow {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	threads, err := dh.queries.SearchThreads(ctx, db.SearchThreadsParams{
+		Query:      query,
+		Sender:     sender,
+		Rooms:      rooms,
+		Before:     pgtype.Timestamp{Time: before.UTC(), Valid: !before.IsZero()},
+		After:      pgtype.Timestamp{Time: after.UTC(), Valid: !after.IsZero()},
+		MaxResults: int32(maxResults),
+	})
+	if err != nil {
+		log.Errorf("Error searching threads for '%v': %v", query, err)
+		return []*db.SearchThreadsRow{}
+	}
+	for _, thread := range threads {
+		thread.NameFrom = displayName(thread.NameFrom, thread.AddrFrom)
+	}
+	log.Infof("Found %v threads matching search '%v'", len(threads), query)
+	return threads
+}
+
 func (dh *DbHandler) GetMailsRequiringMessageExtraction(ctx context.Context) []*db.Mail {
 	return getMails(ctx, dh.queries.GetMailsRequiringMessageExtraction, "requiring message extraction")
 }
@@ -215,6 +260,7 @@ func (dh *DbHandler) CreateThread(ctx context.Context, mail *db.Mail) {
 		log.Errorf("Error setting thread of mail %v to %v: %v", mail.ID, thread.ID, err)
 		return
 	}
+	dh.refreshThreadAnswered(ctx, thread.ID)
 	log.Infof("Created new thread with mail %v", mail.ID)
 }
 
@@ -241,9 +287,34 @@ func (dh *DbHandler) AddMailToThread(ctx context.Context, mail *db.Mail, threadI
 		log.Errorf("Error setting last mail of thread %v to %v: %v", threadId, mail.ID, err)
 		return
 	}
+	dh.refreshThreadAnswered(ctx, threadId)
 	log.Infof("Added mail %v to thread %v", mail.ID, threadId)
 }
 
+// mark the thread as answered if its last mail apart from forwards has been sent from one of the own addresses
+func (dh *DbHandler) refreshThreadAnswered(ctx context.Context, threadId int64) {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	err := dh.queries.RefreshThreadAnswered(ctx, db.RefreshThreadAnsweredParams{
+		Ids: []int64{threadId}, OwnAddresses: dh.Config.Mail.OwnAddresses,
+	})
+	if err != nil {
+		log.Errorf("Error updating answered state of thread %v: %v", threadId, err)
+	}
+}
+
+// close the thread if its last mail is our own; returns whether the thread has been closed
+func (dh *DbHandler) CloseAnsweredThread(ctx context.Context, threadId int64) bool {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	count, err := dh.queries.CloseAnsweredThread(ctx, threadId)
+	if err != nil {
+		log.Errorf("Error closing answered thread %v: %v", threadId, err)
+		return false
+	}
+	return count > 0
+}
+
 func (dh *DbHandler) MarkMailAsSorted(ctx context.Context, mail *db.Mail) {
 	ctx, cancel := defaultContext(ctx)
 	defer cancel()
@@ -360,9 +431,102 @@ func (dh *DbHandler) RemoveMatrixMessageIdsOfThread(ctx context.Context, threadI
 		log.Errorf("Error removing mail matrix ids for thread %v: %v", threadId, err)
 		return false
 	}
+	ctxNote, cancelNote := defaultContext(ctx)
+	defer cancelNote()
+	err = dh.queries.RemoveNoteMatrixIdsByThread(ctxNote, threadId)
+	if err != nil {
+		log.Errorf("Error removing note matrix ids for thread %v: %v", threadId, err)
+		return false
+	}
+	return true
+}
+
+func (dh *DbHandler) AddNote(ctx context.Context, threadId int64, author string, body string) bool {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	err := dh.queries.AddNote(ctx, db.AddNoteParams{
+		Thread:    threadId,
+		Author:    author,
+		Timestamp: pgtype.Timestamp{Time: time.Now().UTC(), Valid: true},
+		Body:      body,
+	})
+	if err != nil {
+		log.Errorf("Error adding note to thread %v: %v", threadId, err)
+		return false
+	}
 	return true
 }
 
+func (dh *DbHandler) GetMatrixReadyNotes(ctx context.Context) []*db.GetMatrixReadyNotesRow {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	notes, err := dh.queries.GetMatrixReadyNotes(ctx)
+	if err != nil {
+		log.Errorf("Error getting matrix ready notes from db: %v", err)
+		return []*db.GetMatrixReadyNotesRow{}
+	}
+	return notes
+}
+
+func (dh *DbHandler) UpdateNoteMatrixId(ctx context.Context, noteId int64, matrixId string) {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	err := dh.queries.UpdateNoteMatrixId(ctx, db.UpdateNoteMatrixIdParams{
+		ID:       noteId,
+		MatrixID: pgtype.Text{String: matrixId, Valid: true},
+	})
+	if err != nil {
+		log.Errorf("Error updating note matrix id: %v", err)
+	}
+}
+
+// attachments of posted mails that haven't been uploaded and failed less than `maxFailures` times
+func (dh *DbHandler) GetAttachmentsByMail(ctx context.Context, mailId int64) []*db.Attachment {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	attachments, err := dh.queries.GetAttachmentsByMail(ctx, mailId)
+	if err != nil {
+		log.Errorf("Error getting attachments of mail %v from db: %v", mailId, err)
+		return []*db.Attachment{}
+	}
+	return attachments
+}
+
+func (dh *DbHandler) GetMatrixReadyAttachments(ctx context.Context, maxFailures int) []*db.GetMatrixReadyAttachmentsRow {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	attachments, err := dh.queries.GetMatrixReadyAttachments(ctx, int32(maxFailures))
+	if err != nil {
+		log.Errorf("Error getting matrix ready attachments from db: %v", err)
+		return []*db.GetMatrixReadyAttachmentsRow{}
+	}
+	return attachments
+}
+
+func (dh *DbHandler) UpdateAttachmentMatrixId(ctx context.Context,
+	attachmentId int64, matrixId string, mailMatrixId string, roomId string,
+) {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	err := dh.queries.UpdateAttachmentMatrixId(ctx, db.UpdateAttachmentMatrixIdParams{
+		ID:           attachmentId,
+		MatrixID:     pgtype.Text{String: matrixId, Valid: true},
+		MatrixMailID: pgtype.Text{String: mailMatrixId, Valid: true},
+		MatrixRoomID: pgtype.Text{String: roomId, Valid: true},
+	})
+	if err != nil {
+		log.Errorf("Error updating attachment matrix id: %v", err)
+	}
+}
+
+func (dh *DbHandler) AddAttachmentUploadFailure(ctx context.Context, attachmentId int64) {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	if err := dh.queries.AddAttachmentUploadFailure(ctx, attachmentId); err != nil {
+		log.Errorf("Error marking upload of attachment %v as failed: %v", attachmentId, err)
+	}
+}
+
 func (dh *DbHandler) UpdateMailMatrixId(ctx context.Context, mailId int64, matrixId string) {
 	ctx, cancel := defaultContext(ctx)
 	defer cancel()
@@ -400,6 +564,379 @@ func (dh *DbHandler) UpdateThreadEnabled(ctx context.Context,
 	return count == 1
 }
 
+func (dh *DbHandler) UpdateThreadAssignee(ctx context.Context,
+	roomId string, messageId string, assignee string,
+) bool {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	count, err := dh.queries.UpdateThreadAssignee(ctx, db.UpdateThreadAssigneeParams{
+		MatrixID:     pgtype.Text{String: messageId, Valid: true},
+		MatrixRoomID: pgtype.Text{String: roomId, Valid: true},
+		Assignee:     pgtype.Text{String: assignee, Valid: assignee != ""},
+	})
+	if err != nil {
+		log.Errorf(
+			"Error updating assignee of thread in room %v with message %v to %v: %v",
+			roomId, messageId, assignee, err,
+		)
+		return false
+	}
+	return count == 1
+}
+
+func (dh *DbHandler) UpdateThreadSnooze(ctx context.Context,
+	roomId string, messageId string, until time.Time,
+) bool {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	count, err := dh.queries.UpdateThreadSnooze(ctx, db.UpdateThreadSnoozeParams{
+		MatrixID:     pgtype.Text{String: messageId, Valid: true},
+		MatrixRoomID: pgtype.Text{String: roomId, Valid: true},
+		SnoozedUntil: pgtype.Timestamp{Time: until.UTC(), Valid: true},
+	})
+	if err != nil {
+		log.Errorf(
+			"Error snoozing thread in room %v with message %v until %v: %v",
+			roomId, messageId, until, err,
+		)
+		return false
+	}
+	return count == 1
+}
+
+// get open threads in `rooms` whose latest mail hasn't been answered or reminded of yet
+func (dh *DbHandler) GetUnansweredThreads(ctx context.Context, rooms []string) []*db.GetUnansweredThreadsRow {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	threads, err := dh.queries.GetUnansweredThreads(ctx, rooms)
+	if err != nil {
+		log.Errorf("Error getting unanswered threads: %v", err)
+		return []*db.GetUnansweredThreadsRow{}
+	}
+	return threads
+}
+
+func (dh *DbHandler) UpdateThreadReminded(ctx context.Context, threadId int64, mailId int64) {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	err := dh.queries.UpdateThreadReminded(ctx, db.UpdateThreadRemindedParams{
+		ID: threadId, RemindedMail: pgtype.Int8{Int64: mailId, Valid: true},
+	})
+	if err != nil {
+		log.Errorf("Error updating reminder of thread %v: %v", threadId, err)
+	}
+}
+
+func (dh *DbHandler) ReopenSnoozedThreads(ctx context.Context) []*db.Thread {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	threads, err := dh.queries.ReopenSnoozedThreads(
+		ctx, pgtype.Timestamp{Time: time.Now().UTC(), Valid: true},
+	)
+	if err != nil {
+		log.Errorf("Error reopening snoozed threads: %v", err)
+		return []*db.Thread{}
+	}
+	if len(threads) > 0 {
+		log.Infof("Reopened %v snoozed threads", len(threads))
+	}
+	return threads
+}
+
+func (dh *DbHandler) AddThreadLabels(ctx context.Context, threadId int64, labels []string) bool {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	err := dh.queries.AddThreadLabels(ctx, db.AddThreadLabelsParams{Thread: threadId, Labels: labels})
+	if err != nil {
+		log.Errorf("Error adding labels %v to thread %v: %v", labels, threadId, err)
+		return false
+	}
+	return true
+}
+
+func (dh *DbHandler) RemoveThreadLabels(ctx context.Context, threadId int64, labels []string) bool {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	count, err := dh.queries.RemoveThreadLabels(ctx, db.RemoveThreadLabelsParams{Thread: threadId, Labels: labels})
+	if err != nil {
+		log.Errorf("Error removing labels %v from thread %v: %v", labels, threadId, err)
+		return false
+	}
+	return count > 0
+}
+
+// find the thread a matrix event (thread root, mail or note) belongs to
+func (dh *DbHandler) GetThreadByMatrixEvent(ctx context.Context, roomId string, eventId string) *db.Thread {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	thread, err := dh.queries.GetThreadByMatrixEvent(ctx, db.GetThreadByMatrixEventParams{RoomID: roomId, EventID: eventId})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Errorf("Error getting thread by matrix event: %v", err)
+		}
+		return nil
+	}
+	return thread
+}
+
+// store that `reader` has seen the thread; returns whether anything changed
+func (dh *DbHandler) UpdateThreadReader(ctx context.Context, threadId int64, reader string, seen time.Time) bool {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	timestamp := pgtype.Timestamp{Time: seen.UTC(), Valid: true}
+	count, err := dh.queries.AddThreadReader(ctx, db.AddThreadReaderParams{Thread: threadId, Reader: reader, Seen: timestamp})
+	if err == nil && count == 0 {
+		count, err = dh.queries.UpdateThreadReaderSeen(
+			ctx, db.UpdateThreadReaderSeenParams{Thread: threadId, Reader: reader, Seen: timestamp},
+		)
+	}
+	if err != nil {
+		log.Errorf("Error updating reader %v of thread %v: %v", reader, threadId, err)
+		return false
+	}
+	return count > 0
+}
+
+func (dh *DbHandler) GetThreadReaders(ctx context.Context, threadId int64) []*db.GetThreadReadersRow {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	readers, err := dh.queries.GetThreadReaders(ctx, threadId)
+	if err != nil {
+		log.Errorf("Error getting readers of thread %v: %v", threadId, err)
+		return []*db.GetThreadReadersRow{}
+	}
+	return readers
+}
+
+// move all mails of thread `source` into thread `target` and delete `source` afterwards
+func (dh *DbHandler) MergeThreads(ctx context.Context, source int64, target int64) bool {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	tx, err := dh.pool.Begin(ctx)
+	if err != nil {
+		log.Errorf("Error starting transaction to merge thread %v into %v: %v", source, target, err)
+		return false
+	}
+	defer tx.Rollback(ctx)
+	queries := dh.queries.WithTx(tx)
+
+	count, err := queries.MoveThreadMails(ctx, db.MoveThreadMailsParams{
+		Source: pgtype.Int8{Int64: source, Valid: true},
+		Target: pgtype.Int8{Int64: target, Valid: true},
+	})
+	if err == nil {
+		err = queries.MoveThreadLabels(ctx, db.MoveThreadLabelsParams{Source: source, Target: target})
+	}
+	if err == nil {
+		err = queries.MoveThreadNotes(ctx, db.MoveThreadNotesParams{Source: source, Target: target})
+	}
+	if err == nil {
+		err = queries.MergeThreadState(ctx, db.MergeThreadStateParams{Source: source, Target: target})
+	}
+	if err == nil {
+		err = queries.RefreshThreadAnswered(ctx, db.RefreshThreadAnsweredParams{
+			Ids: []int64{target}, OwnAddresses: dh.Config.Mail.OwnAddresses,
+		})
+	}
+	if err == nil {
+		err = queries.DeleteThread(ctx, source)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		log.Errorf("Error merging thread %v into %v: %v", source, target, err)
+		return false
+	}
+	log.Infof("Merged thread %v with %v mails into thread %v", source, count, target)
+	return true
+}
+
+// move `mail` and optionally all later mails of thread `source` into a new thread within `roomId`
+func (dh *DbHandler) SplitThread(ctx context.Context,
+	source int64, mail int64, includeLater bool, roomId string,
+) (int64, bool) {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	tx, err := dh.pool.Begin(ctx)
+	if err != nil {
+		log.Errorf("Error starting transaction to split mail %v off thread %v: %v", mail, source, err)
+		return 0, false
+	}
+	defer tx.Rollback(ctx)
+	queries := dh.queries.WithTx(tx)
+
+	var count int64
+	thread, err := queries.AddThread(ctx, pgtype.Int8{Int64: mail, Valid: true})
+	if err == nil {
+		err = queries.UpdateThreadMatrixIds(ctx, db.UpdateThreadMatrixIdsParams{
+			ID:           thread.ID,
+			MatrixRoomID: pgtype.Text{String: roomId, Valid: roomId != ""},
+		})
+	}
+	if err == nil {
+		count, err = queries.SplitThreadMails(ctx, db.SplitThreadMailsParams{
+			Source:       pgtype.Int8{Int64: source, Valid: true},
+			Target:       pgtype.Int8{Int64: thread.ID, Valid: true},
+			SplitMail:    mail,
+			IncludeLater: includeLater,
+		})
+	}
+	if err == nil {
+		err = queries.RefreshThreadLastMail(ctx, []int64{source, thread.ID})
+	}
+	if err == nil {
+		err = queries.RefreshThreadAnswered(ctx, db.RefreshThreadAnsweredParams{
+			Ids: []int64{source, thread.ID}, OwnAddresses: dh.Config.Mail.OwnAddresses,
+		})
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		log.Errorf("Error splitting mail %v off thread %v: %v", mail, source, err)
+		return 0, false
+	}
+	log.Infof("Split %v mails off thread %v into new thread %v", count, source, thread.ID)
+	return thread.ID, true
+}
+
+func (dh *DbHandler) UpsertDraft(ctx context.Context, draft *db.Draft) *db.Draft {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	upserted, err := dh.queries.UpsertDraft(ctx, db.UpsertDraftParams{
+		CommandID: draft.CommandID,
+		RoomID:    draft.RoomID,
+		ThreadID:  draft.ThreadID,
+		ReplyToID: draft.ReplyToID,
+		Author:    draft.Author,
+		Body:      draft.Body,
+		Cite:      draft.Cite,
+		ReplyAll:  draft.ReplyAll,
+		ForwardTo: draft.ForwardTo,
+		Files:     draft.Files,
+		SendAt:    draft.SendAt,
+	})
+	if err != nil {
+		log.Errorf("Error storing draft of command %v: %v", draft.CommandID, err)
+		return nil
+	}
+	return upserted
+}
+
+func (dh *DbHandler) UpdateDraftPreview(ctx context.Context, draftId int64, previewId string) {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	err := dh.queries.UpdateDraftPreview(ctx, db.UpdateDraftPreviewParams{
+		ID:        draftId,
+		PreviewID: pgtype.Text{String: previewId, Valid: true},
+	})
+	if err != nil {
+		log.Errorf("Error updating preview of draft %v: %v", draftId, err)
+	}
+}
+
+// get a draft by the matrix id of either its command or its preview
+func (dh *DbHandler) GetDraftByMatrixId(ctx context.Context, matrixId string) *db.Draft {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	draft, err := dh.queries.GetDraftByMatrixId(ctx, matrixId)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Errorf("Error getting draft by matrix id: %v", err)
+		}
+		return nil
+	}
+	return draft
+}
+
+func (dh *DbHandler) DeleteDraft(ctx context.Context, draftId int64) bool {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	count, err := dh.queries.DeleteDraft(ctx, draftId)
+	if err != nil {
+		log.Errorf("Error deleting draft %v: %v", draftId, err)
+		return false
+	}
+	return count == 1
+}
+
+func (dh *DbHandler) UpsertOutboxMail(ctx context.Context, mail *db.Outbox) bool {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	err := dh.queries.UpsertOutboxMail(ctx, db.UpsertOutboxMailParams{
+		CommandID: mail.CommandID,
+		RoomID:    mail.RoomID,
+		ThreadID:  mail.ThreadID,
+		ReplyToID: mail.ReplyToID,
+		Author:    mail.Author,
+		Body:      mail.Body,
+		Cite:      mail.Cite,
+		ReplyAll:  mail.ReplyAll,
+		Files:     mail.Files,
+		SendAt:    pgtype.Timestamp{Time: mail.SendAt.Time.UTC(), Valid: true},
+	})
+	if err != nil {
+		log.Errorf("Error scheduling mail of command %v: %v", mail.CommandID, err)
+		return false
+	}
+	return true
+}
+
+func (dh *DbHandler) GetDueOutboxMails(ctx context.Context) []*db.Outbox {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	mails, err := dh.queries.GetDueOutboxMails(ctx, pgtype.Timestamp{Time: time.Now().UTC(), Valid: true})
+	if err != nil {
+		log.Errorf("Error getting due outbox mails: %v", err)
+		return []*db.Outbox{}
+	}
+	return mails
+}
+
+func (dh *DbHandler) GetOutboxMailByCommand(ctx context.Context, roomId string, commandId string) *db.Outbox {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	mail, err := dh.queries.GetOutboxMailByCommand(ctx, db.GetOutboxMailByCommandParams{
+		RoomID: roomId, CommandID: commandId,
+	})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Errorf("Error getting outbox mail of command %v: %v", commandId, err)
+		}
+		return nil
+	}
+	return mail
+}
+
+func (dh *DbHandler) DeleteOutboxMail(ctx context.Context, mailId int64) bool {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	count, err := dh.queries.DeleteOutboxMail(ctx, mailId)
+	if err != nil {
+		log.Errorf("Error deleting outbox mail %v: %v", mailId, err)
+		return false
+	}
+	return count == 1
+}
+
+// delete the scheduled mail of a command, nil if there is none
+func (dh *DbHandler) DeleteOutboxMailByCommand(ctx context.Context, roomId string, commandId string) *db.Outbox {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	deleted, err := dh.queries.DeleteOutboxMailByCommand(ctx, db.DeleteOutboxMailByCommandParams{
+		RoomID: roomId, CommandID: commandId,
+	})
+	if err != nil {
+		log.Errorf("Error deleting outbox mail of command %v: %v", commandId, err)
+		return nil
+	}
+	if len(deleted) == 0 {
+		return nil
+	}
+	return deleted[0]
+}
+
 func (dh *DbHandler) AddAllRooms(ctx context.Context) {
 	ctx, cancel := defaultContext(ctx)
 	defer cancel()
@@ -422,6 +959,32 @@ func (dh *DbHandler) GetRoom(ctx context.Context, roomId string) *db.Room {
 	return room
 }
 
+func (dh *DbHandler) UpdateRoomDigest(ctx context.Context, roomId string, timestamp time.Time) {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	err := dh.queries.UpdateRoomDigest(ctx, db.UpdateRoomDigestParams{
+		ID: roomId, DigestLast: pgtype.Timestamp{Time: timestamp.UTC(), Valid: true},
+	})
+	if err != nil {
+		log.Errorf("Error updating digest of room %v: %v", roomId, err)
+	}
+}
+
+// get the open threads and the threads closed after `since` ordered by their first mail
+func (dh *DbHandler) GetDigestThreads(ctx context.Context, targets []string, tags []string, since time.Time,
+) []*db.GetDigestThreadsRow {
+	ctx, cancel := defaultContext(ctx)
+	defer cancel()
+	threads, err := dh.queries.GetDigestThreads(ctx, db.GetDigestThreadsParams{
+		Targets: targets, Tags: tags, Since: pgtype.Timestamp{Time: since.UTC(), Valid: true},
+	})
+	if err != nil {
+		log.Errorf("Error getting digest threads: %v", err)
+		return []*db.GetDigestThreadsRow{}
+	}
+	return threads
+}
+
 func (dh *DbHandler) GetRooms(ctx context.Context, roomIds []string) []*db.Room {
 	ctx, cancel := defaultContext(ctx)
 	defer cancel()
@@ -448,65 +1011,49 @@ func (dh *DbHandler) UpdateRoomName(ctx context.Context, roomId string, name str
 	}
 }
 
-func (dh *DbHandler) UpdateRoomOverviewMessage(ctx context.Context, roomId string, messageId string) {
-	ctx, cancel := defaultContext(ctx)
-	defer cancel()
-	err := dh.queries.UpdateRoomOverviewMessage(
-		ctx,
-		db.UpdateRoomOverviewMessageParams{
-			ID:                roomId,
-			OverviewMessageID: pgtype.Text{String: messageId, Valid: true},
-		},
-	)
-	if err != nil {
-		log.Errorf("Error updating room overview message id: %v", err)
-	}
-}
-
+// get the overview message ids and the threads to list in the overview
 func (dh *DbHandler) GetOverviewThreads(ctx context.Context,
 	overviewRoom string,
-) (messageId string, authors []string, subjects []string, rooms []string, threadMsgs []string) {
+) (messageIds []string, threads []*db.GetOverviewThreadsRow) {
 	// load room
 	ctxRoom, cancelRoom := defaultContext(ctx)
 	defer cancelRoom()
 	room, err := dh.queries.GetRoom(ctxRoom, overviewRoom)
 	if err != nil {
 		log.Errorf("Error reading overview room %v from db: %v", overviewRoom, err)
-		return "", []string{}, []string{}, []string{}, []string{}
+		return []string{}, []*db.GetOverviewThreadsRow{}
 	}
-	messageId = room.OverviewMessageID.String
+	messageIds = room.OverviewMessageIds
 
 	// load threads
-	targets := dh.Config.Matrix.GetOverviewRoomTargets(overviewRoom)
 	ctxThreads, cancelThreads := defaultContext(ctx)
 	defer cancelThreads()
-	threads, err := dh.queries.GetOverviewThreads(ctxThreads, targets)
+	overviewConfig := dh.Config.Matrix.GetOverviewConfig(overviewRoom)
+	threads, err = dh.queries.GetOverviewThreads(ctxThreads, db.GetOverviewThreadsParams{
+		Targets:         dh.Config.Matrix.GetOverviewRoomTargets(overviewRoom),
+		Tags:            overviewConfig.Tags,
+		UnassignedFirst: overviewConfig.UnassignedFirst,
+	})
 	if err != nil {
 		log.Errorf("Error reading overview room %v from db: %v", overviewRoom, err)
-		return "", []string{}, []string{}, []string{}, []string{}
+		return []string{}, []*db.GetOverviewThreadsRow{}
 	}
 	log.Infof("Fetched %v threads for overview room %v from db", len(threads), overviewRoom)
-	authors = make([]string, len(threads))
-	subjects = make([]string, len(threads))
-	rooms = make([]string, len(threads))
-	threadMsgs = make([]string, len(threads))
-	for i, thread := range threads {
-		authors[i] = displayName(thread.NameFrom, thread.AddrFrom)
-		subjects[i] = thread.Subject
-		rooms[i] = thread.MatrixRoomID.String
-		threadMsgs[i] = thread.MessageID.String
+	for _, thread := range threads {
+		thread.NameFrom = displayName(thread.NameFrom, thread.AddrFrom)
+		thread.LastNameFrom = displayName(thread.LastNameFrom, thread.LastAddrFrom)
 	}
 	return
 }
 
-func (dh *DbHandler) OverviewMessageUpdated(ctx context.Context, roomId string, messageId string) {
+func (dh *DbHandler) OverviewMessageUpdated(ctx context.Context, roomId string, messageIds []string) {
 	ctx, cancel := defaultContext(ctx)
 	defer cancel()
 	err := dh.queries.UpdateRoomOverviewMessage(
 		ctx,
 		db.UpdateRoomOverviewMessageParams{
-			ID:                roomId,
-			OverviewMessageID: pgtype.Text{String: messageId, Valid: true},
+			ID:                 roomId,
+			OverviewMessageIds: messageIds,
 		},
 	)
 	if err != nil {
@@ -0,0 +1,323 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	config "github.com/arne314/inbox-collab/internal/config"
+	db "github.com/arne314/inbox-collab/internal/db/generated"
+)
+
+// connect to TEST_DATABASE_URL and create the schema in a new namespace that is dropped afterwards
+func newTestHandler(t *testing.T, ownAddresses ...string) *DbHandler {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	poolConfig, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		t.Fatalf("Invalid TEST_DATABASE_URL: %v", err)
+	}
+	poolConfig.ConnConfig.RuntimeParams["search_path"] = schema
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	t.Cleanup(func() {
+		pool.Exec(context.Background(), fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE", schema))
+		pool.Close()
+	})
+	schemaSql, err := os.ReadFile("sqlc/schema.sql")
+	if err != nil {
+		t.Fatalf("Failed to read schema: %v", err)
+	}
+	if _, err = pool.Exec(ctx, fmt.Sprintf("CREATE SCHEMA %s", schema)); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	if _, err = pool.Exec(ctx, string(schemaSql)); err != nil {
+		t.Fatalf("Failed to apply schema: %v", err)
+	}
+	cfg := &config.Config{Mail: &config.MailConfig{OwnAddresses: ownAddresses}}
+	return &DbHandler{Config: cfg, pool: pool, queries: db.New(pool)}
+}
+
+func addTestMail(t *testing.T, dh *DbHandler, headerId string, addrFrom string, timestamp time.Time) *db.Mail {
+	t.Helper()
+	body := "Hello"
+	mails, err := dh.queries.AddMail(context.Background(), db.AddMailParams{
+		HeaderID:         headerId,
+		HeaderReferences: []string{},
+		Timestamp:        pgtype.Timestamp{Time: timestamp, Valid: true},
+		NameFrom:         "Someone",
+		AddrFrom:         addrFrom,
+		AddrTo:           []string{"support@example.com"},
+		AddrCc:           []string{},
+		AddrReplyTo:      []string{},
+		Subject:          "Test",
+		Body:             &body,
+		Attachments:      []string{},
+	})
+	if err != nil || len(mails) != 1 {
+		t.Fatalf("Failed to add mail %v: %v", headerId, err)
+	}
+	return mails[0]
+}
+
+// create a thread from the given senders in chronological order
+func addTestThread(t *testing.T, dh *DbHandler, name string, senders ...string) (int64, []*db.Mail) {
+	t.Helper()
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	var threadId int64
+	mails := make([]*db.Mail, len(senders))
+	for i, sender := range senders {
+		mails[i] = addTestMail(t, dh, fmt.Sprintf("%s-%d@example.com", name, i), sender, start.Add(time.Duration(i)*time.Hour))
+		if i == 0 {
+			dh.CreateThread(ctx, mails[i])
+			threadId = getTestMailThread(t, dh, mails[i].ID)
+		} else {
+			dh.AddMailToThread(ctx, mails[i], threadId)
+		}
+	}
+	return threadId, mails
+}
+
+func getTestMailThread(t *testing.T, dh *DbHandler, mailId int64) int64 {
+	t.Helper()
+	var threadId pgtype.Int8
+	err := dh.pool.QueryRow(context.Background(), "SELECT thread FROM mail WHERE id = $1", mailId).Scan(&threadId)
+	if err != nil {
+		t.Fatalf("Failed to get thread of mail %v: %v", mailId, err)
+	}
+	return threadId.Int64
+}
+
+func getTestThread(t *testing.T, dh *DbHandler, threadId int64) (enabled bool, answered bool, closed bool) {
+	t.Helper()
+	var closedAt pgtype.Timestamp
+	err := dh.pool.QueryRow(
+		context.Background(), "SELECT enabled, answered, closed FROM thread WHERE id = $1", threadId,
+	).Scan(&enabled, &answered, &closedAt)
+	if err != nil {
+		t.Fatalf("Failed to get thread %v: %v", threadId, err)
+	}
+	return enabled, answered, closedAt.Valid
+}
+
+func TestRefreshThreadAnswered(t *testing.T) {
+	dh := newTestHandler(t, "support@example.com")
+	tests := []struct {
+		name    string
+		senders []string
+		want    bool
+	}{
+		{"incoming", []string{"customer@example.com"}, false},
+		{"own_first", []string{"support@example.com"}, true},
+		{"answered", []string{"customer@example.com", "support@example.com"}, true},
+		{"case_insensitive", []string{"customer@example.com", "Support@Example.com"}, true},
+		{"followup", []string{"customer@example.com", "support@example.com", "customer@example.com"}, false},
+		{"other_sender", []string{"customer@example.com", "colleague@example.com"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			threadId, _ := addTestThread(t, dh, tt.name, tt.senders...)
+			if _, answered, _ := getTestThread(t, dh, threadId); answered != tt.want {
+				t.Errorf("answered = %v, want %v", answered, tt.want)
+			}
+		})
+	}
+}
+
+func TestCloseAnsweredThread(t *testing.T) {
+	dh := newTestHandler(t, "support@example.com")
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		senders []string
+		closed  bool // closed before
+		want    bool
+	}{
+		{"answered", []string{"customer@example.com", "support@example.com"}, false, true},
+		{"unanswered", []string{"customer@example.com"}, false, false},
+		{"already_closed", []string{"customer@example.com", "support@example.com"}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			threadId, _ := addTestThread(t, dh, tt.name, tt.senders...)
+			if tt.closed {
+				if _, err := dh.pool.Exec(ctx, "UPDATE thread SET enabled = FALSE WHERE id = $1", threadId); err != nil {
+					t.Fatalf("Failed to close thread: %v", err)
+				}
+			}
+			if got := dh.CloseAnsweredThread(ctx, threadId); got != tt.want {
+				t.Errorf("CloseAnsweredThread() = %v, want %v", got, tt.want)
+			}
+			enabled, _, closed := getTestThread(t, dh, threadId)
+			if wantEnabled := !tt.closed && !tt.want; enabled != wantEnabled || closed != tt.want {
+				t.Errorf("enabled = %v, closed = %v, want %v, %v", enabled, closed, wantEnabled, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetThreadReaders(t *testing.T) {
+	dh := newTestHandler(t)
+	ctx := context.Background()
+	threadId, mails := addTestThread(t, dh, "readers", "customer@example.com") // sent long before being posted
+	dh.UpdateMailMatrixId(ctx, mails[0].ID, "$mail")
+	now := time.Now().UTC()
+	dh.UpdateThreadReader(ctx, threadId, "@early:example.com", now.Add(-time.Hour))
+	dh.UpdateThreadReader(ctx, threadId, "@late:example.com", now.Add(time.Minute))
+
+	got := map[string]bool{}
+	for _, reader := range dh.GetThreadReaders(ctx, threadId) {
+		got[reader.Reader] = reader.SeenLatest
+	}
+	if len(got) != 2 || got["@early:example.com"] || !got["@late:example.com"] {
+		t.Errorf("GetThreadReaders() seen latest = %v, want only @late:example.com", got)
+	}
+}
+
+func TestSplitThread(t *testing.T) {
+	dh := newTestHandler(t, "support@example.com")
+	ctx := context.Background()
+	senders := []string{"customer@example.com", "support@example.com", "other@example.com", "support@example.com"}
+	tests := []struct {
+		name         string
+		split        int // index of the mail to split off
+		includeLater bool
+		wantOld      []int
+		wantNew      []int
+	}{
+		{"single", 2, false, []int{0, 1, 3}, []int{2}},
+		{"include_later", 2, true, []int{0, 1}, []int{2, 3}},
+		{"last", 3, true, []int{0, 1, 2}, []int{3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, mails := addTestThread(t, dh, tt.name, senders...)
+			for _, mail := range mails {
+				dh.UpdateMailMatrixId(ctx, mail.ID, fmt.Sprintf("$%d", mail.ID))
+			}
+			target, ok := dh.SplitThread(ctx, source, mails[tt.split].ID, tt.includeLater, "")
+			if !ok {
+				t.Fatalf("SplitThread() failed")
+			}
+			check := func(threadId int64, want []int) {
+				got := dh.GetMailsByThread(ctx, threadId)
+				if len(got) != len(want) {
+					t.Fatalf("thread %v has %v mails, want %v", threadId, len(got), len(want))
+				}
+				for i, mail := range got {
+					if mail.ID != mails[want[i]].ID {
+						t.Errorf("mail %v of thread %v = %v, want %v", i, threadId, mail.ID, mails[want[i]].ID)
+					}
+					if threadId == target && mail.MatrixID.Valid { // to be posted in the new thread
+						t.Errorf("matrix id of split mail %v = %v, want none", mail.ID, mail.MatrixID.String)
+					}
+				}
+				var lastMail int64
+				err := dh.pool.QueryRow(ctx, "SELECT last_mail FROM thread WHERE id = $1", threadId).Scan(&lastMail)
+				if err != nil || lastMail != mails[want[len(want)-1]].ID {
+					t.Errorf("last mail of thread %v = %v, want %v (%v)", threadId, lastMail, mails[want[len(want)-1]].ID, err)
+				}
+				_, answered, _ := getTestThread(t, dh, threadId)
+				if wantAnswered := senders[want[len(want)-1]] == "support@example.com"; answered != wantAnswered {
+					t.Errorf("answered of thread %v = %v, want %v", threadId, answered, wantAnswered)
+				}
+			}
+			check(source, tt.wantOld)
+			check(target, tt.wantNew)
+		})
+	}
+}
+
+func TestMergeThreads(t *testing.T) {
+	dh := newTestHandler(t)
+	ctx := context.Background()
+	source, sourceMails := addTestThread(t, dh, "source", "customer@example.com", "customer@example.com")
+	target, targetMails := addTestThread(t, dh, "target", "customer@example.com")
+	// the target thread has been started after the source thread
+	later := targetMails[0].Timestamp.Time.Add(24 * time.Hour)
+	if _, err := dh.pool.Exec(ctx, "UPDATE mail SET timestamp = $2 WHERE id = $1", targetMails[0].ID, later); err != nil {
+		t.Fatalf("Failed to update mail: %v", err)
+	}
+	_, err := dh.pool.Exec(ctx,
+		`INSERT INTO attachment (mail, filename, content_type, matrix_id, matrix_mail_id, matrix_room_id)
+		VALUES ($1, 'invoice.pdf', 'application/pdf', '$file', '$mail', '!room:example.com')`, sourceMails[1].ID,
+	)
+	if err != nil {
+		t.Fatalf("Failed to add attachment: %v", err)
+	}
+
+	if !dh.MergeThreads(ctx, source, target) {
+		t.Fatalf("MergeThreads() failed")
+	}
+	var firstMail, lastMail int64
+	err = dh.pool.QueryRow(ctx, "SELECT first_mail, last_mail FROM thread WHERE id = $1", target).Scan(&firstMail, &lastMail)
+	if err != nil {
+		t.Fatalf("Failed to get thread %v: %v", target, err)
+	}
+	if firstMail != sourceMails[0].ID || lastMail != targetMails[0].ID {
+		t.Errorf("first and last mail = %v, %v, want %v, %v", firstMail, lastMail, sourceMails[0].ID, targetMails[0].ID)
+	}
+
+	// the uploaded attachment is reposted once its mail has been posted in the merged thread
+	if err = dh.queries.AddRoom(ctx, "!room:example.com"); err != nil {
+		t.Fatalf("Failed to add room: %v", err)
+	}
+	dh.UpdateThreadMatrixIds(ctx, target, "!room:example.com", "$target")
+	dh.UpdateMailMatrixId(ctx, sourceMails[1].ID, "$moved")
+	attachments := dh.GetMatrixReadyAttachments(ctx, 3)
+	if len(attachments) != 1 || attachments[0].MailMessageID.String != "$moved" || attachments[0].MatrixID.String != "$file" {
+		t.Errorf("GetMatrixReadyAttachments() = %v, want the uploaded attachment of the moved mail", attachments)
+	}
+}
+
+func TestReopenSnoozedThreads(t *testing.T) {
+	dh := newTestHandler(t)
+	ctx := context.Background()
+	if err := dh.queries.AddRoom(ctx, "!room:example.com"); err != nil {
+		t.Fatalf("Failed to add room: %v", err)
+	}
+	tests := []struct {
+		name       string
+		forceClose bool
+		wantSnooze bool
+	}{
+		{"closed", false, true},
+		{"force_closed", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			threadId, _ := addTestThread(t, dh, tt.name, "customer@example.com")
+			matrixId := "$" + tt.name
+			dh.UpdateThreadMatrixIds(ctx, threadId, "!room:example.com", matrixId)
+			dh.UpdateThreadEnabled(ctx, "!room:example.com", matrixId, false, tt.forceClose)
+			if got := dh.UpdateThreadSnooze(ctx, "!room:example.com", matrixId, time.Now().Add(-time.Minute)); got != tt.wantSnooze {
+				t.Errorf("UpdateThreadSnooze() = %v, want %v", got, tt.wantSnooze)
+			}
+			// snoozed before being force closed
+			_, err := dh.pool.Exec(ctx, "UPDATE thread SET snoozed_until = $2 WHERE id = $1", threadId, time.Now().Add(-time.Minute))
+			if err != nil {
+				t.Fatalf("Failed to snooze thread: %v", err)
+			}
+			reopened := false
+			for _, thread := range dh.ReopenSnoozedThreads(ctx) {
+				reopened = reopened || thread.ID == threadId
+			}
+			if enabled, _, _ := getTestThread(t, dh, threadId); reopened != !tt.forceClose || enabled != !tt.forceClose {
+				t.Errorf("reopened = %v, enabled = %v, want %v", reopened, enabled, !tt.forceClose)
+			}
+		})
+	}
+}
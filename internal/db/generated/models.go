@@ -9,6 +9,36 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type Attachment struct {
+	ID             int64
+	Mail           int64
+	Filename       string
+	ContentType    string
+	Content        []byte
+	Inline         bool
+	MatrixID       pgtype.Text
+	MatrixMailID   pgtype.Text
+	MatrixRoomID   pgtype.Text
+	UploadFailures int32
+}
+
+type Draft struct {
+	ID        int64
+	CommandID string
+	PreviewID pgtype.Text
+	RoomID    string
+	ThreadID  string
+	ReplyToID string
+	Author    string
+	Body      string
+	Cite      bool
+	ReplyAll  bool
+	ForwardTo pgtype.Text
+	Files     []string
+	SendAt    pgtype.Timestamp
+	Created   pgtype.Timestamp
+}
+
 type Fetcher struct {
 	ID          string
 	UidLast     int32
@@ -25,8 +55,12 @@ type Mail struct {
 	NameFrom           string
 	AddrFrom           string
 	AddrTo             []string
+	AddrCc             []string
+	AddrReplyTo        []string
 	Subject            string
 	Body               *string
+	BodyHtml           string
+	HtmlOnly           bool
 	Attachments        []string
 	Messages           *db.ExtractedMessages
 	MessagesLastUpdate pgtype.Timestamp
@@ -34,14 +68,41 @@ type Mail struct {
 	ReplyTo            pgtype.Int8
 	Thread             pgtype.Int8
 	MatrixID           pgtype.Text
+	MatrixPosted       pgtype.Timestamp
+	Forwarded          bool
+}
+
+type Note struct {
+	ID        int64
+	Thread    int64
+	Author    string
+	Timestamp pgtype.Timestamp
+	Body      string
+	MatrixID  pgtype.Text
+}
+
+type Outbox struct {
+	ID        int64
+	CommandID string
+	RoomID    string
+	ThreadID  string
+	ReplyToID string
+	Author    string
+	Body      string
+	Cite      bool
+	ReplyAll  bool
+	Files     []string
+	SendAt    pgtype.Timestamp
+	Created   pgtype.Timestamp
 }
 
 type Room struct {
 	ID                        string
 	Name                      pgtype.Text
 	NameLastUpdate            pgtype.Timestamp
-	OverviewMessageID         pgtype.Text
 	OverviewMessageLastUpdate pgtype.Timestamp
+	DigestLast                pgtype.Timestamp
+	OverviewMessageIds        []string
 }
 
 type Thread struct {
@@ -51,6 +112,23 @@ type Thread struct {
 	LastMessage  pgtype.Timestamp
 	MatrixID     pgtype.Text
 	MatrixRoomID pgtype.Text
+	Assignee     pgtype.Text
+	SnoozedUntil pgtype.Timestamp
+	Created      pgtype.Timestamp
+	Closed       pgtype.Timestamp
 	FirstMail    pgtype.Int8
 	LastMail     pgtype.Int8
+	RemindedMail pgtype.Int8
+	Answered     bool
+}
+
+type ThreadLabel struct {
+	Thread int64
+	Label  string
+}
+
+type ThreadReader struct {
+	Thread int64
+	Reader string
+	Seen   pgtype.Timestamp
 }
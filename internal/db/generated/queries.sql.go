@@ -12,6 +12,41 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const addAttachment = `-- name: AddAttachment :exec
+INSERT INTO attachment (mail, filename, content_type, content, inline)
+VALUES ($1, $2, $3, $4, $5)
+`
+
+type AddAttachmentParams struct {
+	Mail        int64
+	Filename    string
+	ContentType string
+	Content     []byte
+	Inline      bool
+}
+
+func (q *Queries) AddAttachment(ctx context.Context, arg AddAttachmentParams) error {
+	_, err := q.db.Exec(ctx, addAttachment,
+		arg.Mail,
+		arg.Filename,
+		arg.ContentType,
+		arg.Content,
+		arg.Inline,
+	)
+	return err
+}
+
+const addAttachmentUploadFailure = `-- name: AddAttachmentUploadFailure :exec
+UPDATE attachment
+SET upload_failures = upload_failures + 1
+WHERE id = $1
+`
+
+func (q *Queries) AddAttachmentUploadFailure(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, addAttachmentUploadFailure, id)
+	return err
+}
+
 const addFetcher = `-- name: AddFetcher :exec
 INSERT INTO fetcher (id)
 VALUES ($1)
@@ -23,10 +58,10 @@ func (q *Queries) AddFetcher(ctx context.Context, id string) error {
 }
 
 const addMail = `-- name: AddMail :many
-INSERT INTO mail (fetcher, header_id, header_in_reply_to, header_references, timestamp, name_from, addr_from, addr_to, subject, body, attachments)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+INSERT INTO mail (fetcher, header_id, header_in_reply_to, header_references, timestamp, name_from, addr_from, addr_to, addr_cc, addr_reply_to, subject, body, body_html, html_only, attachments, forwarded)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
 ON CONFLICT (header_id) DO NOTHING
-RETURNING id, fetcher, header_id, header_in_reply_to, header_references, timestamp, name_from, addr_from, addr_to, subject, body, attachments, messages, messages_last_update, sorted, reply_to, thread, matrix_id
+RETURNING id, fetcher, header_id, header_in_reply_to, header_references, timestamp, name_from, addr_from, addr_to, addr_cc, addr_reply_to, subject, body, body_html, html_only, attachments, messages, messages_last_update, sorted, reply_to, thread, matrix_id, matrix_posted, forwarded
 `
 
 type AddMailParams struct {
@@ -38,9 +73,14 @@ type AddMailParams struct {
 	NameFrom         string
 	AddrFrom         string
 	AddrTo           []string
+	AddrCc           []string
+	AddrReplyTo      []string
 	Subject          string
 	Body             *string
+	BodyHtml         string
+	HtmlOnly         bool
 	Attachments      []string
+	Forwarded        bool
 }
 
 func (q *Queries) AddMail(ctx context.Context, arg AddMailParams) ([]*Mail, error) {
@@ -53,9 +93,14 @@ func (q *Queries) AddMail(ctx context.Context, arg AddMailParams) ([]*Mail, erro
 		arg.NameFrom,
 		arg.AddrFrom,
 		arg.AddrTo,
+		arg.AddrCc,
+		arg.AddrReplyTo,
 		arg.Subject,
 		arg.Body,
+		arg.BodyHtml,
+		arg.HtmlOnly,
 		arg.Attachments,
+		arg.Forwarded,
 	)
 	if err != nil {
 		return nil, err
@@ -74,8 +119,12 @@ func (q *Queries) AddMail(ctx context.Context, arg AddMailParams) ([]*Mail, erro
 			&i.NameFrom,
 			&i.AddrFrom,
 			&i.AddrTo,
+			&i.AddrCc,
+			&i.AddrReplyTo,
 			&i.Subject,
 			&i.Body,
+			&i.BodyHtml,
+			&i.HtmlOnly,
 			&i.Attachments,
 			&i.Messages,
 			&i.MessagesLastUpdate,
@@ -83,6 +132,8 @@ func (q *Queries) AddMail(ctx context.Context, arg AddMailParams) ([]*Mail, erro
 			&i.ReplyTo,
 			&i.Thread,
 			&i.MatrixID,
+			&i.MatrixPosted,
+			&i.Forwarded,
 		); err != nil {
 			return nil, err
 		}
@@ -94,6 +145,28 @@ func (q *Queries) AddMail(ctx context.Context, arg AddMailParams) ([]*Mail, erro
 	return items, nil
 }
 
+const addNote = `-- name: AddNote :exec
+INSERT INTO note (thread, author, timestamp, body)
+VALUES ($1, $2, $3, $4)
+`
+
+type AddNoteParams struct {
+	Thread    int64
+	Author    string
+	Timestamp pgtype.Timestamp
+	Body      string
+}
+
+func (q *Queries) AddNote(ctx context.Context, arg AddNoteParams) error {
+	_, err := q.db.Exec(ctx, addNote,
+		arg.Thread,
+		arg.Author,
+		arg.Timestamp,
+		arg.Body,
+	)
+	return err
+}
+
 const addRoom = `-- name: AddRoom :exec
 INSERT INTO room (id)
 VALUES ($1)
@@ -108,7 +181,7 @@ func (q *Queries) AddRoom(ctx context.Context, id string) error {
 const addThread = `-- name: AddThread :one
 INSERT INTO thread (last_message, first_mail, last_mail)
 VALUES (CURRENT_TIMESTAMP, $1, $1)
-RETURNING id, enabled, force_close, last_message, matrix_id, matrix_room_id, first_mail, last_mail
+RETURNING id, enabled, force_close, last_message, matrix_id, matrix_room_id, assignee, snoozed_until, created, closed, first_mail, last_mail, reminded_mail, answered
 `
 
 func (q *Queries) AddThread(ctx context.Context, firstMail pgtype.Int8) (*Thread, error) {
@@ -121,12 +194,54 @@ func (q *Queries) AddThread(ctx context.Context, firstMail pgtype.Int8) (*Thread
 		&i.LastMessage,
 		&i.MatrixID,
 		&i.MatrixRoomID,
+		&i.Assignee,
+		&i.SnoozedUntil,
+		&i.Created,
+		&i.Closed,
 		&i.FirstMail,
 		&i.LastMail,
+		&i.RemindedMail,
+		&i.Answered,
 	)
 	return &i, err
 }
 
+const addThreadLabels = `-- name: AddThreadLabels :exec
+INSERT INTO thread_label (thread, label)
+SELECT $1, unnest($2::text[])
+ON CONFLICT DO NOTHING
+`
+
+type AddThreadLabelsParams struct {
+	Thread int64
+	Labels []string
+}
+
+func (q *Queries) AddThreadLabels(ctx context.Context, arg AddThreadLabelsParams) error {
+	_, err := q.db.Exec(ctx, addThreadLabels, arg.Thread, arg.Labels)
+	return err
+}
+
+const addThreadReader = `-- name: AddThreadReader :execrows
+INSERT INTO thread_reader (thread, reader, seen)
+VALUES ($1, $2, $3)
+ON CONFLICT (thread, reader) DO NOTHING
+`
+
+type AddThreadReaderParams struct {
+	Thread int64
+	Reader string
+	Seen   pgtype.Timestamp
+}
+
+func (q *Queries) AddThreadReader(ctx context.Context, arg AddThreadReaderParams) (int64, error) {
+	result, err := q.db.Exec(ctx, addThreadReader, arg.Thread, arg.Reader, arg.Seen)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const autoUpdateMailReplyTo = `-- name: AutoUpdateMailReplyTo :execrows
 UPDATE mail
 SET reply_to = m.id
@@ -142,6 +257,293 @@ func (q *Queries) AutoUpdateMailReplyTo(ctx context.Context) (int64, error) {
 	return result.RowsAffected(), nil
 }
 
+const closeAnsweredThread = `-- name: CloseAnsweredThread :execrows
+UPDATE thread
+SET enabled = FALSE, snoozed_until = NULL, closed = (now() AT TIME ZONE 'utc')
+WHERE id = $1 AND enabled AND answered
+`
+
+func (q *Queries) CloseAnsweredThread(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.Exec(ctx, closeAnsweredThread, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteDraft = `-- name: DeleteDraft :execrows
+DELETE FROM draft
+WHERE id = $1
+`
+
+func (q *Queries) DeleteDraft(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteDraft, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteOutboxMail = `-- name: DeleteOutboxMail :execrows
+DELETE FROM outbox
+WHERE id = $1
+`
+
+func (q *Queries) DeleteOutboxMail(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteOutboxMail, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteOutboxMailByCommand = `-- name: DeleteOutboxMailByCommand :many
+DELETE FROM outbox
+WHERE room_id = $1 AND command_id = $2
+RETURNING id, command_id, room_id, thread_id, reply_to_id, author, body, cite, reply_all, files, send_at, created
+`
+
+type DeleteOutboxMailByCommandParams struct {
+	RoomID    string
+	CommandID string
+}
+
+func (q *Queries) DeleteOutboxMailByCommand(ctx context.Context, arg DeleteOutboxMailByCommandParams) ([]*Outbox, error) {
+	rows, err := q.db.Query(ctx, deleteOutboxMailByCommand, arg.RoomID, arg.CommandID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*Outbox
+	for rows.Next() {
+		var i Outbox
+		if err := rows.Scan(
+			&i.ID,
+			&i.CommandID,
+			&i.RoomID,
+			&i.ThreadID,
+			&i.ReplyToID,
+			&i.Author,
+			&i.Body,
+			&i.Cite,
+			&i.ReplyAll,
+			&i.Files,
+			&i.SendAt,
+			&i.Created,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const deleteThread = `-- name: DeleteThread :exec
+DELETE FROM thread
+WHERE id = $1
+`
+
+func (q *Queries) DeleteThread(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, deleteThread, id)
+	return err
+}
+
+const getAttachmentsByMail = `-- name: GetAttachmentsByMail :many
+SELECT id, mail, filename, content_type, content, inline, matrix_id, matrix_mail_id, matrix_room_id, upload_failures FROM attachment
+WHERE mail = $1
+ORDER BY id
+`
+
+func (q *Queries) GetAttachmentsByMail(ctx context.Context, mail int64) ([]*Attachment, error) {
+	rows, err := q.db.Query(ctx, getAttachmentsByMail, mail)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*Attachment
+	for rows.Next() {
+		var i Attachment
+		if err := rows.Scan(
+			&i.ID,
+			&i.Mail,
+			&i.Filename,
+			&i.ContentType,
+			&i.Content,
+			&i.Inline,
+			&i.MatrixID,
+			&i.MatrixMailID,
+			&i.MatrixRoomID,
+			&i.UploadFailures,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDigestThreads = `-- name: GetDigestThreads :many
+SELECT thread.id, thread.enabled, thread.force_close, thread.last_message, thread.matrix_id, thread.matrix_room_id, thread.assignee, thread.snoozed_until, thread.created, thread.closed, thread.first_mail, thread.last_mail, thread.reminded_mail, thread.answered, first_mail.name_from, first_mail.addr_from, first_mail.subject,
+first_mail.timestamp AS first_timestamp, last_mail.timestamp AS last_timestamp,
+COALESCE(latest_note.author, '')::text AS note_author, COALESCE(latest_note.body, '')::text AS note_body
+FROM thread
+JOIN mail first_mail ON first_mail.id = thread.first_mail
+JOIN mail last_mail ON last_mail.id = thread.last_mail
+LEFT JOIN LATERAL (
+    SELECT note.author, note.body FROM note WHERE note.thread = thread.id ORDER BY note.timestamp DESC LIMIT 1
+) latest_note ON TRUE
+WHERE thread.matrix_room_id = ANY($1::text[]) AND thread.matrix_id IS NOT NULL
+AND (thread.enabled OR thread.closed > $2)
+AND (cardinality($3::text[]) = 0 OR EXISTS (
+    SELECT 1 FROM thread_label WHERE thread_label.thread = thread.id AND thread_label.label = ANY($3::text[])
+))
+ORDER BY first_mail.timestamp
+`
+
+type GetDigestThreadsParams struct {
+	Targets []string
+	Since   pgtype.Timestamp
+	Tags    []string
+}
+
+type GetDigestThreadsRow struct {
+	ID             int64
+	Enabled        bool
+	ForceClose     pgtype.Bool
+	LastMessage    pgtype.Timestamp
+	MatrixID       pgtype.Text
+	MatrixRoomID   pgtype.Text
+	Assignee       pgtype.Text
+	SnoozedUntil   pgtype.Timestamp
+	Created        pgtype.Timestamp
+	Closed         pgtype.Timestamp
+	FirstMail      pgtype.Int8
+	LastMail       pgtype.Int8
+	RemindedMail   pgtype.Int8
+	Answered       bool
+	NameFrom       string
+	AddrFrom       string
+	Subject        string
+	FirstTimestamp pgtype.Timestamp
+	LastTimestamp  pgtype.Timestamp
+	NoteAuthor     string
+	NoteBody       string
+}
+
+func (q *Queries) GetDigestThreads(ctx context.Context, arg GetDigestThreadsParams) ([]*GetDigestThreadsRow, error) {
+	rows, err := q.db.Query(ctx, getDigestThreads, arg.Targets, arg.Since, arg.Tags)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*GetDigestThreadsRow
+	for rows.Next() {
+		var i GetDigestThreadsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Enabled,
+			&i.ForceClose,
+			&i.LastMessage,
+			&i.MatrixID,
+			&i.MatrixRoomID,
+			&i.Assignee,
+			&i.SnoozedUntil,
+			&i.Created,
+			&i.Closed,
+			&i.FirstMail,
+			&i.LastMail,
+			&i.RemindedMail,
+			&i.Answered,
+			&i.NameFrom,
+			&i.AddrFrom,
+			&i.Subject,
+			&i.FirstTimestamp,
+			&i.LastTimestamp,
+			&i.NoteAuthor,
+			&i.NoteBody,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDraftByMatrixId = `-- name: GetDraftByMatrixId :one
+SELECT id, command_id, preview_id, room_id, thread_id, reply_to_id, author, body, cite, reply_all, forward_to, files, send_at, created FROM draft
+WHERE command_id = $1 OR preview_id = $1 LIMIT 1
+`
+
+func (q *Queries) GetDraftByMatrixId(ctx context.Context, commandID string) (*Draft, error) {
+	row := q.db.QueryRow(ctx, getDraftByMatrixId, commandID)
+	var i Draft
+	err := row.Scan(
+		&i.ID,
+		&i.CommandID,
+		&i.PreviewID,
+		&i.RoomID,
+		&i.ThreadID,
+		&i.ReplyToID,
+		&i.Author,
+		&i.Body,
+		&i.Cite,
+		&i.ReplyAll,
+		&i.ForwardTo,
+		&i.Files,
+		&i.SendAt,
+		&i.Created,
+	)
+	return &i, err
+}
+
+const getDueOutboxMails = `-- name: GetDueOutboxMails :many
+SELECT id, command_id, room_id, thread_id, reply_to_id, author, body, cite, reply_all, files, send_at, created FROM outbox
+WHERE send_at <= $1
+ORDER BY send_at
+`
+
+func (q *Queries) GetDueOutboxMails(ctx context.Context, sendAt pgtype.Timestamp) ([]*Outbox, error) {
+	rows, err := q.db.Query(ctx, getDueOutboxMails, sendAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*Outbox
+	for rows.Next() {
+		var i Outbox
+		if err := rows.Scan(
+			&i.ID,
+			&i.CommandID,
+			&i.RoomID,
+			&i.ThreadID,
+			&i.ReplyToID,
+			&i.Author,
+			&i.Body,
+			&i.Cite,
+			&i.ReplyAll,
+			&i.Files,
+			&i.SendAt,
+			&i.Created,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getFetcherState = `-- name: GetFetcherState :many
 SELECT id, uid_last, uid_validity FROM fetcher
 WHERE id = $1 LIMIT 1
@@ -168,7 +570,7 @@ func (q *Queries) GetFetcherState(ctx context.Context, id string) ([]*Fetcher, e
 }
 
 const getMail = `-- name: GetMail :one
-SELECT mail.id, fetcher, header_id, header_in_reply_to, header_references, timestamp, name_from, addr_from, addr_to, subject, body, attachments, messages, messages_last_update, sorted, reply_to, thread, mail.matrix_id, thread.id, enabled, force_close, last_message, thread.matrix_id, matrix_room_id, first_mail, last_mail FROM mail
+SELECT mail.id, fetcher, header_id, header_in_reply_to, header_references, timestamp, name_from, addr_from, addr_to, addr_cc, addr_reply_to, subject, body, body_html, html_only, attachments, messages, messages_last_update, sorted, reply_to, thread, mail.matrix_id, matrix_posted, forwarded, thread.id, enabled, force_close, last_message, thread.matrix_id, matrix_room_id, assignee, snoozed_until, created, closed, first_mail, last_mail, reminded_mail, answered FROM mail
 LEFT JOIN thread ON thread.id = mail.thread
 WHERE mail.id = $1 LIMIT 1
 `
@@ -183,8 +585,12 @@ type GetMailRow struct {
 	NameFrom           string
 	AddrFrom           string
 	AddrTo             []string
+	AddrCc             []string
+	AddrReplyTo        []string
 	Subject            string
 	Body               *string
+	BodyHtml           string
+	HtmlOnly           bool
 	Attachments        []string
 	Messages           *db.ExtractedMessages
 	MessagesLastUpdate pgtype.Timestamp
@@ -192,14 +598,22 @@ type GetMailRow struct {
 	ReplyTo            pgtype.Int8
 	Thread             pgtype.Int8
 	MatrixID           pgtype.Text
+	MatrixPosted       pgtype.Timestamp
+	Forwarded          bool
 	ID_2               pgtype.Int8
 	Enabled            pgtype.Bool
 	ForceClose         pgtype.Bool
 	LastMessage        pgtype.Timestamp
 	MatrixID_2         pgtype.Text
 	MatrixRoomID       pgtype.Text
+	Assignee           pgtype.Text
+	SnoozedUntil       pgtype.Timestamp
+	Created            pgtype.Timestamp
+	Closed             pgtype.Timestamp
 	FirstMail          pgtype.Int8
 	LastMail           pgtype.Int8
+	RemindedMail       pgtype.Int8
+	Answered           pgtype.Bool
 }
 
 func (q *Queries) GetMail(ctx context.Context, id int64) (*GetMailRow, error) {
@@ -215,8 +629,12 @@ func (q *Queries) GetMail(ctx context.Context, id int64) (*GetMailRow, error) {
 		&i.NameFrom,
 		&i.AddrFrom,
 		&i.AddrTo,
+		&i.AddrCc,
+		&i.AddrReplyTo,
 		&i.Subject,
 		&i.Body,
+		&i.BodyHtml,
+		&i.HtmlOnly,
 		&i.Attachments,
 		&i.Messages,
 		&i.MessagesLastUpdate,
@@ -224,20 +642,28 @@ func (q *Queries) GetMail(ctx context.Context, id int64) (*GetMailRow, error) {
 		&i.ReplyTo,
 		&i.Thread,
 		&i.MatrixID,
+		&i.MatrixPosted,
+		&i.Forwarded,
 		&i.ID_2,
 		&i.Enabled,
 		&i.ForceClose,
 		&i.LastMessage,
 		&i.MatrixID_2,
 		&i.MatrixRoomID,
+		&i.Assignee,
+		&i.SnoozedUntil,
+		&i.Created,
+		&i.Closed,
 		&i.FirstMail,
 		&i.LastMail,
+		&i.RemindedMail,
+		&i.Answered,
 	)
 	return &i, err
 }
 
 const getMailByMatrixId = `-- name: GetMailByMatrixId :one
-SELECT id, fetcher, header_id, header_in_reply_to, header_references, timestamp, name_from, addr_from, addr_to, subject, body, attachments, messages, messages_last_update, sorted, reply_to, thread, matrix_id FROM mail
+SELECT id, fetcher, header_id, header_in_reply_to, header_references, timestamp, name_from, addr_from, addr_to, addr_cc, addr_reply_to, subject, body, body_html, html_only, attachments, messages, messages_last_update, sorted, reply_to, thread, matrix_id, matrix_posted, forwarded FROM mail
 WHERE matrix_id = $1 LIMIT 1
 `
 
@@ -254,8 +680,12 @@ func (q *Queries) GetMailByMatrixId(ctx context.Context, matrixID pgtype.Text) (
 		&i.NameFrom,
 		&i.AddrFrom,
 		&i.AddrTo,
+		&i.AddrCc,
+		&i.AddrReplyTo,
 		&i.Subject,
 		&i.Body,
+		&i.BodyHtml,
+		&i.HtmlOnly,
 		&i.Attachments,
 		&i.Messages,
 		&i.MessagesLastUpdate,
@@ -263,12 +693,14 @@ func (q *Queries) GetMailByMatrixId(ctx context.Context, matrixID pgtype.Text) (
 		&i.ReplyTo,
 		&i.Thread,
 		&i.MatrixID,
+		&i.MatrixPosted,
+		&i.Forwarded,
 	)
 	return &i, err
 }
 
 const getMailsByMessageIds = `-- name: GetMailsByMessageIds :many
-SELECT id, fetcher, header_id, header_in_reply_to, header_references, timestamp, name_from, addr_from, addr_to, subject, body, attachments, messages, messages_last_update, sorted, reply_to, thread, matrix_id FROM mail
+SELECT id, fetcher, header_id, header_in_reply_to, header_references, timestamp, name_from, addr_from, addr_to, addr_cc, addr_reply_to, subject, body, body_html, html_only, attachments, messages, messages_last_update, sorted, reply_to, thread, matrix_id, matrix_posted, forwarded FROM mail
 WHERE header_id = ANY($1::text[])
 ORDER BY timestamp
 `
@@ -292,8 +724,12 @@ func (q *Queries) GetMailsByMessageIds(ctx context.Context, dollar_1 []string) (
 			&i.NameFrom,
 			&i.AddrFrom,
 			&i.AddrTo,
+			&i.AddrCc,
+			&i.AddrReplyTo,
 			&i.Subject,
 			&i.Body,
+			&i.BodyHtml,
+			&i.HtmlOnly,
 			&i.Attachments,
 			&i.Messages,
 			&i.MessagesLastUpdate,
@@ -301,6 +737,8 @@ func (q *Queries) GetMailsByMessageIds(ctx context.Context, dollar_1 []string) (
 			&i.ReplyTo,
 			&i.Thread,
 			&i.MatrixID,
+			&i.MatrixPosted,
+			&i.Forwarded,
 		); err != nil {
 			return nil, err
 		}
@@ -313,7 +751,7 @@ func (q *Queries) GetMailsByMessageIds(ctx context.Context, dollar_1 []string) (
 }
 
 const getMailsByThread = `-- name: GetMailsByThread :many
-SELECT id, fetcher, header_id, header_in_reply_to, header_references, timestamp, name_from, addr_from, addr_to, subject, body, attachments, messages, messages_last_update, sorted, reply_to, thread, matrix_id FROM mail
+SELECT id, fetcher, header_id, header_in_reply_to, header_references, timestamp, name_from, addr_from, addr_to, addr_cc, addr_reply_to, subject, body, body_html, html_only, attachments, messages, messages_last_update, sorted, reply_to, thread, matrix_id, matrix_posted, forwarded FROM mail
 WHERE thread = $1
 ORDER BY timestamp
 `
@@ -337,8 +775,12 @@ func (q *Queries) GetMailsByThread(ctx context.Context, thread pgtype.Int8) ([]*
 			&i.NameFrom,
 			&i.AddrFrom,
 			&i.AddrTo,
+			&i.AddrCc,
+			&i.AddrReplyTo,
 			&i.Subject,
 			&i.Body,
+			&i.BodyHtml,
+			&i.HtmlOnly,
 			&i.Attachments,
 			&i.Messages,
 			&i.MessagesLastUpdate,
@@ -346,6 +788,8 @@ func (q *Queries) GetMailsByThread(ctx context.Context, thread pgtype.Int8) ([]*
 			&i.ReplyTo,
 			&i.Thread,
 			&i.MatrixID,
+			&i.MatrixPosted,
+			&i.Forwarded,
 		); err != nil {
 			return nil, err
 		}
@@ -358,7 +802,7 @@ func (q *Queries) GetMailsByThread(ctx context.Context, thread pgtype.Int8) ([]*
 }
 
 const getMailsRequiringMessageExtraction = `-- name: GetMailsRequiringMessageExtraction :many
-SELECT id, fetcher, header_id, header_in_reply_to, header_references, timestamp, name_from, addr_from, addr_to, subject, body, attachments, messages, messages_last_update, sorted, reply_to, thread, matrix_id FROM mail
+SELECT id, fetcher, header_id, header_in_reply_to, header_references, timestamp, name_from, addr_from, addr_to, addr_cc, addr_reply_to, subject, body, body_html, html_only, attachments, messages, messages_last_update, sorted, reply_to, thread, matrix_id, matrix_posted, forwarded FROM mail
 WHERE sorted AND fetcher IS NOT NULL AND messages ->> 'messages' IS NULL
 ORDER BY thread, timestamp
 `
@@ -382,8 +826,12 @@ func (q *Queries) GetMailsRequiringMessageExtraction(ctx context.Context) ([]*Ma
 			&i.NameFrom,
 			&i.AddrFrom,
 			&i.AddrTo,
+			&i.AddrCc,
+			&i.AddrReplyTo,
 			&i.Subject,
 			&i.Body,
+			&i.BodyHtml,
+			&i.HtmlOnly,
 			&i.Attachments,
 			&i.Messages,
 			&i.MessagesLastUpdate,
@@ -391,6 +839,8 @@ func (q *Queries) GetMailsRequiringMessageExtraction(ctx context.Context) ([]*Ma
 			&i.ReplyTo,
 			&i.Thread,
 			&i.MatrixID,
+			&i.MatrixPosted,
+			&i.Forwarded,
 		); err != nil {
 			return nil, err
 		}
@@ -403,7 +853,7 @@ func (q *Queries) GetMailsRequiringMessageExtraction(ctx context.Context) ([]*Ma
 }
 
 const getMailsRequiringSorting = `-- name: GetMailsRequiringSorting :many
-SELECT id, fetcher, header_id, header_in_reply_to, header_references, timestamp, name_from, addr_from, addr_to, subject, body, attachments, messages, messages_last_update, sorted, reply_to, thread, matrix_id FROM mail
+SELECT id, fetcher, header_id, header_in_reply_to, header_references, timestamp, name_from, addr_from, addr_to, addr_cc, addr_reply_to, subject, body, body_html, html_only, attachments, messages, messages_last_update, sorted, reply_to, thread, matrix_id, matrix_posted, forwarded FROM mail
 WHERE NOT sorted
 ORDER BY timestamp
 `
@@ -427,8 +877,12 @@ func (q *Queries) GetMailsRequiringSorting(ctx context.Context) ([]*Mail, error)
 			&i.NameFrom,
 			&i.AddrFrom,
 			&i.AddrTo,
+			&i.AddrCc,
+			&i.AddrReplyTo,
 			&i.Subject,
 			&i.Body,
+			&i.BodyHtml,
+			&i.HtmlOnly,
 			&i.Attachments,
 			&i.Messages,
 			&i.MessagesLastUpdate,
@@ -436,6 +890,71 @@ func (q *Queries) GetMailsRequiringSorting(ctx context.Context) ([]*Mail, error)
 			&i.ReplyTo,
 			&i.Thread,
 			&i.MatrixID,
+			&i.MatrixPosted,
+			&i.Forwarded,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMatrixReadyAttachments = `-- name: GetMatrixReadyAttachments :many
+SELECT attachment.id, attachment.mail, attachment.filename, attachment.content_type, attachment.content, attachment.inline, attachment.matrix_id, attachment.matrix_mail_id, attachment.matrix_room_id, attachment.upload_failures, mail.matrix_id AS mail_message_id,
+thread.matrix_id AS root_matrix_id, thread.matrix_room_id AS root_matrix_room_id
+FROM attachment
+JOIN mail ON attachment.mail = mail.id
+JOIN thread ON mail.thread = thread.id
+WHERE mail.matrix_id IS NOT NULL AND thread.matrix_id IS NOT NULL
+AND attachment.matrix_mail_id IS DISTINCT FROM mail.matrix_id
+AND (attachment.content IS NOT NULL OR attachment.matrix_room_id IS NOT NULL) -- uploaded files are reposted
+AND attachment.upload_failures < $1::int
+ORDER BY mail.timestamp, attachment.id
+`
+
+type GetMatrixReadyAttachmentsRow struct {
+	ID               int64
+	Mail             int64
+	Filename         string
+	ContentType      string
+	Content          []byte
+	Inline           bool
+	MatrixID         pgtype.Text
+	MatrixMailID     pgtype.Text
+	MatrixRoomID     pgtype.Text
+	UploadFailures   int32
+	MailMessageID    pgtype.Text
+	RootMatrixID     pgtype.Text
+	RootMatrixRoomID pgtype.Text
+}
+
+func (q *Queries) GetMatrixReadyAttachments(ctx context.Context, maxFailures int32) ([]*GetMatrixReadyAttachmentsRow, error) {
+	rows, err := q.db.Query(ctx, getMatrixReadyAttachments, maxFailures)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*GetMatrixReadyAttachmentsRow
+	for rows.Next() {
+		var i GetMatrixReadyAttachmentsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Mail,
+			&i.Filename,
+			&i.ContentType,
+			&i.Content,
+			&i.Inline,
+			&i.MatrixID,
+			&i.MatrixMailID,
+			&i.MatrixRoomID,
+			&i.UploadFailures,
+			&i.MailMessageID,
+			&i.RootMatrixID,
+			&i.RootMatrixRoomID,
 		); err != nil {
 			return nil, err
 		}
@@ -448,7 +967,7 @@ func (q *Queries) GetMailsRequiringSorting(ctx context.Context) ([]*Mail, error)
 }
 
 const getMatrixReadyMails = `-- name: GetMatrixReadyMails :many
-SELECT mail.id, mail.fetcher, mail.header_id, mail.header_in_reply_to, mail.header_references, mail.timestamp, mail.name_from, mail.addr_from, mail.addr_to, mail.subject, mail.body, mail.attachments, mail.messages, mail.messages_last_update, mail.sorted, mail.reply_to, mail.thread, mail.matrix_id,
+SELECT mail.id, mail.fetcher, mail.header_id, mail.header_in_reply_to, mail.header_references, mail.timestamp, mail.name_from, mail.addr_from, mail.addr_to, mail.addr_cc, mail.addr_reply_to, mail.subject, mail.body, mail.body_html, mail.html_only, mail.attachments, mail.messages, mail.messages_last_update, mail.sorted, mail.reply_to, mail.thread, mail.matrix_id, mail.matrix_posted, mail.forwarded,
 thread.matrix_id AS root_matrix_id, thread.matrix_room_id AS root_matrix_room_id, mail.id = thread.first_mail AS is_first
 FROM mail
 JOIN thread ON mail.thread = thread.id
@@ -467,8 +986,12 @@ type GetMatrixReadyMailsRow struct {
 	NameFrom           string
 	AddrFrom           string
 	AddrTo             []string
+	AddrCc             []string
+	AddrReplyTo        []string
 	Subject            string
 	Body               *string
+	BodyHtml           string
+	HtmlOnly           bool
 	Attachments        []string
 	Messages           *db.ExtractedMessages
 	MessagesLastUpdate pgtype.Timestamp
@@ -476,6 +999,8 @@ type GetMatrixReadyMailsRow struct {
 	ReplyTo            pgtype.Int8
 	Thread             pgtype.Int8
 	MatrixID           pgtype.Text
+	MatrixPosted       pgtype.Timestamp
+	Forwarded          bool
 	RootMatrixID       pgtype.Text
 	RootMatrixRoomID   pgtype.Text
 	IsFirst            bool
@@ -500,8 +1025,12 @@ func (q *Queries) GetMatrixReadyMails(ctx context.Context) ([]*GetMatrixReadyMai
 			&i.NameFrom,
 			&i.AddrFrom,
 			&i.AddrTo,
+			&i.AddrCc,
+			&i.AddrReplyTo,
 			&i.Subject,
 			&i.Body,
+			&i.BodyHtml,
+			&i.HtmlOnly,
 			&i.Attachments,
 			&i.Messages,
 			&i.MessagesLastUpdate,
@@ -509,6 +1038,8 @@ func (q *Queries) GetMatrixReadyMails(ctx context.Context) ([]*GetMatrixReadyMai
 			&i.ReplyTo,
 			&i.Thread,
 			&i.MatrixID,
+			&i.MatrixPosted,
+			&i.Forwarded,
 			&i.RootMatrixID,
 			&i.RootMatrixRoomID,
 			&i.IsFirst,
@@ -523,6 +1054,54 @@ func (q *Queries) GetMatrixReadyMails(ctx context.Context) ([]*GetMatrixReadyMai
 	return items, nil
 }
 
+const getMatrixReadyNotes = `-- name: GetMatrixReadyNotes :many
+SELECT note.id, note.thread, note.author, note.timestamp, note.body, note.matrix_id, thread.matrix_id AS root_matrix_id, thread.matrix_room_id AS root_matrix_room_id
+FROM note
+JOIN thread ON note.thread = thread.id
+WHERE note.matrix_id IS NULL AND thread.matrix_id IS NOT NULL
+ORDER BY note.timestamp
+`
+
+type GetMatrixReadyNotesRow struct {
+	ID               int64
+	Thread           int64
+	Author           string
+	Timestamp        pgtype.Timestamp
+	Body             string
+	MatrixID         pgtype.Text
+	RootMatrixID     pgtype.Text
+	RootMatrixRoomID pgtype.Text
+}
+
+func (q *Queries) GetMatrixReadyNotes(ctx context.Context) ([]*GetMatrixReadyNotesRow, error) {
+	rows, err := q.db.Query(ctx, getMatrixReadyNotes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*GetMatrixReadyNotesRow
+	for rows.Next() {
+		var i GetMatrixReadyNotesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Thread,
+			&i.Author,
+			&i.Timestamp,
+			&i.Body,
+			&i.MatrixID,
+			&i.RootMatrixID,
+			&i.RootMatrixRoomID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getMatrixReadyThreads = `-- name: GetMatrixReadyThreads :many
 SELECT thread.id, thread.matrix_room_id, mail.fetcher,
 mail.addr_from, mail.addr_to, mail.subject, mail.name_from FROM thread
@@ -570,31 +1149,100 @@ func (q *Queries) GetMatrixReadyThreads(ctx context.Context) ([]*GetMatrixReadyT
 	return items, nil
 }
 
+const getOutboxMailByCommand = `-- name: GetOutboxMailByCommand :one
+SELECT id, command_id, room_id, thread_id, reply_to_id, author, body, cite, reply_all, files, send_at, created FROM outbox
+WHERE room_id = $1 AND command_id = $2 LIMIT 1
+`
+
+type GetOutboxMailByCommandParams struct {
+	RoomID    string
+	CommandID string
+}
+
+func (q *Queries) GetOutboxMailByCommand(ctx context.Context, arg GetOutboxMailByCommandParams) (*Outbox, error) {
+	row := q.db.QueryRow(ctx, getOutboxMailByCommand, arg.RoomID, arg.CommandID)
+	var i Outbox
+	err := row.Scan(
+		&i.ID,
+		&i.CommandID,
+		&i.RoomID,
+		&i.ThreadID,
+		&i.ReplyToID,
+		&i.Author,
+		&i.Body,
+		&i.Cite,
+		&i.ReplyAll,
+		&i.Files,
+		&i.SendAt,
+		&i.Created,
+	)
+	return &i, err
+}
+
 const getOverviewThreads = `-- name: GetOverviewThreads :many
-SELECT thread.id, thread.enabled, thread.force_close, thread.last_message, thread.matrix_id, thread.matrix_room_id, thread.first_mail, thread.last_mail, mail.name_from, mail.addr_from, mail.subject, mail.matrix_id AS message_id
+SELECT thread.id, thread.enabled, thread.force_close, thread.last_message, thread.matrix_id, thread.matrix_room_id, thread.assignee, thread.snoozed_until, thread.created, thread.closed, thread.first_mail, thread.last_mail, thread.reminded_mail, thread.answered, mail.name_from, mail.addr_from, mail.subject, mail.matrix_id AS message_id,
+mail.timestamp AS first_timestamp,
+ARRAY(SELECT label FROM thread_label WHERE thread_label.thread = thread.id ORDER BY label)::text[] AS labels,
+COALESCE(last_mail.name_from, mail.name_from)::text AS last_name_from,
+COALESCE(last_mail.addr_from, mail.addr_from)::text AS last_addr_from,
+COALESCE(last_mail.timestamp, mail.timestamp)::timestamp AS last_timestamp,
+(SELECT COUNT(*) FROM mail m WHERE m.thread = thread.id) AS mail_count,
+COALESCE(room.name, thread.matrix_room_id)::text AS room_name,
+ARRAY(
+    SELECT reader FROM thread_reader
+    WHERE thread_reader.thread = thread.id AND thread_reader.seen >= COALESCE(
+        last_mail.matrix_posted, last_mail.timestamp, mail.matrix_posted, mail.timestamp
+    )
+    ORDER BY seen
+)::text[] AS readers
 FROM thread
 JOIN mail ON mail.id = thread.first_mail
+LEFT JOIN mail last_mail ON last_mail.id = thread.last_mail
+LEFT JOIN room ON room.id = thread.matrix_room_id
 WHERE thread.enabled AND thread.matrix_room_id = ANY($1::text[]) AND thread.matrix_id IS NOT NULL
-ORDER BY thread.last_message DESC
+AND (cardinality($2::text[]) = 0 OR EXISTS (
+    SELECT 1 FROM thread_label WHERE thread_label.thread = thread.id AND thread_label.label = ANY($2::text[])
+))
+ORDER BY ($3::boolean AND thread.assignee IS NOT NULL), thread.last_message DESC
 `
 
+type GetOverviewThreadsParams struct {
+	Targets         []string
+	Tags            []string
+	UnassignedFirst bool
+}
+
 type GetOverviewThreadsRow struct {
-	ID           int64
-	Enabled      bool
-	ForceClose   pgtype.Bool
-	LastMessage  pgtype.Timestamp
-	MatrixID     pgtype.Text
-	MatrixRoomID pgtype.Text
-	FirstMail    pgtype.Int8
-	LastMail     pgtype.Int8
-	NameFrom     string
-	AddrFrom     string
-	Subject      string
-	MessageID    pgtype.Text
+	ID             int64
+	Enabled        bool
+	ForceClose     pgtype.Bool
+	LastMessage    pgtype.Timestamp
+	MatrixID       pgtype.Text
+	MatrixRoomID   pgtype.Text
+	Assignee       pgtype.Text
+	SnoozedUntil   pgtype.Timestamp
+	Created        pgtype.Timestamp
+	Closed         pgtype.Timestamp
+	FirstMail      pgtype.Int8
+	LastMail       pgtype.Int8
+	RemindedMail   pgtype.Int8
+	Answered       bool
+	NameFrom       string
+	AddrFrom       string
+	Subject        string
+	MessageID      pgtype.Text
+	FirstTimestamp pgtype.Timestamp
+	Labels         []string
+	LastNameFrom   string
+	LastAddrFrom   string
+	LastTimestamp  pgtype.Timestamp
+	MailCount      int64
+	RoomName       string
+	Readers        []string
 }
 
-func (q *Queries) GetOverviewThreads(ctx context.Context, dollar_1 []string) ([]*GetOverviewThreadsRow, error) {
-	rows, err := q.db.Query(ctx, getOverviewThreads, dollar_1)
+func (q *Queries) GetOverviewThreads(ctx context.Context, arg GetOverviewThreadsParams) ([]*GetOverviewThreadsRow, error) {
+	rows, err := q.db.Query(ctx, getOverviewThreads, arg.Targets, arg.Tags, arg.UnassignedFirst)
 	if err != nil {
 		return nil, err
 	}
@@ -609,12 +1257,26 @@ func (q *Queries) GetOverviewThreads(ctx context.Context, dollar_1 []string) ([]
 			&i.LastMessage,
 			&i.MatrixID,
 			&i.MatrixRoomID,
+			&i.Assignee,
+			&i.SnoozedUntil,
+			&i.Created,
+			&i.Closed,
 			&i.FirstMail,
 			&i.LastMail,
+			&i.RemindedMail,
+			&i.Answered,
 			&i.NameFrom,
 			&i.AddrFrom,
 			&i.Subject,
 			&i.MessageID,
+			&i.FirstTimestamp,
+			&i.Labels,
+			&i.LastNameFrom,
+			&i.LastAddrFrom,
+			&i.LastTimestamp,
+			&i.MailCount,
+			&i.RoomName,
+			&i.Readers,
 		); err != nil {
 			return nil, err
 		}
@@ -627,7 +1289,7 @@ func (q *Queries) GetOverviewThreads(ctx context.Context, dollar_1 []string) ([]
 }
 
 const getReferencedThreadParent = `-- name: GetReferencedThreadParent :many
-SELECT mail.id, fetcher, header_id, header_in_reply_to, header_references, timestamp, name_from, addr_from, addr_to, subject, body, attachments, messages, messages_last_update, sorted, reply_to, thread, mail.matrix_id, thread.id, enabled, force_close, last_message, thread.matrix_id, matrix_room_id, first_mail, last_mail FROM mail
+SELECT mail.id, fetcher, header_id, header_in_reply_to, header_references, timestamp, name_from, addr_from, addr_to, addr_cc, addr_reply_to, subject, body, body_html, html_only, attachments, messages, messages_last_update, sorted, reply_to, thread, mail.matrix_id, matrix_posted, forwarded, thread.id, enabled, force_close, last_message, thread.matrix_id, matrix_room_id, assignee, snoozed_until, created, closed, first_mail, last_mail, reminded_mail, answered FROM mail
 JOIN thread ON thread.id = mail.thread
 WHERE header_id = ANY($1::text[]) AND NOT thread.force_close
 ORDER BY timestamp DESC
@@ -644,8 +1306,12 @@ type GetReferencedThreadParentRow struct {
 	NameFrom           string
 	AddrFrom           string
 	AddrTo             []string
+	AddrCc             []string
+	AddrReplyTo        []string
 	Subject            string
 	Body               *string
+	BodyHtml           string
+	HtmlOnly           bool
 	Attachments        []string
 	Messages           *db.ExtractedMessages
 	MessagesLastUpdate pgtype.Timestamp
@@ -653,14 +1319,22 @@ type GetReferencedThreadParentRow struct {
 	ReplyTo            pgtype.Int8
 	Thread             pgtype.Int8
 	MatrixID           pgtype.Text
+	MatrixPosted       pgtype.Timestamp
+	Forwarded          bool
 	ID_2               int64
 	Enabled            bool
 	ForceClose         pgtype.Bool
 	LastMessage        pgtype.Timestamp
 	MatrixID_2         pgtype.Text
 	MatrixRoomID       pgtype.Text
+	Assignee           pgtype.Text
+	SnoozedUntil       pgtype.Timestamp
+	Created            pgtype.Timestamp
+	Closed             pgtype.Timestamp
 	FirstMail          pgtype.Int8
 	LastMail           pgtype.Int8
+	RemindedMail       pgtype.Int8
+	Answered           bool
 }
 
 func (q *Queries) GetReferencedThreadParent(ctx context.Context, dollar_1 []string) ([]*GetReferencedThreadParentRow, error) {
@@ -682,8 +1356,12 @@ func (q *Queries) GetReferencedThreadParent(ctx context.Context, dollar_1 []stri
 			&i.NameFrom,
 			&i.AddrFrom,
 			&i.AddrTo,
+			&i.AddrCc,
+			&i.AddrReplyTo,
 			&i.Subject,
 			&i.Body,
+			&i.BodyHtml,
+			&i.HtmlOnly,
 			&i.Attachments,
 			&i.Messages,
 			&i.MessagesLastUpdate,
@@ -691,14 +1369,22 @@ func (q *Queries) GetReferencedThreadParent(ctx context.Context, dollar_1 []stri
 			&i.ReplyTo,
 			&i.Thread,
 			&i.MatrixID,
+			&i.MatrixPosted,
+			&i.Forwarded,
 			&i.ID_2,
 			&i.Enabled,
 			&i.ForceClose,
 			&i.LastMessage,
 			&i.MatrixID_2,
 			&i.MatrixRoomID,
+			&i.Assignee,
+			&i.SnoozedUntil,
+			&i.Created,
+			&i.Closed,
 			&i.FirstMail,
 			&i.LastMail,
+			&i.RemindedMail,
+			&i.Answered,
 		); err != nil {
 			return nil, err
 		}
@@ -711,7 +1397,7 @@ func (q *Queries) GetReferencedThreadParent(ctx context.Context, dollar_1 []stri
 }
 
 const getRoom = `-- name: GetRoom :one
-SELECT id, name, name_last_update, overview_message_id, overview_message_last_update FROM room
+SELECT id, name, name_last_update, overview_message_last_update, digest_last, overview_message_ids FROM room
 WHERE id = $1 LIMIT 1
 `
 
@@ -722,14 +1408,15 @@ func (q *Queries) GetRoom(ctx context.Context, id string) (*Room, error) {
 		&i.ID,
 		&i.Name,
 		&i.NameLastUpdate,
-		&i.OverviewMessageID,
 		&i.OverviewMessageLastUpdate,
+		&i.DigestLast,
+		&i.OverviewMessageIds,
 	)
 	return &i, err
 }
 
 const getRooms = `-- name: GetRooms :many
-SELECT id, name, name_last_update, overview_message_id, overview_message_last_update FROM room
+SELECT id, name, name_last_update, overview_message_last_update, digest_last, overview_message_ids FROM room
 WHERE id = ANY($1::text[])
 `
 
@@ -746,8 +1433,9 @@ func (q *Queries) GetRooms(ctx context.Context, dollar_1 []string) ([]*Room, err
 			&i.ID,
 			&i.Name,
 			&i.NameLastUpdate,
-			&i.OverviewMessageID,
 			&i.OverviewMessageLastUpdate,
+			&i.DigestLast,
+			&i.OverviewMessageIds,
 		); err != nil {
 			return nil, err
 		}
@@ -759,8 +1447,43 @@ func (q *Queries) GetRooms(ctx context.Context, dollar_1 []string) ([]*Room, err
 	return items, nil
 }
 
+const getThreadByMatrixEvent = `-- name: GetThreadByMatrixEvent :one
+SELECT thread.id, thread.enabled, thread.force_close, thread.last_message, thread.matrix_id, thread.matrix_room_id, thread.assignee, thread.snoozed_until, thread.created, thread.closed, thread.first_mail, thread.last_mail, thread.reminded_mail, thread.answered FROM thread
+WHERE thread.matrix_room_id = $1::text AND (thread.matrix_id = $2::text
+    OR thread.id = (SELECT mail.thread FROM mail WHERE mail.matrix_id = $2::text LIMIT 1)
+    OR thread.id = (SELECT note.thread FROM note WHERE note.matrix_id = $2::text LIMIT 1))
+LIMIT 1
+`
+
+type GetThreadByMatrixEventParams struct {
+	RoomID  string
+	EventID string
+}
+
+func (q *Queries) GetThreadByMatrixEvent(ctx context.Context, arg GetThreadByMatrixEventParams) (*Thread, error) {
+	row := q.db.QueryRow(ctx, getThreadByMatrixEvent, arg.RoomID, arg.EventID)
+	var i Thread
+	err := row.Scan(
+		&i.ID,
+		&i.Enabled,
+		&i.ForceClose,
+		&i.LastMessage,
+		&i.MatrixID,
+		&i.MatrixRoomID,
+		&i.Assignee,
+		&i.SnoozedUntil,
+		&i.Created,
+		&i.Closed,
+		&i.FirstMail,
+		&i.LastMail,
+		&i.RemindedMail,
+		&i.Answered,
+	)
+	return &i, err
+}
+
 const getThreadByMatrixId = `-- name: GetThreadByMatrixId :one
-SELECT id, enabled, force_close, last_message, matrix_id, matrix_room_id, first_mail, last_mail FROM thread
+SELECT id, enabled, force_close, last_message, matrix_id, matrix_room_id, assignee, snoozed_until, created, closed, first_mail, last_mail, reminded_mail, answered FROM thread
 WHERE matrix_id = $1 LIMIT 1
 `
 
@@ -774,12 +1497,124 @@ func (q *Queries) GetThreadByMatrixId(ctx context.Context, matrixID pgtype.Text)
 		&i.LastMessage,
 		&i.MatrixID,
 		&i.MatrixRoomID,
+		&i.Assignee,
+		&i.SnoozedUntil,
+		&i.Created,
+		&i.Closed,
 		&i.FirstMail,
 		&i.LastMail,
+		&i.RemindedMail,
+		&i.Answered,
 	)
 	return &i, err
 }
 
+const getThreadReaders = `-- name: GetThreadReaders :many
+SELECT thread_reader.thread, thread_reader.reader, thread_reader.seen, (
+    mail.id IS NULL OR thread_reader.seen >= COALESCE(mail.matrix_posted, mail.timestamp)
+)::boolean AS seen_latest
+FROM thread_reader
+JOIN thread ON thread.id = thread_reader.thread
+LEFT JOIN mail ON mail.id = thread.last_mail
+WHERE thread_reader.thread = $1
+ORDER BY thread_reader.seen DESC
+`
+
+type GetThreadReadersRow struct {
+	Thread     int64
+	Reader     string
+	Seen       pgtype.Timestamp
+	SeenLatest bool
+}
+
+func (q *Queries) GetThreadReaders(ctx context.Context, thread int64) ([]*GetThreadReadersRow, error) {
+	rows, err := q.db.Query(ctx, getThreadReaders, thread)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*GetThreadReadersRow
+	for rows.Next() {
+		var i GetThreadReadersRow
+		if err := rows.Scan(
+			&i.Thread,
+			&i.Reader,
+			&i.Seen,
+			&i.SeenLatest,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUnansweredThreads = `-- name: GetUnansweredThreads :many
+SELECT thread.id, thread.enabled, thread.force_close, thread.last_message, thread.matrix_id, thread.matrix_room_id, thread.assignee, thread.snoozed_until, thread.created, thread.closed, thread.first_mail, thread.last_mail, thread.reminded_mail, thread.answered, mail.timestamp AS mail_timestamp
+FROM thread
+JOIN mail ON mail.id = thread.last_mail
+WHERE thread.enabled AND thread.matrix_id IS NOT NULL AND thread.matrix_room_id = ANY($1::text[])
+AND NOT thread.answered
+AND thread.reminded_mail IS DISTINCT FROM thread.last_mail
+`
+
+type GetUnansweredThreadsRow struct {
+	ID            int64
+	Enabled       bool
+	ForceClose    pgtype.Bool
+	LastMessage   pgtype.Timestamp
+	MatrixID      pgtype.Text
+	MatrixRoomID  pgtype.Text
+	Assignee      pgtype.Text
+	SnoozedUntil  pgtype.Timestamp
+	Created       pgtype.Timestamp
+	Closed        pgtype.Timestamp
+	FirstMail     pgtype.Int8
+	LastMail      pgtype.Int8
+	RemindedMail  pgtype.Int8
+	Answered      bool
+	MailTimestamp pgtype.Timestamp
+}
+
+func (q *Queries) GetUnansweredThreads(ctx context.Context, rooms []string) ([]*GetUnansweredThreadsRow, error) {
+	rows, err := q.db.Query(ctx, getUnansweredThreads, rooms)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*GetUnansweredThreadsRow
+	for rows.Next() {
+		var i GetUnansweredThreadsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Enabled,
+			&i.ForceClose,
+			&i.LastMessage,
+			&i.MatrixID,
+			&i.MatrixRoomID,
+			&i.Assignee,
+			&i.SnoozedUntil,
+			&i.Created,
+			&i.Closed,
+			&i.FirstMail,
+			&i.LastMail,
+			&i.RemindedMail,
+			&i.Answered,
+			&i.MailTimestamp,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const mailCount = `-- name: MailCount :one
 SELECT COUNT(*) FROM mail
 `
@@ -791,6 +1626,110 @@ func (q *Queries) MailCount(ctx context.Context) (int64, error) {
 	return count, err
 }
 
+const mergeThreadState = `-- name: MergeThreadState :exec
+UPDATE thread
+SET enabled = thread.enabled OR source.enabled,
+last_message = GREATEST(thread.last_message, source.last_message),
+first_mail = (SELECT mail.id FROM mail WHERE mail.thread = thread.id ORDER BY mail.timestamp ASC LIMIT 1),
+last_mail = (SELECT mail.id FROM mail WHERE mail.thread = thread.id ORDER BY mail.timestamp DESC LIMIT 1),
+assignee = COALESCE(thread.assignee, source.assignee)
+FROM thread source
+WHERE thread.id = $1 AND source.id = $2
+`
+
+type MergeThreadStateParams struct {
+	Target int64
+	Source int64
+}
+
+func (q *Queries) MergeThreadState(ctx context.Context, arg MergeThreadStateParams) error {
+	_, err := q.db.Exec(ctx, mergeThreadState, arg.Target, arg.Source)
+	return err
+}
+
+const moveThreadLabels = `-- name: MoveThreadLabels :exec
+INSERT INTO thread_label (thread, label)
+SELECT $1, l.label FROM thread_label l
+WHERE l.thread = $2
+ON CONFLICT DO NOTHING
+`
+
+type MoveThreadLabelsParams struct {
+	Target int64
+	Source int64
+}
+
+func (q *Queries) MoveThreadLabels(ctx context.Context, arg MoveThreadLabelsParams) error {
+	_, err := q.db.Exec(ctx, moveThreadLabels, arg.Target, arg.Source)
+	return err
+}
+
+const moveThreadMails = `-- name: MoveThreadMails :execrows
+UPDATE mail
+SET thread = $1, matrix_id = NULL
+WHERE thread = $2
+`
+
+type MoveThreadMailsParams struct {
+	Target pgtype.Int8
+	Source pgtype.Int8
+}
+
+func (q *Queries) MoveThreadMails(ctx context.Context, arg MoveThreadMailsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, moveThreadMails, arg.Target, arg.Source)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const moveThreadNotes = `-- name: MoveThreadNotes :exec
+UPDATE note
+SET thread = $1, matrix_id = NULL
+WHERE thread = $2
+`
+
+type MoveThreadNotesParams struct {
+	Target int64
+	Source int64
+}
+
+func (q *Queries) MoveThreadNotes(ctx context.Context, arg MoveThreadNotesParams) error {
+	_, err := q.db.Exec(ctx, moveThreadNotes, arg.Target, arg.Source)
+	return err
+}
+
+const refreshThreadAnswered = `-- name: RefreshThreadAnswered :exec
+UPDATE thread
+SET answered = COALESCE((
+    SELECT LOWER(mail.addr_from) = ANY($1::text[]) FROM mail
+    WHERE mail.thread = thread.id AND NOT mail.forwarded
+    ORDER BY mail.timestamp DESC LIMIT 1
+), FALSE)
+WHERE thread.id = ANY($2::bigint[])
+`
+
+type RefreshThreadAnsweredParams struct {
+	OwnAddresses []string
+	Ids          []int64
+}
+
+func (q *Queries) RefreshThreadAnswered(ctx context.Context, arg RefreshThreadAnsweredParams) error {
+	_, err := q.db.Exec(ctx, refreshThreadAnswered, arg.OwnAddresses, arg.Ids)
+	return err
+}
+
+const refreshThreadLastMail = `-- name: RefreshThreadLastMail :exec
+UPDATE thread
+SET last_mail = (SELECT mail.id FROM mail WHERE mail.thread = thread.id ORDER BY mail.timestamp DESC LIMIT 1)
+WHERE id = ANY($1::bigint[])
+`
+
+func (q *Queries) RefreshThreadLastMail(ctx context.Context, ids []int64) error {
+	_, err := q.db.Exec(ctx, refreshThreadLastMail, ids)
+	return err
+}
+
 const removeMailMatrixIdsByThread = `-- name: RemoveMailMatrixIdsByThread :exec
 UPDATE mail
 SET matrix_id = NULL
@@ -802,6 +1741,35 @@ func (q *Queries) RemoveMailMatrixIdsByThread(ctx context.Context, thread pgtype
 	return err
 }
 
+const removeNoteMatrixIdsByThread = `-- name: RemoveNoteMatrixIdsByThread :exec
+UPDATE note
+SET matrix_id = NULL
+WHERE thread = $1
+`
+
+func (q *Queries) RemoveNoteMatrixIdsByThread(ctx context.Context, thread int64) error {
+	_, err := q.db.Exec(ctx, removeNoteMatrixIdsByThread, thread)
+	return err
+}
+
+const removeThreadLabels = `-- name: RemoveThreadLabels :execrows
+DELETE FROM thread_label
+WHERE thread = $1 AND label = ANY($2::text[])
+`
+
+type RemoveThreadLabelsParams struct {
+	Thread int64
+	Labels []string
+}
+
+func (q *Queries) RemoveThreadLabels(ctx context.Context, arg RemoveThreadLabelsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, removeThreadLabels, arg.Thread, arg.Labels)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const removeThreadMatrixId = `-- name: RemoveThreadMatrixId :exec
 UPDATE thread
 SET matrix_id = NULL
@@ -813,6 +1781,202 @@ func (q *Queries) RemoveThreadMatrixId(ctx context.Context, id int64) error {
 	return err
 }
 
+const reopenSnoozedThreads = `-- name: ReopenSnoozedThreads :many
+UPDATE thread
+SET enabled = TRUE, snoozed_until = NULL
+WHERE snoozed_until <= $1 AND NOT force_close
+RETURNING id, enabled, force_close, last_message, matrix_id, matrix_room_id, assignee, snoozed_until, created, closed, first_mail, last_mail, reminded_mail, answered
+`
+
+func (q *Queries) ReopenSnoozedThreads(ctx context.Context, snoozedUntil pgtype.Timestamp) ([]*Thread, error) {
+	rows, err := q.db.Query(ctx, reopenSnoozedThreads, snoozedUntil)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*Thread
+	for rows.Next() {
+		var i Thread
+		if err := rows.Scan(
+			&i.ID,
+			&i.Enabled,
+			&i.ForceClose,
+			&i.LastMessage,
+			&i.MatrixID,
+			&i.MatrixRoomID,
+			&i.Assignee,
+			&i.SnoozedUntil,
+			&i.Created,
+			&i.Closed,
+			&i.FirstMail,
+			&i.LastMail,
+			&i.RemindedMail,
+			&i.Answered,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchThreads = `-- name: SearchThreads :many
+SELECT id, enabled, matrix_id, matrix_room_id, subject, name_from, addr_from, timestamp, snippet, rank FROM (
+    SELECT DISTINCT ON (thread.id) thread.id, thread.enabled, thread.matrix_id, thread.matrix_room_id,
+    mail.subject, mail.name_from, mail.addr_from, mail.timestamp,
+    ts_headline(
+        'simple', mail.body, websearch_to_tsquery('simple', $1::text),
+        'StartSel=**, StopSel=**, MaxFragments=1, MinWords=8, MaxWords=20'
+    )::text AS snippet,
+    ts_rank(
+        to_tsvector('simple', mail.subject || ' ' || mail.name_from || ' ' || mail.addr_from || ' ' || mail.body),
+        websearch_to_tsquery('simple', $1::text)
+    )::real AS rank
+    FROM mail
+    JOIN thread ON thread.id = mail.thread
+    WHERE thread.matrix_id IS NOT NULL
+    AND ($1::text = '' OR to_tsvector('simple', mail.subject || ' ' || mail.name_from || ' ' || mail.addr_from || ' ' || mail.body)
+        @@ websearch_to_tsquery('simple', $1::text))
+    AND ($2::text = '' OR mail.addr_from ILIKE '%' || $2::text || '%' OR mail.name_from ILIKE '%' || $2::text || '%')
+    AND thread.matrix_room_id = ANY($3::text[])
+    AND ($4::timestamp IS NULL OR mail.timestamp < $4::timestamp)
+    AND ($5::timestamp IS NULL OR mail.timestamp >= $5::timestamp)
+    ORDER BY thread.id, rank DESC, mail.timestamp DESC
+) AS matches
+ORDER BY rank DESC, timestamp DESC
+LIMIT $6
+`
+
+type SearchThreadsParams struct {
+	Query      string
+	Sender     string
+	Rooms      []string
+	Before     pgtype.Timestamp
+	After      pgtype.Timestamp
+	MaxResults int32
+}
+
+type SearchThreadsRow struct {
+	ID           int64
+	Enabled      bool
+	MatrixID     pgtype.Text
+	MatrixRoomID pgtype.Text
+	Subject      string
+	NameFrom     string
+	AddrFrom     string
+	Timestamp    pgtype.Timestamp
+	Snippet      string
+	Rank         float32
+}
+
+func (q *Queries) SearchThreads(ctx context.Context, arg SearchThreadsParams) ([]*SearchThreadsRow, error) {
+	rows, err := q.db.Query(ctx, searchThreads,
+		arg.Query,
+		arg.Sender,
+		arg.Rooms,
+		arg.Before,
+		arg.After,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*SearchThreadsRow
+	for rows.Next() {
+		var i SearchThreadsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Enabled,
+			&i.MatrixID,
+			&i.MatrixRoomID,
+			&i.Subject,
+			&i.NameFrom,
+			&i.AddrFrom,
+			&i.Timestamp,
+			&i.Snippet,
+			&i.Rank,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const splitThreadMails = `-- name: SplitThreadMails :execrows
+UPDATE mail
+SET thread = $1, matrix_id = NULL
+WHERE mail.thread = $2 AND (mail.id = $3 OR ($4::boolean AND mail.timestamp > (
+    SELECT m.timestamp FROM mail m WHERE m.id = $3
+)))
+`
+
+type SplitThreadMailsParams struct {
+	Target       pgtype.Int8
+	Source       pgtype.Int8
+	SplitMail    int64
+	IncludeLater bool
+}
+
+func (q *Queries) SplitThreadMails(ctx context.Context, arg SplitThreadMailsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, splitThreadMails,
+		arg.Target,
+		arg.Source,
+		arg.SplitMail,
+		arg.IncludeLater,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateAttachmentMatrixId = `-- name: UpdateAttachmentMatrixId :exec
+UPDATE attachment
+SET matrix_id = $2, matrix_mail_id = $3, matrix_room_id = $4, content = NULL
+WHERE id = $1
+`
+
+type UpdateAttachmentMatrixIdParams struct {
+	ID           int64
+	MatrixID     pgtype.Text
+	MatrixMailID pgtype.Text
+	MatrixRoomID pgtype.Text
+}
+
+func (q *Queries) UpdateAttachmentMatrixId(ctx context.Context, arg UpdateAttachmentMatrixIdParams) error {
+	_, err := q.db.Exec(ctx, updateAttachmentMatrixId,
+		arg.ID,
+		arg.MatrixID,
+		arg.MatrixMailID,
+		arg.MatrixRoomID,
+	)
+	return err
+}
+
+const updateDraftPreview = `-- name: UpdateDraftPreview :exec
+UPDATE draft
+SET preview_id = $2
+WHERE id = $1
+`
+
+type UpdateDraftPreviewParams struct {
+	ID        int64
+	PreviewID pgtype.Text
+}
+
+func (q *Queries) UpdateDraftPreview(ctx context.Context, arg UpdateDraftPreviewParams) error {
+	_, err := q.db.Exec(ctx, updateDraftPreview, arg.ID, arg.PreviewID)
+	return err
+}
+
 const updateExtractedMessages = `-- name: UpdateExtractedMessages :exec
 UPDATE mail
 SET messages = $2, messages_last_update = CURRENT_TIMESTAMP
@@ -859,7 +2023,7 @@ func (q *Queries) UpdateMailMarkSorted(ctx context.Context, id int64) error {
 
 const updateMailMatrixId = `-- name: UpdateMailMatrixId :exec
 UPDATE mail
-SET matrix_id = $2
+SET matrix_id = $2, matrix_posted = (now() AT TIME ZONE 'utc')
 WHERE id = $1
 `
 
@@ -890,6 +2054,38 @@ func (q *Queries) UpdateMailSorting(ctx context.Context, arg UpdateMailSortingPa
 	return err
 }
 
+const updateNoteMatrixId = `-- name: UpdateNoteMatrixId :exec
+UPDATE note
+SET matrix_id = $2
+WHERE id = $1
+`
+
+type UpdateNoteMatrixIdParams struct {
+	ID       int64
+	MatrixID pgtype.Text
+}
+
+func (q *Queries) UpdateNoteMatrixId(ctx context.Context, arg UpdateNoteMatrixIdParams) error {
+	_, err := q.db.Exec(ctx, updateNoteMatrixId, arg.ID, arg.MatrixID)
+	return err
+}
+
+const updateRoomDigest = `-- name: UpdateRoomDigest :exec
+UPDATE room
+SET digest_last = $2
+WHERE id = $1
+`
+
+type UpdateRoomDigestParams struct {
+	ID         string
+	DigestLast pgtype.Timestamp
+}
+
+func (q *Queries) UpdateRoomDigest(ctx context.Context, arg UpdateRoomDigestParams) error {
+	_, err := q.db.Exec(ctx, updateRoomDigest, arg.ID, arg.DigestLast)
+	return err
+}
+
 const updateRoomName = `-- name: UpdateRoomName :exec
 UPDATE room
 SET name = $2, name_last_update = CURRENT_TIMESTAMP
@@ -908,23 +2104,44 @@ func (q *Queries) UpdateRoomName(ctx context.Context, arg UpdateRoomNameParams)
 
 const updateRoomOverviewMessage = `-- name: UpdateRoomOverviewMessage :exec
 UPDATE room
-SET overview_message_id = $2, overview_message_last_update = CURRENT_TIMESTAMP
+SET overview_message_ids = $2, overview_message_last_update = CURRENT_TIMESTAMP
 WHERE id = $1
 `
 
 type UpdateRoomOverviewMessageParams struct {
-	ID                string
-	OverviewMessageID pgtype.Text
+	ID                 string
+	OverviewMessageIds []string
 }
 
 func (q *Queries) UpdateRoomOverviewMessage(ctx context.Context, arg UpdateRoomOverviewMessageParams) error {
-	_, err := q.db.Exec(ctx, updateRoomOverviewMessage, arg.ID, arg.OverviewMessageID)
+	_, err := q.db.Exec(ctx, updateRoomOverviewMessage, arg.ID, arg.OverviewMessageIds)
 	return err
 }
 
+const updateThreadAssignee = `-- name: UpdateThreadAssignee :execrows
+UPDATE thread
+SET assignee = $3
+WHERE matrix_id = $1 AND matrix_room_id = $2
+`
+
+type UpdateThreadAssigneeParams struct {
+	MatrixID     pgtype.Text
+	MatrixRoomID pgtype.Text
+	Assignee     pgtype.Text
+}
+
+func (q *Queries) UpdateThreadAssignee(ctx context.Context, arg UpdateThreadAssigneeParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateThreadAssignee, arg.MatrixID, arg.MatrixRoomID, arg.Assignee)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const updateThreadEnabled = `-- name: UpdateThreadEnabled :execrows
 UPDATE thread
-SET enabled = $3, force_close = COALESCE($4, force_close)
+SET enabled = $3, force_close = COALESCE($4, force_close), snoozed_until = NULL,
+closed = CASE WHEN $3 THEN closed ELSE (now() AT TIME ZONE 'utc') END
 WHERE matrix_id = $1 AND matrix_room_id = $2 AND (enabled != $3 OR force_close != COALESCE($4, force_close))
 `
 
@@ -950,7 +2167,7 @@ func (q *Queries) UpdateThreadEnabled(ctx context.Context, arg UpdateThreadEnabl
 
 const updateThreadLastMail = `-- name: UpdateThreadLastMail :exec
 UPDATE thread
-SET enabled = TRUE, last_message = GREATEST(last_message, $3), last_mail = $2
+SET enabled = TRUE, snoozed_until = NULL, last_message = GREATEST(last_message, $3), last_mail = $2
 WHERE id = $1
 `
 
@@ -992,3 +2209,153 @@ func (q *Queries) UpdateThreadMatrixIds(ctx context.Context, arg UpdateThreadMat
 	_, err := q.db.Exec(ctx, updateThreadMatrixIds, arg.ID, arg.MatrixRoomID, arg.MatrixID)
 	return err
 }
+
+const updateThreadReaderSeen = `-- name: UpdateThreadReaderSeen :execrows
+UPDATE thread_reader
+SET seen = $3
+WHERE thread = $1 AND reader = $2 AND seen < $3
+`
+
+type UpdateThreadReaderSeenParams struct {
+	Thread int64
+	Reader string
+	Seen   pgtype.Timestamp
+}
+
+func (q *Queries) UpdateThreadReaderSeen(ctx context.Context, arg UpdateThreadReaderSeenParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateThreadReaderSeen, arg.Thread, arg.Reader, arg.Seen)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateThreadReminded = `-- name: UpdateThreadReminded :exec
+UPDATE thread
+SET reminded_mail = $2
+WHERE id = $1
+`
+
+type UpdateThreadRemindedParams struct {
+	ID           int64
+	RemindedMail pgtype.Int8
+}
+
+func (q *Queries) UpdateThreadReminded(ctx context.Context, arg UpdateThreadRemindedParams) error {
+	_, err := q.db.Exec(ctx, updateThreadReminded, arg.ID, arg.RemindedMail)
+	return err
+}
+
+const updateThreadSnooze = `-- name: UpdateThreadSnooze :execrows
+UPDATE thread
+SET snoozed_until = $3
+WHERE matrix_id = $1 AND matrix_room_id = $2 AND NOT enabled AND NOT force_close
+`
+
+type UpdateThreadSnoozeParams struct {
+	MatrixID     pgtype.Text
+	MatrixRoomID pgtype.Text
+	SnoozedUntil pgtype.Timestamp
+}
+
+func (q *Queries) UpdateThreadSnooze(ctx context.Context, arg UpdateThreadSnoozeParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateThreadSnooze, arg.MatrixID, arg.MatrixRoomID, arg.SnoozedUntil)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const upsertDraft = `-- name: UpsertDraft :one
+INSERT INTO draft (command_id, room_id, thread_id, reply_to_id, author, body, cite, reply_all, forward_to, files, send_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+ON CONFLICT (command_id) DO UPDATE
+SET reply_to_id = EXCLUDED.reply_to_id, body = EXCLUDED.body, cite = EXCLUDED.cite,
+reply_all = EXCLUDED.reply_all, forward_to = EXCLUDED.forward_to, files = EXCLUDED.files, send_at = EXCLUDED.send_at
+RETURNING id, command_id, preview_id, room_id, thread_id, reply_to_id, author, body, cite, reply_all, forward_to, files, send_at, created
+`
+
+type UpsertDraftParams struct {
+	CommandID string
+	RoomID    string
+	ThreadID  string
+	ReplyToID string
+	Author    string
+	Body      string
+	Cite      bool
+	ReplyAll  bool
+	ForwardTo pgtype.Text
+	Files     []string
+	SendAt    pgtype.Timestamp
+}
+
+func (q *Queries) UpsertDraft(ctx context.Context, arg UpsertDraftParams) (*Draft, error) {
+	row := q.db.QueryRow(ctx, upsertDraft,
+		arg.CommandID,
+		arg.RoomID,
+		arg.ThreadID,
+		arg.ReplyToID,
+		arg.Author,
+		arg.Body,
+		arg.Cite,
+		arg.ReplyAll,
+		arg.ForwardTo,
+		arg.Files,
+		arg.SendAt,
+	)
+	var i Draft
+	err := row.Scan(
+		&i.ID,
+		&i.CommandID,
+		&i.PreviewID,
+		&i.RoomID,
+		&i.ThreadID,
+		&i.ReplyToID,
+		&i.Author,
+		&i.Body,
+		&i.Cite,
+		&i.ReplyAll,
+		&i.ForwardTo,
+		&i.Files,
+		&i.SendAt,
+		&i.Created,
+	)
+	return &i, err
+}
+
+const upsertOutboxMail = `-- name: UpsertOutboxMail :exec
+INSERT INTO outbox (command_id, room_id, thread_id, reply_to_id, author, body, cite, reply_all, files, send_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+ON CONFLICT (command_id) DO UPDATE
+SET reply_to_id = EXCLUDED.reply_to_id, body = EXCLUDED.body, cite = EXCLUDED.cite,
+reply_all = EXCLUDED.reply_all, files = EXCLUDED.files, send_at = EXCLUDED.send_at
+`
+
+type UpsertOutboxMailParams struct {
+	CommandID string
+	RoomID    string
+	ThreadID  string
+	ReplyToID string
+	Author    string
+	Body      string
+	Cite      bool
+	ReplyAll  bool
+	Files     []string
+	SendAt    pgtype.Timestamp
+}
+
+func (q *Queries) UpsertOutboxMail(ctx context.Context, arg UpsertOutboxMailParams) error {
+	_, err := q.db.Exec(ctx, upsertOutboxMail,
+		arg.CommandID,
+		arg.RoomID,
+		arg.ThreadID,
+		arg.ReplyToID,
+		arg.Author,
+		arg.Body,
+		arg.Cite,
+		arg.ReplyAll,
+		arg.Files,
+		arg.SendAt,
+	)
+	return err
+}
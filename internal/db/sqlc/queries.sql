@@ -7,11 +7,15 @@ LEFT JOIN thread ON thread.id = mail.thread
 WHERE mail.id = $1 LIMIT 1;
 
 -- name: AddMail :many
-INSERT INTO mail (fetcher, header_id, header_in_reply_to, header_references, timestamp, name_from, addr_from, addr_to, subject, body, attachments)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+INSERT INTO mail (fetcher, header_id, header_in_reply_to, header_references, timestamp, name_from, addr_from, addr_to, addr_cc, addr_reply_to, subject, body, body_html, html_only, attachments, forwarded)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
 ON CONFLICT (header_id) DO NOTHING
 RETURNING *;
 
+-- name: AddAttachment :exec
+INSERT INTO attachment (mail, filename, content_type, content, inline)
+VALUES ($1, $2, $3, $4, $5);
+
 -- name: GetMailByMatrixId :one
 SELECT * FROM mail
 WHERE matrix_id = $1 LIMIT 1;
@@ -26,6 +30,32 @@ SELECT * FROM mail
 WHERE header_id = ANY($1::text[])
 ORDER BY timestamp;
 
+-- name: SearchThreads :many
+SELECT * FROM (
+    SELECT DISTINCT ON (thread.id) thread.id, thread.enabled, thread.matrix_id, thread.matrix_room_id,
+    mail.subject, mail.name_from, mail.addr_from, mail.timestamp,
+    ts_headline(
+        'simple', mail.body, websearch_to_tsquery('simple', @query::text),
+        'StartSel=**, StopSel=**, MaxFragments=1, MinWords=8, MaxWords=20'
+    )::text AS snippet,
+    ts_rank(
+        to_tsvector('simple', mail.subject || ' ' || mail.name_from || ' ' || mail.addr_from || ' ' || mail.body),
+        websearch_to_tsquery('simple', @query::text)
+    )::real AS rank
+    FROM mail
+    JOIN thread ON thread.id = mail.thread
+    WHERE thread.matrix_id IS NOT NULL
+    AND (@query::text = '' OR to_tsvector('simple', mail.subject || ' ' || mail.name_from || ' ' || mail.addr_from || ' ' || mail.body)
+        @@ websearch_to_tsquery('simple', @query::text))
+    AND (@sender::text = '' OR mail.addr_from ILIKE '%' || @sender::text || '%' OR mail.name_from ILIKE '%' || @sender::text || '%')
+    AND thread.matrix_room_id = ANY(@rooms::text[])
+    AND (sqlc.narg(before)::timestamp IS NULL OR mail.timestamp < sqlc.narg(before)::timestamp)
+    AND (sqlc.narg(after)::timestamp IS NULL OR mail.timestamp >= sqlc.narg(after)::timestamp)
+    ORDER BY thread.id, rank DESC, mail.timestamp DESC
+) AS matches
+ORDER BY rank DESC, timestamp DESC
+LIMIT @max_results;
+
 -- name: GetMailsRequiringMessageExtraction :many
 SELECT * FROM mail
 WHERE sorted AND fetcher IS NOT NULL AND messages ->> 'messages' IS NULL
@@ -80,14 +110,182 @@ WHERE id = $1;
 
 -- name: UpdateThreadLastMail :exec
 UPDATE thread
-SET enabled = TRUE, last_message = GREATEST(last_message, $3), last_mail = $2
+SET enabled = TRUE, snoozed_until = NULL, last_message = GREATEST(last_message, $3), last_mail = $2
 WHERE id = $1;
 
 -- name: UpdateThreadEnabled :execrows
 UPDATE thread
-SET enabled = $3, force_close = COALESCE($4, force_close)
+SET enabled = $3, force_close = COALESCE($4, force_close), snoozed_until = NULL,
+closed = CASE WHEN $3 THEN closed ELSE (now() AT TIME ZONE 'utc') END
 WHERE matrix_id = $1 AND matrix_room_id = $2 AND (enabled != $3 OR force_close != COALESCE($4, force_close));
 
+-- name: UpdateThreadAssignee :execrows
+UPDATE thread
+SET assignee = $3
+WHERE matrix_id = $1 AND matrix_room_id = $2;
+
+-- name: GetUnansweredThreads :many
+SELECT thread.*, mail.timestamp AS mail_timestamp
+FROM thread
+JOIN mail ON mail.id = thread.last_mail
+WHERE thread.enabled AND thread.matrix_id IS NOT NULL AND thread.matrix_room_id = ANY(@rooms::text[])
+AND NOT thread.answered
+AND thread.reminded_mail IS DISTINCT FROM thread.last_mail;
+
+-- name: UpdateThreadReminded :exec
+UPDATE thread
+SET reminded_mail = $2
+WHERE id = $1;
+
+-- name: UpdateThreadSnooze :execrows
+UPDATE thread
+SET snoozed_until = $3
+WHERE matrix_id = $1 AND matrix_room_id = $2 AND NOT enabled AND NOT force_close;
+
+-- name: ReopenSnoozedThreads :many
+UPDATE thread
+SET enabled = TRUE, snoozed_until = NULL
+WHERE snoozed_until <= $1 AND NOT force_close
+RETURNING *;
+
+-- name: AddThreadLabels :exec
+INSERT INTO thread_label (thread, label)
+SELECT $1, unnest(@labels::text[])
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveThreadLabels :execrows
+DELETE FROM thread_label
+WHERE thread = $1 AND label = ANY(@labels::text[]);
+
+-- name: MoveThreadMails :execrows
+UPDATE mail
+SET thread = @target, matrix_id = NULL
+WHERE thread = @source;
+
+-- name: GetThreadByMatrixEvent :one
+SELECT thread.* FROM thread
+WHERE thread.matrix_room_id = @room_id::text AND (thread.matrix_id = @event_id::text
+    OR thread.id = (SELECT mail.thread FROM mail WHERE mail.matrix_id = @event_id::text LIMIT 1)
+    OR thread.id = (SELECT note.thread FROM note WHERE note.matrix_id = @event_id::text LIMIT 1))
+LIMIT 1;
+
+-- name: AddThreadReader :execrows
+INSERT INTO thread_reader (thread, reader, seen)
+VALUES ($1, $2, $3)
+ON CONFLICT (thread, reader) DO NOTHING;
+
+-- name: UpdateThreadReaderSeen :execrows
+UPDATE thread_reader
+SET seen = $3
+WHERE thread = $1 AND reader = $2 AND seen < $3;
+
+-- name: GetThreadReaders :many
+SELECT thread_reader.*, (
+    mail.id IS NULL OR thread_reader.seen >= COALESCE(mail.matrix_posted, mail.timestamp)
+)::boolean AS seen_latest
+FROM thread_reader
+JOIN thread ON thread.id = thread_reader.thread
+LEFT JOIN mail ON mail.id = thread.last_mail
+WHERE thread_reader.thread = $1
+ORDER BY thread_reader.seen DESC;
+
+-- name: MoveThreadLabels :exec
+INSERT INTO thread_label (thread, label)
+SELECT @target, l.label FROM thread_label l
+WHERE l.thread = @source
+ON CONFLICT DO NOTHING;
+
+-- name: MoveThreadNotes :exec
+UPDATE note
+SET thread = @target, matrix_id = NULL
+WHERE thread = @source;
+
+-- name: MergeThreadState :exec
+UPDATE thread
+SET enabled = thread.enabled OR source.enabled,
+last_message = GREATEST(thread.last_message, source.last_message),
+first_mail = (SELECT mail.id FROM mail WHERE mail.thread = thread.id ORDER BY mail.timestamp ASC LIMIT 1),
+last_mail = (SELECT mail.id FROM mail WHERE mail.thread = thread.id ORDER BY mail.timestamp DESC LIMIT 1),
+assignee = COALESCE(thread.assignee, source.assignee)
+FROM thread source
+WHERE thread.id = @target AND source.id = @source;
+
+-- name: SplitThreadMails :execrows
+UPDATE mail
+SET thread = @target, matrix_id = NULL
+WHERE mail.thread = @source AND (mail.id = @split_mail OR (@include_later::boolean AND mail.timestamp > (
+    SELECT m.timestamp FROM mail m WHERE m.id = @split_mail
+)));
+
+-- name: RefreshThreadLastMail :exec
+UPDATE thread
+SET last_mail = (SELECT mail.id FROM mail WHERE mail.thread = thread.id ORDER BY mail.timestamp DESC LIMIT 1)
+WHERE id = ANY(@ids::bigint[]);
+
+-- name: RefreshThreadAnswered :exec
+UPDATE thread
+SET answered = COALESCE((
+    SELECT LOWER(mail.addr_from) = ANY(@own_addresses::text[]) FROM mail
+    WHERE mail.thread = thread.id AND NOT mail.forwarded
+    ORDER BY mail.timestamp DESC LIMIT 1
+), FALSE)
+WHERE thread.id = ANY(@ids::bigint[]);
+
+-- name: CloseAnsweredThread :execrows
+UPDATE thread
+SET enabled = FALSE, snoozed_until = NULL, closed = (now() AT TIME ZONE 'utc')
+WHERE id = $1 AND enabled AND answered;
+
+-- name: DeleteThread :exec
+DELETE FROM thread
+WHERE id = $1;
+
+-- name: UpsertDraft :one
+INSERT INTO draft (command_id, room_id, thread_id, reply_to_id, author, body, cite, reply_all, forward_to, files, send_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+ON CONFLICT (command_id) DO UPDATE
+SET reply_to_id = EXCLUDED.reply_to_id, body = EXCLUDED.body, cite = EXCLUDED.cite,
+reply_all = EXCLUDED.reply_all, forward_to = EXCLUDED.forward_to, files = EXCLUDED.files, send_at = EXCLUDED.send_at
+RETURNING *;
+
+-- name: UpdateDraftPreview :exec
+UPDATE draft
+SET preview_id = $2
+WHERE id = $1;
+
+-- name: GetDraftByMatrixId :one
+SELECT * FROM draft
+WHERE command_id = $1 OR preview_id = $1 LIMIT 1;
+
+-- name: DeleteDraft :execrows
+DELETE FROM draft
+WHERE id = $1;
+
+-- name: UpsertOutboxMail :exec
+INSERT INTO outbox (command_id, room_id, thread_id, reply_to_id, author, body, cite, reply_all, files, send_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+ON CONFLICT (command_id) DO UPDATE
+SET reply_to_id = EXCLUDED.reply_to_id, body = EXCLUDED.body, cite = EXCLUDED.cite,
+reply_all = EXCLUDED.reply_all, files = EXCLUDED.files, send_at = EXCLUDED.send_at;
+
+-- name: GetDueOutboxMails :many
+SELECT * FROM outbox
+WHERE send_at <= $1
+ORDER BY send_at;
+
+-- name: GetOutboxMailByCommand :one
+SELECT * FROM outbox
+WHERE room_id = $1 AND command_id = $2 LIMIT 1;
+
+-- name: DeleteOutboxMail :execrows
+DELETE FROM outbox
+WHERE id = $1;
+
+-- name: DeleteOutboxMailByCommand :many
+DELETE FROM outbox
+WHERE room_id = $1 AND command_id = $2
+RETURNING *;
+
 -- name: AddFetcher :exec
 INSERT INTO fetcher (id)
 VALUES ($1);
@@ -118,6 +316,33 @@ WHERE mail.matrix_id IS NULL AND thread.matrix_id IS NOT NULL
 AND mail.messages ->> 'messages' IS NOT NULL
 ORDER BY mail.timestamp;
 
+-- name: GetAttachmentsByMail :many
+SELECT * FROM attachment
+WHERE mail = $1
+ORDER BY id;
+
+-- name: GetMatrixReadyAttachments :many
+SELECT attachment.*, mail.matrix_id AS mail_message_id,
+thread.matrix_id AS root_matrix_id, thread.matrix_room_id AS root_matrix_room_id
+FROM attachment
+JOIN mail ON attachment.mail = mail.id
+JOIN thread ON mail.thread = thread.id
+WHERE mail.matrix_id IS NOT NULL AND thread.matrix_id IS NOT NULL
+AND attachment.matrix_mail_id IS DISTINCT FROM mail.matrix_id
+AND (attachment.content IS NOT NULL OR attachment.matrix_room_id IS NOT NULL) -- uploaded files are reposted
+AND attachment.upload_failures < @max_failures::int
+ORDER BY mail.timestamp, attachment.id;
+
+-- name: UpdateAttachmentMatrixId :exec
+UPDATE attachment
+SET matrix_id = $2, matrix_mail_id = $3, matrix_room_id = $4, content = NULL
+WHERE id = $1;
+
+-- name: AddAttachmentUploadFailure :exec
+UPDATE attachment
+SET upload_failures = upload_failures + 1
+WHERE id = $1;
+
 -- name: UpdateThreadMatrixIds :exec
 UPDATE thread
 SET matrix_id = $3, matrix_room_id = $2
@@ -125,7 +350,7 @@ WHERE id = $1;
 
 -- name: UpdateMailMatrixId :exec
 UPDATE mail
-SET matrix_id = $2
+SET matrix_id = $2, matrix_posted = (now() AT TIME ZONE 'utc')
 WHERE id = $1;
 
 -- name: RemoveThreadMatrixId :exec
@@ -138,12 +363,74 @@ UPDATE mail
 SET matrix_id = NULL
 WHERE thread = $1;
 
+-- name: RemoveNoteMatrixIdsByThread :exec
+UPDATE note
+SET matrix_id = NULL
+WHERE thread = $1;
+
+-- name: AddNote :exec
+INSERT INTO note (thread, author, timestamp, body)
+VALUES ($1, $2, $3, $4);
+
+-- name: GetMatrixReadyNotes :many
+SELECT note.*, thread.matrix_id AS root_matrix_id, thread.matrix_room_id AS root_matrix_room_id
+FROM note
+JOIN thread ON note.thread = thread.id
+WHERE note.matrix_id IS NULL AND thread.matrix_id IS NOT NULL
+ORDER BY note.timestamp;
+
+-- name: UpdateNoteMatrixId :exec
+UPDATE note
+SET matrix_id = $2
+WHERE id = $1;
+
 -- name: GetOverviewThreads :many
-SELECT thread.*, mail.name_from, mail.addr_from, mail.subject, mail.matrix_id AS message_id
+SELECT thread.*, mail.name_from, mail.addr_from, mail.subject, mail.matrix_id AS message_id,
+mail.timestamp AS first_timestamp,
+ARRAY(SELECT label FROM thread_label WHERE thread_label.thread = thread.id ORDER BY label)::text[] AS labels,
+COALESCE(last_mail.name_from, mail.name_from)::text AS last_name_from,
+COALESCE(last_mail.addr_from, mail.addr_from)::text AS last_addr_from,
+COALESCE(last_mail.timestamp, mail.timestamp)::timestamp AS last_timestamp,
+(SELECT COUNT(*) FROM mail m WHERE m.thread = thread.id) AS mail_count,
+COALESCE(room.name, thread.matrix_room_id)::text AS room_name,
+ARRAY(
+    SELECT reader FROM thread_reader
+    WHERE thread_reader.thread = thread.id AND thread_reader.seen >= COALESCE(
+        last_mail.matrix_posted, last_mail.timestamp, mail.matrix_posted, mail.timestamp
+    )
+    ORDER BY seen
+)::text[] AS readers
 FROM thread
 JOIN mail ON mail.id = thread.first_mail
-WHERE thread.enabled AND thread.matrix_room_id = ANY($1::text[]) AND thread.matrix_id IS NOT NULL
-ORDER BY thread.last_message DESC;
+LEFT JOIN mail last_mail ON last_mail.id = thread.last_mail
+LEFT JOIN room ON room.id = thread.matrix_room_id
+WHERE thread.enabled AND thread.matrix_room_id = ANY(@targets::text[]) AND thread.matrix_id IS NOT NULL
+AND (cardinality(@tags::text[]) = 0 OR EXISTS (
+    SELECT 1 FROM thread_label WHERE thread_label.thread = thread.id AND thread_label.label = ANY(@tags::text[])
+))
+ORDER BY (@unassigned_first::boolean AND thread.assignee IS NOT NULL), thread.last_message DESC;
+
+-- name: UpdateRoomDigest :exec
+UPDATE room
+SET digest_last = $2
+WHERE id = $1;
+
+-- name: GetDigestThreads :many
+SELECT thread.*, first_mail.name_from, first_mail.addr_from, first_mail.subject,
+first_mail.timestamp AS first_timestamp, last_mail.timestamp AS last_timestamp,
+COALESCE(latest_note.author, '')::text AS note_author, COALESCE(latest_note.body, '')::text AS note_body
+FROM thread
+JOIN mail first_mail ON first_mail.id = thread.first_mail
+JOIN mail last_mail ON last_mail.id = thread.last_mail
+LEFT JOIN LATERAL (
+    SELECT note.author, note.body FROM note WHERE note.thread = thread.id ORDER BY note.timestamp DESC LIMIT 1
+) latest_note ON TRUE
+WHERE thread.matrix_room_id = ANY(@targets::text[]) AND thread.matrix_id IS NOT NULL
+AND (thread.enabled OR thread.closed > @since)
+AND (cardinality(@tags::text[]) = 0 OR EXISTS (
+    SELECT 1 FROM thread_label WHERE thread_label.thread = thread.id AND thread_label.label = ANY(@tags::text[])
+))
+ORDER BY first_mail.timestamp;
 
 -- name: GetRoom :one
 SELECT * FROM room
@@ -165,6 +452,6 @@ WHERE id = $1;
 
 -- name: UpdateRoomOverviewMessage :exec
 UPDATE room
-SET overview_message_id = $2, overview_message_last_update = CURRENT_TIMESTAMP
+SET overview_message_ids = $2, overview_message_last_update = CURRENT_TIMESTAMP
 WHERE id = $1;
 
@@ -9,7 +9,8 @@ CREATE TABLE room (
     name TEXT,
     name_last_update TIMESTAMP,
     overview_message_id TEXT,
-    overview_message_last_update TIMESTAMP
+    overview_message_last_update TIMESTAMP,
+    digest_last TIMESTAMP -- when the last digest has been posted
 );
 
 CREATE TABLE thread (
@@ -18,7 +19,11 @@ CREATE TABLE thread (
     force_close BOOLEAN NOT NULL DEFAULT FALSE,
     last_message TIMESTAMP,
     matrix_id TEXT,
-    matrix_room_id TEXT REFERENCES room(id) ON DELETE SET NULL ON UPDATE CASCADE
+    matrix_room_id TEXT REFERENCES room(id) ON DELETE SET NULL ON UPDATE CASCADE,
+    assignee TEXT, -- matrix user id
+    snoozed_until TIMESTAMP,
+    created TIMESTAMP NOT NULL DEFAULT (now() AT TIME ZONE 'utc'),
+    closed TIMESTAMP -- when the thread has been closed the last time
 );
 
 CREATE TABLE mail (
@@ -31,8 +36,12 @@ CREATE TABLE mail (
     name_from TEXT NOT NULL,
     addr_from TEXT NOT NULL,
     addr_to TEXT[] NOT NULL,
+    addr_cc TEXT[] NOT NULL DEFAULT '{}',
+    addr_reply_to TEXT[] NOT NULL DEFAULT '{}',
     subject TEXT NOT NULL,
     body TEXT NOT NULL,
+    body_html TEXT NOT NULL DEFAULT '',
+    html_only BOOLEAN NOT NULL DEFAULT FALSE, -- body has been converted from body_html
     attachments TEXT[] NOT NULL,
     messages JSONB,
     messages_last_update TIMESTAMP,
@@ -42,6 +51,96 @@ CREATE TABLE mail (
     matrix_id TEXT
 );
 
+CREATE INDEX mail_search_idx ON mail USING GIN (
+    to_tsvector('simple', subject || ' ' || name_from || ' ' || addr_from || ' ' || body)
+);
+
+CREATE TABLE thread_label (
+    thread BIGINT NOT NULL REFERENCES thread(id) ON DELETE CASCADE,
+    label TEXT NOT NULL,
+    PRIMARY KEY (thread, label)
+);
+
+CREATE TABLE thread_reader (
+    thread BIGINT NOT NULL REFERENCES thread(id) ON DELETE CASCADE,
+    reader TEXT NOT NULL, -- matrix user id
+    seen TIMESTAMP NOT NULL, -- latest read receipt within the thread
+    PRIMARY KEY (thread, reader)
+);
+
+CREATE TABLE attachment (
+    id BIGSERIAL PRIMARY KEY,
+    mail BIGINT NOT NULL REFERENCES mail(id) ON DELETE CASCADE,
+    filename TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    content BYTEA, -- cleared once uploaded
+    inline BOOLEAN NOT NULL DEFAULT FALSE,
+    matrix_id TEXT,
+    matrix_mail_id TEXT, -- matrix id of the mail message the attachment has been posted to
+    matrix_room_id TEXT, -- room of matrix_id to repost the file from once the mail has moved
+    upload_failures INT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE note (
+    id BIGSERIAL PRIMARY KEY,
+    thread BIGINT NOT NULL REFERENCES thread(id) ON DELETE CASCADE,
+    author TEXT NOT NULL, -- matrix user id
+    timestamp TIMESTAMP NOT NULL,
+    body TEXT NOT NULL,
+    matrix_id TEXT
+);
+
+CREATE TABLE draft (
+    id BIGSERIAL PRIMARY KEY,
+    command_id TEXT UNIQUE NOT NULL, -- matrix id of the reply command
+    preview_id TEXT, -- matrix id of the preview message
+    room_id TEXT NOT NULL,
+    thread_id TEXT NOT NULL,
+    reply_to_id TEXT NOT NULL, -- matrix id of the mail to reply to
+    author TEXT NOT NULL, -- matrix user id
+    body TEXT NOT NULL,
+    cite BOOLEAN NOT NULL,
+    reply_all BOOLEAN NOT NULL DEFAULT FALSE,
+    forward_to TEXT, -- forward instead of reply if set
+    files TEXT[] NOT NULL DEFAULT '{}', -- matrix ids of file messages to attach
+    send_at TIMESTAMP, -- scheduled replies are moved into the outbox once approved
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE outbox (
+    id BIGSERIAL PRIMARY KEY,
+    command_id TEXT UNIQUE NOT NULL, -- matrix id of the scheduling command
+    room_id TEXT NOT NULL,
+    thread_id TEXT NOT NULL,
+    reply_to_id TEXT NOT NULL, -- matrix id of the mail to reply to
+    author TEXT NOT NULL, -- matrix user id
+    body TEXT NOT NULL,
+    cite BOOLEAN NOT NULL,
+    reply_all BOOLEAN NOT NULL DEFAULT FALSE,
+    files TEXT[] NOT NULL DEFAULT '{}', -- matrix ids of file messages to attach
+    send_at TIMESTAMP NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
 ALTER TABLE thread ADD COLUMN first_mail BIGINT REFERENCES mail(id) ON DELETE SET NULL;
 ALTER TABLE thread ADD COLUMN last_mail BIGINT REFERENCES mail(id) ON DELETE SET NULL;
-
+-- last mail a response reminder has been posted for
+ALTER TABLE thread ADD COLUMN reminded_mail BIGINT REFERENCES mail(id) ON DELETE SET NULL;
+-- last mail has been sent from one of the own addresses
+ALTER TABLE thread ADD COLUMN answered BOOLEAN NOT NULL DEFAULT FALSE;
+-- when the mail has been posted to matrix, read receipts are compared to it
+ALTER TABLE mail ADD COLUMN matrix_posted TIMESTAMP;
+-- sent by us to a third party via !forward, this doesn't answer the thread
+ALTER TABLE mail ADD COLUMN IF NOT EXISTS forwarded BOOLEAN NOT NULL DEFAULT FALSE;
+-- pages of the overview replace the single overview message
+ALTER TABLE room ADD COLUMN IF NOT EXISTS overview_message_ids TEXT[] NOT NULL DEFAULT '{}';
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'room' AND column_name = 'overview_message_id'
+    ) THEN
+        UPDATE room SET overview_message_ids = ARRAY[overview_message_id] WHERE overview_message_id IS NOT NULL;
+    END IF;
+END $$;
+ALTER TABLE room DROP COLUMN IF EXISTS overview_message_id;
@@ -27,13 +27,14 @@ type MailFetcher struct {
 	globalConfig   *config.MailConfig
 	client         *imapclient.Client
 	idleCommand    *imapclient.IdleCommand
-	isIdle         bool
+	isIdle         atomic.Bool
 	idleMutex      sync.Mutex
 	isReconnecting atomic.Bool
 
-	uidLast     uint32
+	uidLast     atomic.Uint32 // also read by the status command
 	uidValidity uint32
 	mailHandler *MailHandler
+	lastFetch   atomic.Int64 // unix timestamp of the last successful fetch
 
 	ctx              context.Context
 	cancel           context.CancelFunc
@@ -74,7 +75,7 @@ func (mf *MailFetcher) fetchMessages() []*Mail {
 	}
 	if ok, _ := mf.uidsValid(false); ok {
 		uid := imap.UIDSet{}
-		uid.AddRange(imap.UID(mf.uidLast+1), 0) // 0 means no upper limit
+		uid.AddRange(imap.UID(mf.uidLast.Load()+1), 0) // 0 means no upper limit
 		searchCriteria.UID = []imap.UIDSet{uid}
 	}
 	searchOptions := &imap.SearchOptions{
@@ -99,6 +100,7 @@ func (mf *MailFetcher) fetchMessages() []*Mail {
 	msgCount := int(search.Count)
 	mails := make([]*Mail, 0, msgCount)
 	if msgCount == 0 {
+		mf.lastFetch.Store(time.Now().Unix())
 		log.Infof("No new mails to fetch for %v", mf.name)
 		return mails
 	}
@@ -118,17 +120,18 @@ func (mf *MailFetcher) fetchMessages() []*Mail {
 		if mail != nil {
 			log.Infof("MailFetcher %v fetched: %v", mf.name, mail)
 			mails = append(mails, mail)
-			mf.uidLast = max(mf.uidLast, uint32(uids[i]))
+			mf.uidLast.Store(max(mf.uidLast.Load(), uint32(uids[i])))
 		}
 		mf.mailHandler.MailboxUpdated()
 	}
 	mf.saveState()
+	mf.lastFetch.Store(time.Now().Unix())
 	log.Infof("Done fetching %v messages from %v", len(mails), mf.name)
 	return mails
 }
 
 func (mf *MailFetcher) idle() bool {
-	if mf.isIdle {
+	if mf.isIdle.Load() {
 		return true
 	}
 	mf.idleMutex.Lock()
@@ -136,21 +139,21 @@ func (mf *MailFetcher) idle() bool {
 	cmd, err := mf.client.Idle()
 	if err != nil {
 		log.Errorf("Error going idle with MailFetcher %v: %v", mf.name, err)
-		mf.isIdle = false
+		mf.isIdle.Store(false)
 		time.Sleep(3 * time.Second)
 		mf.reconnect()
 		return false
 	}
 	mf.idleCommand = cmd
-	mf.isIdle = true
+	mf.isIdle.Store(true)
 	return true
 }
 
 func (mf *MailFetcher) revokeIdle() bool {
-	if !mf.isIdle {
+	if !mf.isIdle.Load() {
 		return true
 	}
-	mf.isIdle = false
+	mf.isIdle.Store(false)
 	if err := mf.idleCommand.Close(); err != nil {
 		log.Errorf("Error stopping idle of MailFetcher %v, retrying in 5s: %v", mf.name, err)
 		time.Sleep(3 * time.Second)
@@ -334,11 +337,12 @@ func (mf *MailFetcher) listMailboxes() {
 
 func (mf *MailFetcher) loadState() {
 	uidLast, uidValidity := mf.mailHandler.StateStorage.GetState(mf.ctx, mf.name)
-	mf.uidLast, mf.uidValidity = uidLast, uidValidity
+	mf.uidLast.Store(uidLast)
+	mf.uidValidity = uidValidity
 }
 
 func (mf *MailFetcher) saveState() {
-	mf.mailHandler.StateStorage.SaveState(mf.ctx, mf.name, mf.uidLast, mf.uidValidity)
+	mf.mailHandler.StateStorage.SaveState(mf.ctx, mf.name, mf.uidLast.Load(), mf.uidValidity)
 }
 
 func (mf *MailFetcher) queueFetch() {
@@ -401,6 +405,30 @@ func (mf *MailFetcher) logout() bool {
 	return true
 }
 
+func (mf *MailFetcher) Name() string {
+	return mf.name
+}
+
+func (mf *MailFetcher) IsIdle() bool {
+	return mf.isIdle.Load()
+}
+
+func (mf *MailFetcher) IsReconnecting() bool {
+	return mf.isReconnecting.Load()
+}
+
+func (mf *MailFetcher) UidLast() uint32 {
+	return mf.uidLast.Load()
+}
+
+// time of the last successful fetch, zero if there was none yet
+func (mf *MailFetcher) LastFetch() time.Time {
+	if unix := mf.lastFetch.Load(); unix != 0 {
+		return time.Unix(unix, 0)
+	}
+	return time.Time{}
+}
+
 func (mf *MailFetcher) Shutdown() {
 	mf.cancel()
 	mf.logout()
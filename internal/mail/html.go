@@ -0,0 +1,264 @@
+package mail
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	// tags that are kept as they are supported by matrix clients
+	allowedHtmlTags = map[atom.Atom]bool{
+		atom.A: true, atom.B: true, atom.Strong: true, atom.I: true, atom.Em: true, atom.U: true,
+		atom.S: true, atom.Del: true, atom.Strike: true, atom.Sub: true, atom.Sup: true,
+		atom.Code: true, atom.Pre: true, atom.Blockquote: true, atom.P: true, atom.Div: true,
+		atom.Br: true, atom.Hr: true, atom.Ul: true, atom.Ol: true, atom.Li: true,
+		atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+		atom.Table: true, atom.Caption: true, atom.Thead: true, atom.Tbody: true, atom.Tr: true,
+		atom.Th: true, atom.Td: true,
+	}
+	// tags that are dropped including their content
+	droppedHtmlTags = map[atom.Atom]bool{
+		atom.Head: true, atom.Script: true, atom.Style: true, atom.Title: true,
+		atom.Template: true, atom.Noscript: true, atom.Iframe: true, atom.Object: true,
+		atom.Svg: true, atom.Button: true, atom.Select: true, atom.Textarea: true,
+	}
+	// tags that are surrounded by newlines in the plain text version
+	blockHtmlTags = map[atom.Atom]bool{
+		atom.P: true, atom.Div: true, atom.Blockquote: true, atom.Pre: true, atom.Ul: true, atom.Ol: true,
+		atom.Table: true, atom.Caption: true,
+		atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	}
+
+	htmlNewlinesRegex = regexp.MustCompile(`[ \t]*\n\s*\n\s*`)
+	htmlSpacesRegex   = regexp.MustCompile(`[ \t\r\n\f]+`)
+	htmlLineRegex     = regexp.MustCompile(`[ \t]*\n[ \t]*`)
+	htmlTokenRegex    = regexp.MustCompile(`\s+|\S+`)
+)
+
+type htmlSanitizer struct {
+	text   *strings.Builder
+	html   *strings.Builder
+	pre    int
+	ranges map[*xhtml.Node][2]int // plain text written within each element
+	// only html within this range of the plain text is written if set
+	from, to int
+	limited  bool
+}
+
+func htmlAttr(node *xhtml.Node, key string) string {
+	for _, attr := range node.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func safeLink(href string) bool {
+	href = strings.ToLower(strings.TrimSpace(href))
+	return strings.HasPrefix(href, "https://") || strings.HasPrefix(href, "http://") || strings.HasPrefix(href, "mailto:")
+}
+
+func (s *htmlSanitizer) writeText(text string) {
+	if s.pre == 0 {
+		text = htmlSpacesRegex.ReplaceAllString(text, " ")
+	}
+	if !s.limited {
+		s.text.WriteString(text)
+		s.html.WriteString(html.EscapeString(text))
+		return
+	}
+	for _, token := range htmlTokenRegex.FindAllString(text, -1) {
+		start, end := s.text.Len(), s.text.Len()+len(token)
+		s.text.WriteString(token)
+		inside := start < s.to && end > s.from
+		if strings.TrimSpace(token) == "" { // whitespace only between words of the range
+			inside = start > s.from && end < s.to
+		}
+		if inside {
+			s.html.WriteString(html.EscapeString(token))
+		}
+	}
+}
+
+// whether the html of an element is part of the written range
+func (s *htmlSanitizer) visible(node *xhtml.Node) bool {
+	if !s.limited {
+		return true
+	}
+	r := s.ranges[node]
+	return r[0] < s.to && r[1] > s.from
+}
+
+func (s *htmlSanitizer) writeHtml(node *xhtml.Node, html string) {
+	if s.visible(node) {
+		s.html.WriteString(html)
+	}
+}
+
+func (s *htmlSanitizer) walkChildren(node *xhtml.Node) {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		s.walk(child)
+	}
+}
+
+func (s *htmlSanitizer) walk(node *xhtml.Node) {
+	switch node.Type {
+	case xhtml.TextNode:
+		s.writeText(node.Data)
+		return
+	case xhtml.DocumentNode:
+		s.walkChildren(node)
+		return
+	case xhtml.ElementNode:
+	default:
+		return
+	}
+	if droppedHtmlTags[node.DataAtom] {
+		return
+	}
+	if node.DataAtom == atom.Img { // inline images are uploaded separately
+		if alt := strings.TrimSpace(htmlAttr(node, "alt")); alt != "" {
+			s.writeText(fmt.Sprintf("[%s]", alt))
+		}
+		return
+	}
+	if !allowedHtmlTags[node.DataAtom] {
+		s.walkChildren(node)
+		return
+	}
+
+	start := s.text.Len()
+	defer func() {
+		if !s.limited {
+			s.ranges[node] = [2]int{start, s.text.Len()}
+		}
+	}()
+
+	// opening tag
+	tag := node.DataAtom.String()
+	href := htmlAttr(node, "href")
+	if blockHtmlTags[node.DataAtom] {
+		s.text.WriteString("\n")
+	}
+	switch node.DataAtom {
+	case atom.A:
+		if !safeLink(href) {
+			s.walkChildren(node)
+			return
+		}
+		s.writeHtml(node, fmt.Sprintf(`<a href="%s">`, html.EscapeString(href)))
+	case atom.Br:
+		s.text.WriteString("\n")
+		s.writeHtml(node, "<br>")
+		return
+	case atom.Hr:
+		s.text.WriteString("\n---\n")
+		s.writeHtml(node, "<hr>")
+		return
+	case atom.Li:
+		s.text.WriteString("\n- ")
+		s.writeHtml(node, "<li>")
+	case atom.Tr:
+		s.text.WriteString("\n")
+		s.writeHtml(node, "<tr>")
+	case atom.Td, atom.Th:
+		s.text.WriteString(" ")
+		s.writeHtml(node, fmt.Sprintf("<%s>", tag))
+	case atom.Pre:
+		s.pre++
+		s.writeHtml(node, "<pre>")
+	default:
+		s.writeHtml(node, fmt.Sprintf("<%s>", tag))
+	}
+
+	s.walkChildren(node)
+
+	// closing tag
+	switch node.DataAtom {
+	case atom.A:
+		if text := strings.TrimSpace(xhtmlText(node)); text != href && !strings.HasPrefix(href, "mailto:") {
+			s.text.WriteString(fmt.Sprintf(" (%s)", href))
+		}
+	case atom.Pre:
+		s.pre--
+	}
+	s.writeHtml(node, fmt.Sprintf("</%s>", tag))
+	if blockHtmlTags[node.DataAtom] {
+		s.text.WriteString("\n")
+	}
+}
+
+func xhtmlText(node *xhtml.Node) string {
+	if node.Type == xhtml.TextNode {
+		return node.Data
+	}
+	builder := new(strings.Builder)
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		builder.WriteString(xhtmlText(child))
+	}
+	return builder.String()
+}
+
+func parseSanitized(raw string) (*xhtml.Node, *htmlSanitizer) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	root, err := xhtml.Parse(strings.NewReader(raw))
+	if err != nil {
+		return nil, nil
+	}
+	s := &htmlSanitizer{
+		text: new(strings.Builder), html: new(strings.Builder), ranges: make(map[*xhtml.Node][2]int),
+	}
+	s.walk(root)
+	return root, s
+}
+
+// convert the html of a mail including its quoted history into the subset supported by matrix;
+// also returns a plain text version
+func SanitizeHtml(raw string) (text string, sanitized string) {
+	_, s := parseSanitized(raw)
+	if s == nil {
+		return "", ""
+	}
+	text = htmlLineRegex.ReplaceAllString(s.text.String(), "\n")
+	text = htmlNewlinesRegex.ReplaceAllString(text, "\n\n")
+	return strings.TrimSpace(text), strings.TrimSpace(s.html.String())
+}
+
+// sanitize only the part of the html making up `message`, a message extracted from the plain text version;
+// fails if the message can't be located ignoring whitespace
+func SanitizeHtmlMessage(raw string, message string) (sanitized string, ok bool) {
+	root, s := parseSanitized(raw)
+	if s == nil {
+		return "", false
+	}
+	text := s.text.String()
+	compact, offsets := new(strings.Builder), []int{}
+	for i, r := range text {
+		if !unicode.IsSpace(r) {
+			compact.WriteRune(r)
+			for range utf8.RuneLen(r) {
+				offsets = append(offsets, i)
+			}
+		}
+	}
+	compactMessage := strings.Join(strings.Fields(message), "")
+	index := strings.Index(compact.String(), compactMessage)
+	if compactMessage == "" || index < 0 {
+		return "", false
+	}
+	s.from, s.to, s.limited = offsets[index], offsets[index+len(compactMessage)-1]+1, true
+	s.text.Reset()
+	s.html.Reset()
+	s.walk(root)
+	return strings.TrimSpace(s.html.String()), true
+}
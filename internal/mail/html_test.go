@@ -0,0 +1,143 @@
+package mail
+
+import "testing"
+
+func TestSanitizeHtml(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		wantText string
+		wantHtml string
+	}{
+		{
+			"empty",
+			"  ",
+			"",
+			"",
+		},
+		{
+			"formatting",
+			"<html><head><style>p { color: red; }</style></head><body><p>Hello <b>there</b>,<br>see <i>below</i></p></body></html>",
+			"Hello there,\nsee below",
+			"<p>Hello <b>there</b>,<br>see <i>below</i></p>",
+		},
+		{
+			"unknown_tags",
+			`<center><font color="red"><span style="x">Big</span> news</font></center><script>alert(1)</script>`,
+			"Big news",
+			"Big news",
+		},
+		{
+			"links",
+			`<a href="https://example.com" onclick="x()">Website</a> <a href="javascript:alert(1)">evil</a>`,
+			"Website (https://example.com) evil",
+			`<a href="https://example.com">Website</a> evil`,
+		},
+		{
+			"lists",
+			"<ul>\n  <li>one</li>\n  <li>two</li>\n</ul>",
+			"- one\n- two",
+			"<ul> <li>one</li> <li>two</li> </ul>",
+		},
+		{
+			"table",
+			"<table><tr><td>Date</td><td>Sunday</td></tr></table>",
+			"Date Sunday",
+			"<table><tbody><tr><td>Date</td><td>Sunday</td></tr></tbody></table>",
+		},
+		{
+			"images",
+			`<p><img src="cid:logo" alt="Logo">Text &amp; more</p>`,
+			"[Logo]Text & more",
+			"<p>[Logo]Text &amp; more</p>",
+		},
+		{
+			"gmail_quote",
+			`<div>Sounds good</div><div class="gmail_quote">On Monday someone wrote:<blockquote>Old</blockquote></div>`,
+			"Sounds good\n\nOn Monday someone wrote:\nOld",
+			"<div>Sounds good</div><div>On Monday someone wrote:<blockquote>Old</blockquote></div>",
+		},
+		{
+			"inline_reply",
+			`<blockquote type="cite">Can you come?</blockquote><div>Yes, <b>at noon</b></div>`,
+			"Can you come?\n\nYes, at noon",
+			"<blockquote>Can you come?</blockquote><div>Yes, <b>at noon</b></div>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, html := SanitizeHtml(tt.raw)
+			if text != tt.wantText || html != tt.wantHtml {
+				t.Errorf("SanitizeHtml() = %q, %q, want %q, %q", text, html, tt.wantText, tt.wantHtml)
+			}
+		})
+	}
+}
+
+func TestSanitizeHtmlMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		message  string
+		wantHtml string
+		wantOk   bool
+	}{
+		{
+			"entire",
+			"<p>Hello <b>there</b>,<br>see <i>below</i></p>",
+			"Hello there,\nsee below",
+			"<p>Hello <b>there</b>,<br>see <i>below</i></p>",
+			true,
+		},
+		{
+			"gmail_quote",
+			`<div>Sounds <b>good</b></div><div class="gmail_quote">On Monday someone wrote:<blockquote>Old</blockquote></div>`,
+			"Sounds good",
+			"<div>Sounds <b>good</b></div>",
+			true,
+		},
+		{
+			"outlook_quote",
+			`<div>Thanks</div><hr><div id="divRplyFwdMsg">From: someone</div><div>Old message</div>`,
+			"Thanks",
+			"<div>Thanks</div>",
+			true,
+		},
+		{
+			"inline_reply",
+			`<blockquote type="cite">Can you come?</blockquote><div>Yes, <b>at noon</b></div><p>Bye</p>`,
+			"Yes, at noon",
+			"<div>Yes, <b>at noon</b></div>",
+			true,
+		},
+		{
+			"partial_text",
+			"<p>Hi all, the meeting moved.</p><p>Best, Bob</p>",
+			"the meeting moved.",
+			"<p>the meeting moved.</p>",
+			true,
+		},
+		{
+			"links",
+			`<p>See <a href="https://example.com">our website</a></p><p>Old</p>`,
+			"See our website (https://example.com)",
+			`<p>See <a href="https://example.com">our website</a></p>`,
+			true,
+		},
+		{
+			"not_found",
+			"<p>Hello there</p>",
+			"Something else",
+			"",
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, ok := SanitizeHtmlMessage(tt.raw, tt.message)
+			if html != tt.wantHtml || ok != tt.wantOk {
+				t.Errorf("SanitizeHtmlMessage() = %q, %v, want %q, %v", html, ok, tt.wantHtml, tt.wantOk)
+			}
+		})
+	}
+}
@@ -18,11 +18,23 @@ type Mail struct {
 	Subject     string
 	Date        time.Time
 	Text        string
+	Html        string
+	HtmlOnly    bool // Text has been converted from Html
 	MessageId   string
 	InReplyTo   string
 	References  []string
 	AddrTo      []string
+	AddrCc      []string
+	AddrReplyTo []string
 	Attachments []string
+	Files       []*Attachment // attachment contents to be uploaded to matrix
+}
+
+type Attachment struct {
+	Name        string
+	ContentType string
+	Content     []byte
+	Inline      bool
 }
 
 func (m *Mail) String() string {
@@ -97,10 +109,24 @@ func (mh *MailHandler) Setup(
 	log.Infof("Setup MailHandler")
 }
 
+func (mh *MailHandler) GetMailFetchers() []*MailFetcher {
+	return mh.fetchers
+}
+
 func (mh *MailHandler) GetMailSender(name string) *MailSender {
 	return mh.senders[name]
 }
 
+// get the configured own addresses (defaults to the addresses of all senders)
+func (mh *MailHandler) GetOwnAddresses() []string {
+	return mh.Config.OwnAddresses
+}
+
+// remove the own addresses
+func (mh *MailHandler) FilterOwnAddresses(addrs []string) []string {
+	return filterAddresses(addrs, mh.GetOwnAddresses())
+}
+
 func (mh *MailHandler) GetMailStorerFetcher(storer config.Storer) (fetcher *MailFetcher) {
 	name := fmt.Sprintf("%s:%s:store", storer.Source, storer.Mailbox)
 	return NewMailFetcher(name, storer.Mailbox, mh.Config.Sources[storer.Source], mh.Config, mh, nil)
@@ -1,11 +1,13 @@
 package mail
 
 import (
+	"fmt"
 	"regexp"
 	"slices"
 	"strings"
 	"time"
 
+	"github.com/arne314/inbox-collab/internal/config"
 	"github.com/emersion/go-imap/v2/imapclient"
 	"github.com/jhillyerd/enmime/v2"
 	log "github.com/sirupsen/logrus"
@@ -73,6 +75,26 @@ func parseDomain(header string) string {
 	return ""
 }
 
+// check the attachment upload limits of the config
+func allowAttachment(cfg *config.MailConfig, contentType string, size int) bool {
+	if cfg.AttachmentMaxSize <= 0 || float64(size) > cfg.AttachmentMaxSize*1024*1024 {
+		return false
+	}
+	if len(cfg.AttachmentTypes) == 0 {
+		return true
+	}
+	contentType = strings.ToLower(contentType)
+	for _, allowed := range cfg.AttachmentTypes {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if prefix, ok := strings.CutSuffix(allowed, "*"); ok && strings.HasPrefix(contentType, prefix) {
+			return true
+		} else if allowed == contentType {
+			return true
+		}
+	}
+	return false
+}
+
 func (mf *MailFetcher) parseMessage(msg *imapclient.FetchMessageData) *Mail {
 	var bodySection imapclient.FetchItemDataBodySection
 	ok := false
@@ -106,6 +128,28 @@ func (mf *MailFetcher) parseMessage(msg *imapclient.FetchMessageData) *Mail {
 	for i, att := range envelope.Attachments {
 		attachments[i] = att.FileName
 	}
+	text, htmlOnly := envelope.Text, slices.ContainsFunc(envelope.Errors, func(e *enmime.Error) bool {
+		return e.Name == enmime.ErrorPlainTextFromHTML
+	})
+	if htmlOnly { // prefer our own conversion, the extractor splits off the quoted history
+		if converted, _ := SanitizeHtml(envelope.HTML); converted != "" {
+			text = converted
+		}
+	}
+	files := []*Attachment{}
+	for i, part := range slices.Concat(envelope.Attachments, envelope.Inlines) {
+		if !allowAttachment(mf.globalConfig, part.ContentType, len(part.Content)) {
+			continue
+		}
+		name := part.FileName
+		if name == "" {
+			name = fmt.Sprintf("inline-%d", i+1)
+		}
+		files = append(files, &Attachment{
+			Name: name, ContentType: part.ContentType, Content: part.Content,
+			Inline: i >= len(envelope.Attachments),
+		})
+	}
 	parsedMail := &Mail{
 		Fetcher:     mf.name,
 		MessageId:   parseIds(envelope.GetHeader("Message-ID"), false)[0],
@@ -114,10 +158,15 @@ func (mf *MailFetcher) parseMessage(msg *imapclient.FetchMessageData) *Mail {
 		NameFrom:    parseNameFrom(envelope.GetHeader("From")),
 		AddrFrom:    parseAddresses(envelope.GetHeader("From"), false)[0],
 		AddrTo:      parseAddresses(envelope.GetHeader("To"), true),
+		AddrCc:      parseAddresses(envelope.GetHeader("Cc"), true),
+		AddrReplyTo: parseAddresses(envelope.GetHeader("Reply-To"), true),
 		Subject:     envelope.GetHeader("Subject"),
 		Date:        date.UTC(),
-		Text:        envelope.Text,
+		Text:        text,
+		Html:        envelope.HTML,
+		HtmlOnly:    htmlOnly,
 		Attachments: attachments,
+		Files:       files,
 	}
 	if parsedMail.MessageId == "" {
 		log.Errorf("Skipping invalid mail from fetcher %v: %v", mf.name, parsedMail)
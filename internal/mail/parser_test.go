@@ -3,6 +3,8 @@ package mail
 import (
 	"slices"
 	"testing"
+
+	"github.com/arne314/inbox-collab/internal/config"
 )
 
 func Test_parseAddresses(t *testing.T) {
@@ -217,3 +219,31 @@ func Test_parseDomain(t *testing.T) {
 		})
 	}
 }
+
+func Test_allowAttachment(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxSize     float64
+		types       []string
+		contentType string
+		size        int
+		want        bool
+	}{
+		{"disabled", 0, []string{}, "image/png", 10, false},
+		{"all_types", 1, []string{}, "application/zip", 1024, true},
+		{"too_large", 1, []string{}, "image/png", 2 * 1024 * 1024, false},
+		{"wildcard", 1, []string{"image/*"}, "image/jpeg", 1024, true},
+		{"exact", 1, []string{"image/*", "application/pdf"}, "application/pdf", 1024, true},
+		{"case", 1, []string{"Image/*"}, "image/PNG", 1024, true},
+		{"not_allowed", 1, []string{"image/*", "application/pdf"}, "application/zip", 1024, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.MailConfig{AttachmentMaxSize: tt.maxSize, AttachmentTypes: tt.types}
+			got := allowAttachment(cfg, tt.contentType, tt.size)
+			if got != tt.want {
+				t.Errorf("allowAttachment() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
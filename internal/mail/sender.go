@@ -3,6 +3,7 @@ package mail
 import (
 	"crypto/sha256"
 	"fmt"
+	"html"
 	"regexp"
 	"slices"
 	"strings"
@@ -70,29 +71,94 @@ func wrapHeaderAngles(headers ...string) []string {
 	return wrapped
 }
 
-func filterAddrCc(to string, cc []string) []string {
-	return slices.DeleteFunc(cc, func(c string) bool {
-		return parseAddresses(c, false)[0] == to
-	})
+// remove duplicates and addresses contained in `exclude`, display names are kept
+func filterAddresses(addrs []string, exclude []string) []string {
+	seen := map[string]bool{"": true}
+	for _, e := range exclude {
+		seen[parseAddresses(e, false)[0]] = true
+	}
+	filtered := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		addr := parseAddresses(a, false)[0]
+		if !seen[addr] {
+			seen[addr] = true
+			filtered = append(filtered, strings.TrimSpace(a)) // keep display names
+		}
+	}
+	return filtered
+}
+
+// combine `cc` with the configured cc addresses without repeating any of `to`
+func (ms *MailSender) ccRecipients(to []string, cc []string) []string {
+	return filterAddresses(slices.Concat(cc, ms.config.AddrCC), to)
 }
 
 func (ms *MailSender) createSimplemailEmail(mail *Mail) *simplemail.Email {
-	return simplemail.NewMSG().
+	email := simplemail.NewMSG().
 		SetFrom(ms.config.AddrFrom).
-		AddCc(filterAddrCc(mail.AddrTo[0], ms.config.AddrCC)...).
-		AddBcc(filterAddrCc(mail.AddrTo[0], ms.config.AddrBCC)...).
+		AddCc(mail.AddrCc...).
+		AddBcc(filterAddresses(ms.config.AddrBCC, slices.Concat(mail.AddrTo, mail.AddrCc))...).
 		AddHeader("Message-ID", wrapHeaderAngles(mail.MessageId)...).
-		AddHeader("References", wrapHeaderAngles(mail.References...)...).
-		AddHeader("In-Reply-To", wrapHeaderAngles(mail.InReplyTo)...).
-		SetSubject(mail.Subject).
-		SetBody(simplemail.TextPlain, mail.Text)
+		AddHeader("References", wrapHeaderAngles(mail.References...)...)
+	if mail.InReplyTo != "" { // forwarded mails aren't replies
+		email.AddHeader("In-Reply-To", wrapHeaderAngles(mail.InReplyTo)...)
+	}
+	email.SetSubject(mail.Subject).SetBody(simplemail.TextPlain, mail.Text)
+	if mail.Html != "" { // multipart/alternative with plain text fallback
+		email.AddAlternative(simplemail.TextHTML, fmt.Sprintf("<html><body>%s</body></html>", mail.Html))
+	}
+	for _, file := range mail.Files {
+		email.Attach(&simplemail.File{Name: file.Name, MimeType: file.ContentType, Data: file.Content, Inline: file.Inline})
+	}
+	return email
+}
+
+// build and send the mail via the logged in client
+func (ms *MailSender) sendMail(mail *Mail, addressee string) (raw string, err error) {
+	simplemailEmail := ms.createSimplemailEmail(mail).AddTo(addressee)
+	if simplemailEmail.Error != nil {
+		log.Errorf("MailSender %s failed to create an email: %v", ms.Name, simplemailEmail.Error)
+		return "", fmt.Errorf("failed to generate mail")
+	}
+	if err = simplemailEmail.Send(ms.client); err != nil {
+		log.Errorf("MailSender %s failed to send mail %s: %v", ms.Name, mail.MessageId, err)
+		return "", fmt.Errorf("failed to send mail")
+	}
+	return simplemailEmail.GetMessage(), nil
+}
+
+var (
+	replyStackRegex   *regexp.Regexp = regexp.MustCompile(`(?i)^(Re:\s*)+`)
+	forwardStackRegex *regexp.Regexp = regexp.MustCompile(`(?i)^((Fwd?|Wg):\s*)+`)
+)
+
+// the address replies should be sent to
+func ReplyAddress(addrFrom string, addrReplyTo []string) string {
+	if len(addrReplyTo) > 0 && addrReplyTo[0] != "" {
+		return addrReplyTo[0]
+	}
+	return addrFrom
 }
 
-var replyStackRegex *regexp.Regexp = regexp.MustCompile(`(?i)^(Re:\s*)+`)
+// combine the reply with the cited original mail as plain text and html
+func formatReply(reply string, replyHtml string, cite string, citeHead string) (content string, contentHtml string) {
+	if replyHtml == "" {
+		replyHtml = strings.ReplaceAll(html.EscapeString(reply), "\n", "<br>")
+	}
+	if strings.TrimSpace(cite) == "" {
+		return reply, replyHtml
+	}
+	cite = normalizeMessage(cite)
+	content = fmt.Sprintf("%s\n\n%s:%s", reply, citeHead, strings.ReplaceAll("\n"+cite, "\n", "\n> "))
+	contentHtml = fmt.Sprintf("%s<br><br>%s:<br><blockquote type=\"cite\">%s</blockquote>", replyHtml,
+		html.EscapeString(citeHead), strings.ReplaceAll(html.EscapeString(cite), "\n", "<br>"))
+	return
+}
 
-// login and send mail via smtp
-func (ms *MailSender) SendReplyMail(reply string, cite string, originalSubject string,
+// login and send mail via smtp; `replyHtml` is the rendered version of `reply` and optional
+func (ms *MailSender) SendReplyMail(reply string, replyHtml string, cite string, originalSubject string,
 	originalTimestamp time.Time, originalId string, originalReferences []string, nameTo string, addrTo string,
+	addrReplyTo []string, addrCc []string, files []*Attachment,
 ) (mail *Mail, replyMessage string, raw string, err error) {
 	// authentication
 	ms.sendMutex.Lock()
@@ -104,54 +170,137 @@ func (ms *MailSender) SendReplyMail(reply string, cite string, originalSubject s
 	defer ms.logout()
 
 	// format text
-	var addressee, citeAuthor, content, subject string
+	var addressee, citeAuthor, subject string
+	recipient := ReplyAddress(addrTo, addrReplyTo)
+	if len(addrReplyTo) > 1 { // address all of them
+		addrCc = slices.Concat(addrReplyTo[1:], addrCc)
+	}
 	if nameTo != "" {
-		addressee = fmt.Sprintf("%s <%s>", nameTo, addrTo)
+		addressee = recipient
+		if recipient == addrTo { // name doesn't belong to a reply to address
+			addressee = fmt.Sprintf("%s <%s>", nameTo, recipient)
+		}
 		citeAuthor = nameTo
 	} else {
-		addressee = addrTo
+		addressee = recipient
 		citeAuthor = addrTo
 	}
 	subject = fmt.Sprintf("Re: %s", replyStackRegex.ReplaceAllString(strings.TrimSpace(originalSubject), ""))
 	reply = normalizeMessage(reply)
-	if strings.TrimSpace(cite) != "" {
-		cite = strings.ReplaceAll("\n"+normalizeMessage(cite), "\n", "\n> ")
-		zone, _ := time.LoadLocation(ms.mailConfig.Timezone) // timezone has already been validated
-		formatTime := originalTimestamp.In(zone).Format("2 Jan 2006 15:04")
-		content = fmt.Sprintf("%s\n\n%s, %s:%s", reply, citeAuthor, formatTime, cite)
-	} else {
-		content = reply
-	}
+	zone, _ := time.LoadLocation(ms.mailConfig.Timezone) // timezone has already been validated
+	citeHead := fmt.Sprintf("%s, %s", citeAuthor, originalTimestamp.In(zone).Format("2 Jan 2006 15:04"))
+	content, contentHtml := formatReply(reply, replyHtml, cite, citeHead)
 	replyMessage = reply
 
 	// create mail
+	attachments := make([]string, len(files))
+	for i, file := range files {
+		attachments[i] = file.Name
+	}
 	mail = &Mail{
 		MessageId:   ms.generateMessageId(content),
 		InReplyTo:   originalId,
 		References:  append(originalReferences, originalId),
 		NameFrom:    ms.authorName,
 		AddrFrom:    ms.authorAddr,
-		AddrTo:      []string{addrTo},
+		AddrTo:      []string{recipient},
+		AddrCc:      ms.ccRecipients([]string{recipient}, addrCc),
 		Subject:     subject,
 		Date:        time.Now().UTC(),
 		Text:        content,
-		Attachments: []string{},
+		Html:        contentHtml,
+		Attachments: attachments,
+		Files:       files,
 	}
-	simplemailEmail := ms.createSimplemailEmail(mail).AddTo(addressee)
-	if simplemailEmail.Error != nil {
-		log.Errorf("MailSender %s failed to create a reply email: %v", ms.Name, simplemailEmail.Error)
-		err = fmt.Errorf("failed to generate mail")
+
+	// send mail
+	if raw, err = ms.sendMail(mail, addressee); err != nil {
 		return
 	}
+	log.Infof("MailSender %s successfully replied to mail %s", ms.Name, originalId)
+	return
+}
+
+// login and forward a mail including its most important headers and its `Files` via smtp;
+// `commentHtml` is the rendered version of `comment` and optional
+func (ms *MailSender) SendForwardMail(comment string, commentHtml string, original *Mail, addrTo string,
+) (mail *Mail, forwardMessage string, raw string, err error) {
+	// authentication
+	ms.sendMutex.Lock()
+	defer ms.sendMutex.Unlock()
+	if !ms.login() {
+		err = fmt.Errorf("failed to login")
+		return
+	}
+	defer ms.logout()
+
+	// format text
+	subject := fmt.Sprintf("Fwd: %s", forwardStackRegex.ReplaceAllString(strings.TrimSpace(original.Subject), ""))
+	comment = normalizeMessage(comment)
+	content, contentHtml := formatForwardedMail(comment, commentHtml, original, ms.mailConfig.Timezone)
+	forwardMessage = comment
+	if forwardMessage == "" {
+		forwardMessage = fmt.Sprintf("Forwarded to %s", addrTo)
+	}
+
+	// create mail
+	mail = &Mail{
+		MessageId:   ms.generateMessageId(content),
+		References:  append(original.References, original.MessageId),
+		NameFrom:    ms.authorName,
+		AddrFrom:    ms.authorAddr,
+		AddrTo:      []string{addrTo},
+		AddrCc:      ms.ccRecipients([]string{addrTo}, []string{}),
+		Subject:     subject,
+		Date:        time.Now().UTC(),
+		Text:        content,
+		Html:        contentHtml,
+		Attachments: original.Attachments,
+		Files:       original.Files,
+	}
 
 	// send mail
-	if err = simplemailEmail.Send(ms.client); err != nil {
-		log.Errorf("MailSender %s failed to reply to mail %s: %v", ms.Name, originalId, err)
-		err = fmt.Errorf("failed to send mail")
+	if raw, err = ms.sendMail(mail, addrTo); err != nil {
 		return
 	}
-	raw = simplemailEmail.GetMessage()
-	log.Infof("MailSender %s successfully replied to mail %s", ms.Name, originalId)
+	log.Infof("MailSender %s successfully forwarded mail %s to %s", ms.Name, original.MessageId, addrTo)
+	return
+}
+
+// format the forwarded mail below the comment as plain text and html
+func formatForwardedMail(comment string, commentHtml string, original *Mail, timezone string,
+) (content string, contentHtml string) {
+	zone, _ := time.LoadLocation(timezone) // timezone has already been validated
+	from := original.AddrFrom
+	if original.NameFrom != "" {
+		from = fmt.Sprintf("%s <%s>", original.NameFrom, original.AddrFrom)
+	}
+	headers := []string{"---------- Forwarded message ----------"}
+	headers = append(headers, fmt.Sprintf("From: %s", from))
+	headers = append(headers, fmt.Sprintf("Date: %s", original.Date.In(zone).Format("2 Jan 2006 15:04")))
+	headers = append(headers, fmt.Sprintf("Subject: %s", strings.TrimSpace(original.Subject)))
+	headers = append(headers, fmt.Sprintf("To: %s", strings.Join(original.AddrTo, ", ")))
+	if len(original.AddrCc) > 0 {
+		headers = append(headers, fmt.Sprintf("Cc: %s", strings.Join(original.AddrCc, ", ")))
+	}
+	if len(original.Attachments) > 0 {
+		headers = append(headers, fmt.Sprintf("Attachments: %s", strings.Join(original.Attachments, ", ")))
+	}
+	text := normalizeMessage(original.Text)
+	content = strings.Join(headers, "\n") + "\n" + strings.ReplaceAll("\n"+text, "\n", "\n> ")
+	bodyHtml := original.Html
+	if bodyHtml == "" {
+		bodyHtml = strings.ReplaceAll(html.EscapeString(text), "\n", "<br>")
+	}
+	contentHtml = fmt.Sprintf("%s<br><br><blockquote type=\"cite\">%s</blockquote>",
+		strings.ReplaceAll(html.EscapeString(strings.Join(headers, "\n")), "\n", "<br>"), bodyHtml)
+	if comment != "" {
+		if commentHtml == "" {
+			commentHtml = strings.ReplaceAll(html.EscapeString(comment), "\n", "<br>")
+		}
+		content = comment + "\n\n" + content
+		contentHtml = commentHtml + "<br><br>" + contentHtml
+	}
 	return
 }
 
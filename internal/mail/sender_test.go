@@ -0,0 +1,246 @@
+package mail
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/arne314/inbox-collab/internal/config"
+)
+
+func Test_filterAddresses(t *testing.T) {
+	tests := []struct {
+		name    string
+		addrs   []string
+		exclude []string
+		want    []string
+	}{
+		{
+			"none",
+			[]string{},
+			[]string{"mail@example.com"},
+			[]string{},
+		},
+		{
+			"exclude",
+			[]string{"mail@example.com", "other@example.com"},
+			[]string{"Mail <MAIL@example.com>"},
+			[]string{"other@example.com"},
+		},
+		{
+			"duplicates",
+			[]string{"Someone <some@example.com>", "some@example.com", "other@example.com"},
+			[]string{},
+			[]string{"Someone <some@example.com>", "other@example.com"},
+		},
+		{
+			"invalid",
+			[]string{"no address", "mail@example.com"},
+			[]string{},
+			[]string{"mail@example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := filterAddresses(tt.addrs, tt.exclude)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("filterAddresses() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ccRecipients(t *testing.T) {
+	ms := &MailSender{config: &config.MailSenderConfig{AddrCC: []string{"Team <team@example.com>", "archive@example.com"}}}
+	tests := []struct {
+		name string
+		to   []string
+		cc   []string
+		want []string
+	}{
+		{
+			"configured",
+			[]string{"customer@example.com"},
+			[]string{},
+			[]string{"Team <team@example.com>", "archive@example.com"},
+		},
+		{
+			"combined",
+			[]string{"customer@example.com"},
+			[]string{"Colleague <colleague@example.com>", " other@example.com "},
+			[]string{"Colleague <colleague@example.com>", "other@example.com", "Team <team@example.com>", "archive@example.com"},
+		},
+		{
+			"recipient",
+			[]string{"Team <TEAM@example.com>"},
+			[]string{"team@example.com"},
+			[]string{"archive@example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ms.ccRecipients(tt.to, tt.cc)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ccRecipients() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplyAddress(t *testing.T) {
+	tests := []struct {
+		name        string
+		addrFrom    string
+		addrReplyTo []string
+		want        string
+	}{
+		{
+			"no_reply_to",
+			"mail@example.com",
+			[]string{},
+			"mail@example.com",
+		},
+		{
+			"reply_to",
+			"noreply@example.com",
+			[]string{"contact@example.com"},
+			"contact@example.com",
+		},
+		{
+			"multiple",
+			"noreply@example.com",
+			[]string{"contact@example.com", "other@example.com"},
+			"contact@example.com",
+		},
+		{
+			"invalid",
+			"mail@example.com",
+			[]string{""},
+			"mail@example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReplyAddress(tt.addrFrom, tt.addrReplyTo); got != tt.want {
+				t.Errorf("ReplyAddress() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_formatReply(t *testing.T) {
+	tests := []struct {
+		name      string
+		reply     string
+		replyHtml string
+		cite      string
+		wantText  string
+		wantHtml  string
+	}{
+		{
+			"plain",
+			"Thanks!\nSee you",
+			"",
+			"",
+			"Thanks!\nSee you",
+			"Thanks!<br>See you",
+		},
+		{
+			"rendered",
+			"**Thanks**",
+			"<strong>Thanks</strong>",
+			" ",
+			"**Thanks**",
+			"<strong>Thanks</strong>",
+		},
+		{
+			"cite",
+			"Sure",
+			"Sure",
+			"Can you <help>?\r\nBest",
+			"Sure\n\nSomeone, 1 Jan 2026 10:00:\n> Can you <help>?\n> Best",
+			"Sure<br><br>Someone, 1 Jan 2026 10:00:<br><blockquote type=\"cite\">Can you &lt;help&gt;?<br>Best</blockquote>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, html := formatReply(tt.reply, tt.replyHtml, tt.cite, "Someone, 1 Jan 2026 10:00")
+			if text != tt.wantText || html != tt.wantHtml {
+				t.Errorf("formatReply() = %q, %q, want %q, %q", text, html, tt.wantText, tt.wantHtml)
+			}
+		})
+	}
+}
+
+func Test_formatForwardedMail(t *testing.T) {
+	date := time.Date(2026, time.January, 1, 9, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		comment     string
+		commentHtml string
+		original    *Mail
+		want        string
+		wantHtml    string
+	}{
+		{
+			"plain",
+			"",
+			"",
+			&Mail{
+				AddrFrom: "customer@example.com", Subject: " Question ", Date: date,
+				AddrTo: []string{"support@example.com"}, Text: "Hello <you>\r\nBye\r\n",
+			},
+			"---------- Forwarded message ----------\n" +
+				"From: customer@example.com\n" +
+				"Date: 1 Jan 2026 10:30\n" +
+				"Subject: Question\n" +
+				"To: support@example.com\n" +
+				"\n> Hello <you>\n> Bye",
+			"---------- Forwarded message ----------<br>" +
+				"From: customer@example.com<br>" +
+				"Date: 1 Jan 2026 10:30<br>" +
+				"Subject: Question<br>" +
+				"To: support@example.com<br><br>" +
+				`<blockquote type="cite">Hello &lt;you&gt;<br>Bye</blockquote>`,
+		},
+		{
+			"full",
+			"Please have a look",
+			"<p>Please have a <strong>look</strong></p>",
+			&Mail{
+				NameFrom: "Customer", AddrFrom: "customer@example.com", Subject: "Invoice", Date: date,
+				AddrTo: []string{"support@example.com", "sales@example.com"}, AddrCc: []string{"boss@example.com"},
+				Attachments: []string{"invoice.pdf"}, Text: "See attached", Html: "<p>See <em>attached</em></p>",
+			},
+			"Please have a look\n\n" +
+				"---------- Forwarded message ----------\n" +
+				"From: Customer <customer@example.com>\n" +
+				"Date: 1 Jan 2026 10:30\n" +
+				"Subject: Invoice\n" +
+				"To: support@example.com, sales@example.com\n" +
+				"Cc: boss@example.com\n" +
+				"Attachments: invoice.pdf\n" +
+				"\n> See attached",
+			"<p>Please have a <strong>look</strong></p><br><br>" +
+				"---------- Forwarded message ----------<br>" +
+				"From: Customer &lt;customer@example.com&gt;<br>" +
+				"Date: 1 Jan 2026 10:30<br>" +
+				"Subject: Invoice<br>" +
+				"To: support@example.com, sales@example.com<br>" +
+				"Cc: boss@example.com<br>" +
+				"Attachments: invoice.pdf<br><br>" +
+				`<blockquote type="cite"><p>See <em>attached</em></p></blockquote>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotHtml := formatForwardedMail(tt.comment, tt.commentHtml, tt.original, "Europe/Berlin")
+			if got != tt.want {
+				t.Errorf("formatForwardedMail() = %q, want %q", got, tt.want)
+			}
+			if gotHtml != tt.wantHtml {
+				t.Errorf("formatForwardedMail() html = %q, want %q", gotHtml, tt.wantHtml)
+			}
+		})
+	}
+}
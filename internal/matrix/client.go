@@ -14,6 +14,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"go.mau.fi/util/dbutil"
 	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/crypto/attachment"
 	"maunium.net/go/mautrix/crypto/cryptohelper"
 	"maunium.net/go/mautrix/crypto/verificationhelper"
 	"maunium.net/go/mautrix/event"
@@ -105,6 +106,22 @@ func (mc *MatrixClient) ShowSAS(
 	}()
 }
 
+// mark the threads users have read as seen
+func (mc *MatrixClient) processReceipts(ctx context.Context, evt *event.Event) {
+	for eventId, receipts := range *evt.Content.AsReceipt() {
+		for userId, receipt := range receipts[event.ReceiptTypeRead] {
+			if userId.String() == mc.Config.Username {
+				continue
+			}
+			seenId := eventId
+			if receipt.ThreadID != "" && receipt.ThreadID != event.ReadReceiptThreadMain {
+				seenId = receipt.ThreadID // threaded receipts reference the thread root
+			}
+			mc.commandHandler.Actions.ThreadSeen(ctx, evt.RoomID.String(), seenId.String(), userId.String(), receipt.Timestamp)
+		}
+	}
+}
+
 func (mc *MatrixClient) Login(ctx context.Context, actions Actions) {
 	client, err := mautrix.NewClient(mc.Config.HomeServer, "", "")
 	client.DefaultHTTPRetries = 3
@@ -127,6 +144,25 @@ func (mc *MatrixClient) Login(ctx context.Context, actions Actions) {
 		}
 	})
 
+	// listen for reactions
+	syncer.OnEventType(event.EventReaction, func(ctx context.Context, evt *event.Event) {
+		if sender := evt.Sender.String(); sender != mc.Config.Username {
+			mc.commandHandler.ProcessReaction(ctx, evt)
+		}
+	})
+
+	// listen for redactions
+	syncer.OnEventType(event.EventRedaction, func(ctx context.Context, evt *event.Event) {
+		if sender := evt.Sender.String(); sender != mc.Config.Username {
+			mc.commandHandler.ProcessRedaction(ctx, evt)
+		}
+	})
+
+	// listen for read receipts
+	syncer.OnEventType(event.EphemeralEventReceipt, func(ctx context.Context, evt *event.Event) {
+		mc.processReceipts(ctx, evt)
+	})
+
 	syncer.OnEventType(event.StateMember, func(ctx context.Context, evt *event.Event) {
 		// accept room invites
 		if evt.GetStateKey() == client.UserID.String() &&
@@ -282,8 +318,9 @@ func (mc *MatrixClient) SendRoomMessage(roomId string, text string, html string)
 	return true, resp.EventID.String(), nil
 }
 
+// send a thread message that notifies the `mentions` users if any are given
 func (mc *MatrixClient) SendThreadMessage(
-	roomId string, threadId string, text string, html string, ignoreRedacted bool,
+	roomId string, threadId string, text string, html string, ignoreRedacted bool, mentions ...string,
 ) (ok bool, redacted bool, eventId string, err error) {
 	if !ignoreRedacted && mc.MessageRedacted(roomId, threadId) {
 		redacted = true
@@ -291,21 +328,23 @@ func (mc *MatrixClient) SendThreadMessage(
 	}
 	ctx, cancel := mc.defaultContext()
 	defer cancel()
-	resp, err := mc.client.SendMessageEvent(
-		ctx,
-		id.RoomID(roomId),
-		event.EventMessage,
-		&event.MessageEventContent{
-			MsgType:       event.MsgText,
-			Body:          text,
-			Format:        event.FormatHTML,
-			FormattedBody: html,
-			RelatesTo: &event.RelatesTo{
-				EventID: id.EventID(threadId),
-				Type:    event.RelThread,
-			},
+	content := &event.MessageEventContent{
+		MsgType:       event.MsgText,
+		Body:          text,
+		Format:        event.FormatHTML,
+		FormattedBody: html,
+		RelatesTo: &event.RelatesTo{
+			EventID: id.EventID(threadId),
+			Type:    event.RelThread,
 		},
-	)
+	}
+	if len(mentions) > 0 {
+		content.Mentions = &event.Mentions{}
+		for _, userId := range mentions {
+			content.Mentions.UserIDs = append(content.Mentions.UserIDs, id.UserID(userId))
+		}
+	}
+	resp, err := mc.client.SendMessageEvent(ctx, id.RoomID(roomId), event.EventMessage, content)
 	if err != nil {
 		log.Errorf("Error sending to thread on matrix: %v", err)
 		SleepOnRateLimit(err)
@@ -314,6 +353,177 @@ func (mc *MatrixClient) SendThreadMessage(
 	return true, false, resp.EventID.String(), nil
 }
 
+// upload a file (encrypted if required by the room) and post it as a reply within a thread
+func (mc *MatrixClient) SendThreadFile(
+	roomId string, threadId string, replyToId string, fileName string, contentType string, data []byte,
+) (ok bool, eventId string) {
+	ctx, cancel := mc.defaultContext()
+	defer cancel()
+	content := &event.MessageEventContent{
+		MsgType:   event.MsgFile,
+		Body:      fileName,
+		FileName:  fileName,
+		Info:      &event.FileInfo{MimeType: contentType, Size: len(data)},
+		RelatesTo: (&event.RelatesTo{}).SetThread(id.EventID(threadId), id.EventID(replyToId)),
+	}
+	content.RelatesTo.IsFallingBack = false // the file belongs to the mail it replies to
+	if strings.HasPrefix(contentType, "image/") {
+		content.MsgType = event.MsgImage
+	}
+
+	encrypted, err := mc.client.StateStore.IsEncrypted(ctx, id.RoomID(roomId))
+	if err != nil {
+		log.Errorf("Error checking encryption state of room %v: %v", roomId, err)
+		return
+	}
+	upload, uploadType := data, contentType
+	var file *attachment.EncryptedFile
+	if encrypted {
+		file = attachment.NewEncryptedFile()
+		upload, uploadType = file.Encrypt(data), "application/octet-stream"
+	}
+	resp, err := mc.client.UploadBytesWithName(ctx, upload, uploadType, fileName)
+	if err != nil {
+		log.Errorf("Error uploading attachment %v to matrix: %v", fileName, err)
+		SleepOnRateLimit(err)
+		return
+	}
+	if encrypted {
+		content.File = &event.EncryptedFileInfo{EncryptedFile: *file, URL: resp.ContentURI.CUString()}
+	} else {
+		content.URL = resp.ContentURI.CUString()
+	}
+
+	sent, err := mc.client.SendMessageEvent(ctx, id.RoomID(roomId), event.EventMessage, content)
+	if err != nil {
+		log.Errorf("Error sending attachment to thread on matrix: %v", err)
+		SleepOnRateLimit(err)
+		return
+	}
+	return true, sent.EventID.String()
+}
+
+type File struct {
+	Name        string
+	ContentType string
+	Content     []byte
+}
+
+// get the content of a message event while decrypting it if required; nil for other events
+func (mc *MatrixClient) messageContent(ctx context.Context, evt *event.Event) *event.MessageEventContent {
+	if err := evt.Content.ParseRaw(evt.Type); err != nil && !errors.Is(err, event.ErrContentAlreadyParsed) {
+		return nil
+	}
+	if evt.Type == event.EventEncrypted {
+		decrypted, err := mc.cryptoHelper.Decrypt(ctx, evt)
+		if err != nil {
+			log.Errorf("Error decrypting event %v: %v", evt.ID, err)
+			return nil
+		}
+		if err = decrypted.Content.ParseRaw(decrypted.Type); err != nil && !errors.Is(err, event.ErrContentAlreadyParsed) {
+			return nil
+		}
+		evt = decrypted
+	}
+	if evt.Type != event.EventMessage {
+		return nil
+	}
+	return evt.Content.AsMessage()
+}
+
+func isFileContent(content *event.MessageEventContent) bool {
+	if content == nil || (content.URL == "" && content.File == nil) {
+		return false
+	}
+	switch content.MsgType {
+	case event.MsgFile, event.MsgImage, event.MsgVideo, event.MsgAudio:
+		return true
+	}
+	return false
+}
+
+func (mc *MatrixClient) IsFileMessage(roomId string, messageId string) bool {
+	ctx, cancel := mc.defaultContext()
+	defer cancel()
+	evt, err := mc.client.GetEvent(ctx, id.RoomID(roomId), id.EventID(messageId))
+	if err != nil {
+		log.Errorf("Error getting message %v from matrix: %v", messageId, err)
+		return false
+	}
+	return isFileContent(mc.messageContent(ctx, evt))
+}
+
+// get the files members uploaded to a thread before `beforeId` since the last posted mail
+func (mc *MatrixClient) GetThreadFiles(roomId string, threadId string, beforeId string, mailIds []string) []string {
+	ctx, cancel := mc.defaultContext()
+	defer cancel()
+	files := []string{}
+	before := false
+	req := &mautrix.ReqGetRelations{RelationType: event.RelThread, Dir: mautrix.DirectionBackward, Limit: 50}
+	for range 10 {
+		resp, err := mc.client.GetRelations(ctx, id.RoomID(roomId), id.EventID(threadId), req)
+		if err != nil {
+			log.Errorf("Error getting messages of thread %v in room %v: %v", threadId, roomId, err)
+			break
+		}
+		for _, evt := range resp.Chunk {
+			if !before {
+				before = evt.ID.String() == beforeId
+				continue
+			}
+			if slices.Contains(mailIds, evt.ID.String()) { // other bot messages like notes don't end the window
+				slices.Reverse(files)
+				return files
+			}
+			if evt.Sender != id.UserID(mc.Config.Username) && isFileContent(mc.messageContent(ctx, evt)) {
+				files = append(files, evt.ID.String()) // attachments of mails are uploaded by the bot
+			}
+		}
+		if resp.NextBatch == "" {
+			break
+		}
+		req.From = resp.NextBatch
+	}
+	slices.Reverse(files)
+	return files
+}
+
+// download and decrypt a file message
+func (mc *MatrixClient) DownloadFile(roomId string, messageId string) (*File, error) {
+	ctx, cancel := mc.defaultContext()
+	defer cancel()
+	evt, err := mc.client.GetEvent(ctx, id.RoomID(roomId), id.EventID(messageId))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the file message: %w", err)
+	}
+	content := mc.messageContent(ctx, evt)
+	if !isFileContent(content) {
+		return nil, fmt.Errorf("message %v is not a file", messageId)
+	}
+	uri := content.URL
+	if content.File != nil {
+		uri = content.File.URL
+	}
+	parsed, err := uri.Parse()
+	if err != nil {
+		return nil, fmt.Errorf("invalid file url %v: %w", uri, err)
+	}
+	data, err := mc.client.DownloadBytes(ctx, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file %v: %w", content.GetFileName(), err)
+	}
+	if content.File != nil {
+		if err = content.File.DecryptInPlace(data); err != nil {
+			return nil, fmt.Errorf("failed to decrypt file %v: %w", content.GetFileName(), err)
+		}
+	}
+	file := &File{Name: content.GetFileName(), Content: data}
+	if content.Info != nil {
+		file.ContentType = content.Info.MimeType
+	}
+	return file, nil
+}
+
 func (mc *MatrixClient) RedactMessage(roomId, messageId string) bool {
 	ctx, cancel := mc.defaultContext()
 	defer cancel()
@@ -440,6 +650,17 @@ func parseRelationEventContent(content any) (res relationEventContent, ok bool)
 	return res, true
 }
 
+func (mc *MatrixClient) GetPowerLevel(roomId, userId string) int {
+	ctx, cancel := mc.defaultContext()
+	defer cancel()
+	var levels event.PowerLevelsEventContent
+	if err := mc.client.StateEvent(ctx, id.RoomID(roomId), event.StatePowerLevels, "", &levels); err != nil {
+		log.Errorf("Error getting power levels of room %v: %v", roomId, err)
+		return 0
+	}
+	return levels.GetUserLevel(id.UserID(userId))
+}
+
 // gets the original message id in case of edits
 func (mc *MatrixClient) GetOriginalMessageId(roomId, messageId string) string {
 	ctx, cancel := mc.defaultContext()
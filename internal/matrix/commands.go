@@ -3,10 +3,15 @@ package matrix
 import (
 	"context"
 	"fmt"
+	"maps"
+	"net/mail"
+	"net/url"
 	"regexp"
 	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 	"unicode"
 
 	log "github.com/sirupsen/logrus"
@@ -19,14 +24,60 @@ type Actions interface {
 	OpenThread(ctx context.Context, roomId string, threadId string) bool
 	CloseThread(ctx context.Context, roomId string, threadId string) bool
 	ForceCloseThread(ctx context.Context, roomId string, threadId string) bool
+	AssignThread(ctx context.Context, roomId string, threadId string, assignee string) bool
+	UnassignThread(ctx context.Context, roomId string, threadId string) bool
+	SnoozeThread(ctx context.Context, roomId string, threadId string, until time.Time) bool
+	TagThread(ctx context.Context, roomId string, threadId string, labels []string) bool
+	UntagThread(ctx context.Context, roomId string, threadId string, labels []string) bool
+	AddNote(ctx context.Context, roomId string, threadId string, author string, text string) bool
 	MoveThread(ctx context.Context, roomId string, threadId string, query string) bool
-	ReplyToMailInThread(ctx context.Context, roomId string, originalId string, replyToId string, text string, cite bool) error
+	MergeThread(ctx context.Context, roomId string, threadId string, otherThreadId string) bool
+	SplitThread(ctx context.Context, roomId string, threadId string, mailId string, includeLater bool) error
+	SearchThreads(ctx context.Context, roomId string, query SearchQuery) ([]*SearchResult, error)
+	IsThreadRoot(ctx context.Context, roomId string, messageId string) bool
+	ThreadSeen(ctx context.Context, roomId string, eventId string, reader string, seen time.Time)
+	GetThreadReaders(ctx context.Context, roomId string, threadId string) ([]*ThreadReader, error)
+	GetThreadMailIds(ctx context.Context, roomId string, threadId string) []string
+	ReplyToMailInThread(ctx context.Context, roomId string, threadId string, originalId string,
+		replyToId string, author string, text string, cite bool, replyAll bool, files []string) (state CommandState, err error)
+	ForwardMail(ctx context.Context, roomId string, threadId string, originalId string,
+		mailId string, author string, addrTo string, comment string) (awaitingApproval bool, err error)
+	ApproveReply(ctx context.Context, roomId string, messageId string, approver string)
+	ScheduleReply(ctx context.Context, roomId string, threadId string, originalId string, replyToId string,
+		author string, text string, cite bool, replyAll bool, files []string, sendAt time.Time) (awaitingApproval bool, err error)
+	CancelScheduledReply(ctx context.Context, roomId string, commandId string, canceller string,
+		mayCancelOthers func() bool, redacted bool)
 	ResendThreadOverview(ctx context.Context, roomId string) bool
 	ResendThreadOverviewAll(ctx context.Context) bool
+	GetStatus(ctx context.Context) *Status
 }
 
 type CommandState int
 
+type ThreadReader struct {
+	User       string
+	Seen       time.Time
+	SeenLatest bool // read receipt after the latest mail
+}
+
+type SearchQuery struct {
+	Text   string
+	From   string
+	Room   string
+	Before time.Time
+	After  time.Time
+}
+
+type SearchResult struct {
+	RoomId    string
+	ThreadId  string
+	Author    string
+	Subject   string
+	Snippet   string
+	Timestamp time.Time
+	Open      bool
+}
+
 type CommandConfig struct {
 	name          string
 	aliases       []string
@@ -34,6 +85,7 @@ type CommandConfig struct {
 	triggerOnEdit bool
 	thread        bool
 	admin         bool
+	sendsMail     bool
 }
 
 const (
@@ -41,6 +93,8 @@ const (
 	Pending
 	Done
 	Error
+	AwaitingApproval
+	Scheduled
 )
 
 var (
@@ -61,20 +115,90 @@ var (
 			name: "open", aliases: []string{"o"}, thread: true,
 			description: "Manually reopen a closed thread.",
 		},
+		{
+			name: "snooze", thread: true,
+			description: "Close a thread and automatically reopen it later unless it receives a new mail before. " +
+				"Usage: `!snooze <duration like 3d or 1d12h, date like 2026-11-01 or weekday>`",
+		},
+		{
+			name: "claim", thread: true,
+			description: "Assign a thread to yourself.",
+		},
+		{
+			name: "assign", thread: true,
+			description: "Assign a thread to a Matrix user. Usage: `!assign <@user:server or mention>`",
+		},
+		{
+			name: "unassign", thread: true,
+			description: "Remove the assignee of a thread.",
+		},
+		{
+			name: "tag", thread: true,
+			description: "Add labels to a thread. Usage: `!tag <label> [more labels]`",
+		},
+		{
+			name: "untag", thread: true,
+			description: "Remove labels from a thread. Usage: `!untag <label> [more labels]`",
+		},
+		{
+			name: "note", thread: true,
+			description: "Store an internal note in a thread that will never be sent via mail. Usage: `!note <text>`",
+		},
 		{
 			name: "move", thread: true,
 			description: "Move a thread into another room. Usage: `!move <room name substring>`",
 		},
 		{
-			name: "reply", triggerOnEdit: true, thread: true,
+			name: "merge", thread: true,
+			description: "Merge another thread into this one. Usage: `!merge <link to the other thread>`",
+		},
+		{
+			name: "split", thread: true,
+			description: "Move a mail into a new thread. " +
+				"Usage: Reply to a mail with `!split` or with `!split all` to also move all later mails.",
+		},
+		{
+			name: "reply", triggerOnEdit: true, thread: true, sendsMail: true,
 			description: "Reply to an email by replying to it on Matrix. " +
 				"Usage: Reply to a message with `!reply <response text>`. " +
-				"Editing and adding the `!reply` prefix afterwards is allowed.",
+				"Editing and adding the `!reply` prefix afterwards is allowed. " +
+				"Use `!reply --attach <response text>` to attach all files uploaded to the thread since the last mail " +
+				"or reply to an uploaded file to attach it. " +
+				"If a send delay is configured, the reply can still be edited or cancelled by deleting the command until it is sent.",
 		},
 		{
-			name: "send", triggerOnEdit: true, thread: true,
+			name: "send", triggerOnEdit: true, thread: true, sendsMail: true,
 			description: "Same as `!reply` but won't cite the original message.",
 		},
+		{
+			name: "replyall", triggerOnEdit: true, thread: true, sendsMail: true,
+			description: "Same as `!reply` but also addresses all other recipients of the original message.",
+		},
+		{
+			name: "replyat", triggerOnEdit: true, thread: true, sendsMail: true,
+			description: "Same as `!reply` but sends the mail later. " +
+				"Usage: `!replyat <time like 9:00, 3h, tomorrow 8:30, friday 14:00 or 2026-11-01 9:00> <response text>`. " +
+				"Cancel by deleting the command or reacting with ❌.",
+		},
+		{
+			name: "sendat", triggerOnEdit: true, thread: true, sendsMail: true,
+			description: "Same as `!replyat` but won't cite the original message.",
+		},
+		{
+			name: "forward", aliases: []string{"fwd"}, triggerOnEdit: true, thread: true, sendsMail: true,
+			description: "Forward an email to another address. " +
+				"Usage: Reply to a message with `!forward <address> [comment]`.",
+		},
+		{
+			name: "seen", thread: true,
+			description: "List who has read the thread based on Matrix read receipts.",
+		},
+		{
+			name: "search",
+			description: "Search the mails of this room (or of the rooms listed in this overview) and list the matching threads. " +
+				"Usage: `!search <words or \"phrase\"> [from:<sender>] [room:<room name substring>] " +
+				"[before:<date>] [after:<date>]`",
+		},
 		{
 			name: "resendoverview", admin: true,
 			description: "Recreate overview message in this room.",
@@ -83,12 +207,27 @@ var (
 			name: "resendoverviewall", admin: true,
 			description: "Recreate all overview messages.",
 		},
+		{
+			name: "status", admin: true,
+			description: "Show the state of the processing pipeline, mail fetchers and LLM.",
+		},
 	}
 	// correctly handles cited commands
 	commandRegex          *regexp.Regexp = regexp.MustCompile(`(?s)^\s*!\s*([a-zA-Z]+)\s*(.*)\s*$`)
 	argsRegex             *regexp.Regexp = regexp.MustCompile(`\S+`)
-	CommandStateReactions []string       = []string{"👀", "⏳", "✅", "❌"}
+	userIdRegex           *regexp.Regexp = regexp.MustCompile(`@[a-zA-Z0-9._=/+-]+:[a-zA-Z0-9.-]+(:[0-9]+)?`)
+	durationRegex         *regexp.Regexp = regexp.MustCompile(`^([0-9]+[mhdw])+$`)
+	durationPartRegex     *regexp.Regexp = regexp.MustCompile(`([0-9]+)([mhdw])`)
+	snoozeDateLayouts     []string       = []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02T15:04"}
+	clockRegex            *regexp.Regexp = regexp.MustCompile(`^([01]?[0-9]|2[0-3])[:.]([0-5][0-9])$`)
+	CommandStateReactions []string       = []string{"👀", "⏳", "✅", "❌", "🔏", "🕓"}
 	roomMutexes           map[string]*sync.Mutex
+	// commands whose reply may still be pending in the outbox
+	outboxCommands []string = []string{"reply", "send", "replyall", "replyat", "sendat"}
+	// commands run when a thread reaction is removed
+	undoCommands map[string]string = map[string]string{
+		"open": "close", "close": "open", "forceclose": "open", "claim": "unassign",
+	}
 )
 
 type Command struct {
@@ -106,6 +245,9 @@ type Command struct {
 	lastReactionId string
 	prevState      CommandState
 	edited         bool
+	delayed        bool   // the reply is sent after the grace period
+	reactionTo     string // thread root in case the command has been triggered by a reaction
+	powerLevel     *int   // power level of the sender, requested when needed
 	content        *event.MessageEventContent
 
 	client  *MatrixClient
@@ -113,6 +255,13 @@ type Command struct {
 }
 
 func (c *Command) cleanupState() {
+	if c.reactionTo != "" { // only reflect the state of the latest reaction
+		c.originalId, c.threadId = c.reactionTo, c.reactionTo
+		for id := range c.client.GetOwnReactions(c.roomId, c.originalId) {
+			c.client.RedactMessage(c.roomId, id)
+		}
+		return
+	}
 	c.originalId, c.threadId, c.replyToId = c.client.GetMessageThreadAndReply(c.roomId, c.messageId, c.event)
 	for id, reaction := range c.client.GetOwnReactions(c.roomId, c.originalId) {
 		if reaction != CommandStateReactions[Done] {
@@ -174,10 +323,46 @@ func (c *Command) reportStateMessageFormatted(message string, messageHtml string
 	}
 }
 
+// whether a user may run a command based on the configured users or their power level;
+// `powerLevel` is only called if the power level matters
+func MayRun(cfg *config.MatrixConfig, command string, roomId string, user string, powerLevel func() int) bool {
+	cmd := findCommand(command)
+	if cmd == nil {
+		return false
+	}
+	var required int
+	switch {
+	case cmd.admin:
+		if cfg.IsAdmin(user) {
+			return true
+		}
+		required = cfg.AdminPowerLevel
+	case cmd.sendsMail:
+		if cfg.IsAllowedSender(roomId, user) {
+			return true
+		}
+		required = cfg.SendPowerLevel
+	}
+	return required <= 0 || powerLevel() >= required
+}
+
+func (c *Command) permitted(cmd *CommandConfig) bool {
+	return MayRun(c.client.Config, cmd.name, c.roomId, c.event.Sender.String(), func() int {
+		if c.powerLevel == nil {
+			level := c.client.GetPowerLevel(c.roomId, c.event.Sender.String())
+			c.powerLevel = &level
+		}
+		return *c.powerLevel
+	})
+}
+
 func (c *Command) helpCommand() {
 	builder := NewTextHtmlBuilder()
 	builder.WriteLine(formatBold("Command Overview"))
 	for _, cmd := range commands {
+		if !c.permitted(&cmd) {
+			continue
+		}
 		for i, handle := range append([]string{cmd.name}, cmd.aliases...) {
 			handle = fmt.Sprintf("!%s", handle)
 			builder.Write(formatCode(handle))
@@ -187,8 +372,312 @@ func (c *Command) helpCommand() {
 		}
 		builder.WriteLine(convertMdCode(fmt.Sprintf(": %s", cmd.description)))
 	}
+	if reactions := c.client.Config.ThreadReactions; len(reactions) > 0 {
+		builder.NewLine()
+		builder.WriteLine(formatBold("Thread Reactions"))
+		for _, emoji := range slices.Sorted(maps.Keys(reactions)) {
+			builder.WriteLine(convertMdCode(fmt.Sprintf("%s: Same as `!%s`", emoji, reactions[emoji])))
+		}
+		builder.Write(formatItalic("React to the first message of a thread to run these commands, remove the reaction to undo them."))
+	}
+	text, html := builder.String()
+	c.reportStateMessageFormatted(text, html, false)
+}
+
+// find the matrix user id in a command argument
+func ParseUserId(arg string) string {
+	return userIdRegex.FindString(arg)
+}
+
+// find the event id in a matrix.to message link like `https://matrix.to/#/!room:example.com/$event?via=example.com`
+func ParseMessageLink(arg string) (string, bool) {
+	_, link, found := strings.Cut(arg, "matrix.to/#/")
+	if !found {
+		return "", false
+	}
+	link, _, _ = strings.Cut(argsRegex.FindString(link), "?")
+	parts := strings.Split(link, "/")
+	if len(parts) < 2 {
+		return "", false
+	}
+	eventId, err := url.PathUnescape(parts[1])
+	if err != nil || len(eventId) < 2 || !strings.HasPrefix(eventId, "$") {
+		return "", false
+	}
+	return eventId, true
+}
+
+func splitFirstArg(arg string) (first string, rest string) {
+	arg = strings.TrimSpace(arg)
+	if i := strings.IndexFunc(arg, unicode.IsSpace); i != -1 {
+		return arg[:i], strings.TrimSpace(arg[i:])
+	}
+	return arg, ""
+}
+
+func parseClock(arg string) (time.Duration, bool) {
+	parsed := clockRegex.FindStringSubmatch(arg)
+	if parsed == nil {
+		return 0, false
+	}
+	hours, _ := strconv.Atoi(parsed[1])
+	minutes, _ := strconv.Atoi(parsed[2])
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, true
+}
+
+// parse the point in time a scheduled reply should be sent at relative to `now` and return the remaining text
+// (e.g. `9:00`, `3h`, `tomorrow 8:30`, `friday 14:00` or `2026-11-01 9:00`)
+func ParseScheduleArgs(arg string, now time.Time) (sendAt time.Time, text string, ok bool) {
+	first, text := splitFirstArg(arg)
+	first = strings.ToLower(first)
+	if durationRegex.MatchString(first) {
+		sendAt, ok = ParseSnoozeTime(first, now)
+		return sendAt, text, ok && text != ""
+	}
+	year, month, date := now.Date()
+	today := time.Date(year, month, date, 0, 0, 0, 0, now.Location())
+	if clock, isClock := parseClock(first); isClock { // next occurrence of the time
+		sendAt = today.Add(clock)
+		if !sendAt.After(now) {
+			sendAt = sendAt.AddDate(0, 0, 1)
+		}
+		return sendAt, text, text != ""
+	}
+
+	var day time.Time
+	switch first {
+	case "today":
+		day = today
+	case "tomorrow":
+		day = today.AddDate(0, 0, 1)
+	default:
+		if parsed, err := time.ParseInLocation("2006-01-02", first, now.Location()); err == nil {
+			day = parsed
+		}
+		for days := 1; days <= 7 && day.IsZero(); days++ {
+			weekday := strings.ToLower(today.AddDate(0, 0, days).Weekday().String())
+			if first == weekday || first == weekday[:3] {
+				day = today.AddDate(0, 0, days)
+			}
+		}
+	}
+	second, text := splitFirstArg(text)
+	clock, isClock := parseClock(second)
+	if day.IsZero() || !isClock {
+		return time.Time{}, "", false
+	}
+	sendAt = day.Add(clock)
+	return sendAt, text, sendAt.After(now) && text != ""
+}
+
+// strip the `--attach` flag from a reply
+func ParseAttachFlag(arg string) (text string, attach bool) {
+	text = strings.TrimSpace(arg)
+	if rest, found := strings.CutPrefix(text, "--attach"); found && (rest == "" || unicode.IsSpace([]rune(rest)[0])) {
+		return strings.TrimSpace(rest), true
+	}
+	return text, false
+}
+
+// split the `!forward` argument into the recipient address and an optional comment
+func ParseForwardArgs(arg string) (addr string, comment string, ok bool) {
+	recipient := strings.TrimSpace(arg)
+	if i := strings.IndexFunc(recipient, unicode.IsSpace); i != -1 {
+		recipient, comment = recipient[:i], recipient[i:]
+	}
+	parsed, err := mail.ParseAddress(recipient)
+	if err != nil {
+		return "", "", false
+	}
+	return parsed.Address, strings.TrimSpace(comment), true
+}
+
+// files to attach to a reply: the replied-to file and with `attach` all files uploaded since the last mail
+func (c *Command) replyFiles(ctx context.Context, attach bool) []string {
+	files := []string{}
+	if attach {
+		mailIds := c.actions.GetThreadMailIds(ctx, c.roomId, c.threadId)
+		files = c.client.GetThreadFiles(c.roomId, c.threadId, c.originalId, mailIds)
+	}
+	if c.replyToId != "" && !slices.Contains(files, c.replyToId) && c.client.IsFileMessage(c.roomId, c.replyToId) {
+		files = append(files, c.replyToId)
+	}
+	return files
+}
+
+// determine the user mentioned by the command either textually or as a pill
+func (c *Command) mentionedUser() string {
+	if userId := ParseUserId(c.Arg); userId != "" {
+		return userId
+	}
+	if c.content.Mentions != nil {
+		for _, userId := range c.content.Mentions.UserIDs {
+			if userId.String() != c.client.Config.Username {
+				return userId.String()
+			}
+		}
+	}
+	return ""
+}
+
+// split the `!search` argument into search terms and filters; dates are interpreted in `zone`
+func ParseSearchQuery(arg string, zone *time.Location) (query SearchQuery, ok bool) {
+	terms := []string{}
+	for _, token := range argsRegex.FindAllString(arg, -1) {
+		key, value, found := strings.Cut(token, ":")
+		if !found || value == "" {
+			terms = append(terms, token)
+			continue
+		}
+		var err error
+		switch strings.ToLower(key) {
+		case "from":
+			query.From = value
+		case "room":
+			query.Room = value
+		case "before":
+			query.Before, err = time.ParseInLocation("2006-01-02", value, zone)
+		case "after":
+			query.After, err = time.ParseInLocation("2006-01-02", value, zone)
+		default:
+			terms = append(terms, token)
+		}
+		if err != nil {
+			return SearchQuery{}, false
+		}
+	}
+	query.Text = strings.Join(terms, " ")
+	ok = query.Text != "" || query.From != "" || query.Room != "" || !query.Before.IsZero() || !query.After.IsZero()
+	return
+}
+
+// normalize labels given as command arguments
+func ParseLabels(args []string) []string {
+	labels := make([]string, 0, len(args))
+	for _, arg := range args {
+		label := strings.ToLower(strings.Trim(arg, "#,"))
+		if label != "" {
+			labels = append(labels, label)
+		}
+	}
+	slices.Sort(labels)
+	return slices.Compact(labels)
+}
+
+// parse the time a snoozed thread should be reopened at relative to `now`
+// (e.g. `3d`, `1d12h`, `2026-11-01`, `2026-11-01 14:00`, `friday` or `fri`)
+func ParseSnoozeTime(arg string, now time.Time) (until time.Time, ok bool) {
+	arg = strings.ToLower(strings.TrimSpace(arg))
+	if durationRegex.MatchString(arg) {
+		until = now
+		for _, part := range durationPartRegex.FindAllStringSubmatch(arg, -1) {
+			n, err := strconv.Atoi(part[1])
+			if err != nil {
+				return time.Time{}, false
+			}
+			switch part[2] {
+			case "m":
+				until = until.Add(time.Duration(n) * time.Minute)
+			case "h":
+				until = until.Add(time.Duration(n) * time.Hour)
+			case "d":
+				until = until.AddDate(0, 0, n)
+			case "w":
+				until = until.AddDate(0, 0, 7*n)
+			}
+		}
+		return until, until.After(now)
+	}
+	for _, layout := range snoozeDateLayouts {
+		// the layouts are uppercase (`T` separator) while arg has been lowercased
+		if parsed, err := time.ParseInLocation(layout, strings.ToUpper(arg), now.Location()); err == nil {
+			return parsed, parsed.After(now)
+		}
+	}
+	for days := 1; days <= 7; days++ {
+		day := now.AddDate(0, 0, days)
+		weekday := strings.ToLower(day.Weekday().String())
+		if arg == weekday || arg == weekday[:3] {
+			year, month, date := day.Date()
+			return time.Date(year, month, date, 0, 0, 0, 0, now.Location()), true
+		}
+	}
+	return
+}
+
+func (c *Command) seenCommand(ctx context.Context) bool {
+	readers, err := c.actions.GetThreadReaders(ctx, c.roomId, c.threadId)
+	if err != nil {
+		c.reportStateMessage(err.Error(), true)
+		return false
+	}
+	if len(readers) == 0 {
+		c.reportStateMessage("nobody has read this thread yet", false)
+		return true
+	}
+
+	builder := NewTextHtmlBuilder()
+	builder.Write(formatBold("Seen by"))
+	for _, reader := range readers {
+		seen := formatTime(reader.Seen, c.client.Config.Timezone)
+		if seen == "" {
+			seen = "just now"
+		}
+		textLine, htmlLine := formatAttribute(reader.User, seen)
+		if !reader.SeenLatest {
+			textNote, htmlNote := formatItalic("(before the latest mail)")
+			textLine, htmlLine = fmt.Sprintf("%s %s", textLine, textNote), fmt.Sprintf("%s %s", htmlLine, htmlNote)
+		}
+		builder.NewLine()
+		builder.Write(textLine, htmlLine)
+	}
+	text, html := builder.String()
+	c.reportStateMessageFormatted(text, html, false)
+	return true
+}
+
+func (c *Command) searchCommand(ctx context.Context) bool {
+	zone, _ := time.LoadLocation(c.client.Config.Timezone) // timezone has already been validated
+	query, ok := ParseSearchQuery(c.Arg, zone)
+	if !ok {
+		text, html := convertMdCode("Please specify search terms or filters like `!search invoice from:alice before:2026-01-31`.")
+		c.reportStateMessageFormatted(text, html, true)
+		return false
+	}
+	results, err := c.actions.SearchThreads(ctx, c.roomId, query)
+	if err != nil {
+		c.reportStateMessage(err.Error(), true)
+		return false
+	}
+	if len(results) == 0 {
+		c.reportStateMessage("no matching threads found", false)
+		return true
+	}
+
+	builder := NewTextHtmlBuilder()
+	builder.WriteLine(formatBold("Search Results"))
+	for i, result := range results {
+		link := formatMessageLink(result.RoomId, result.ThreadId, c.client.Config.HomeServer)
+		state := "closed"
+		if result.Open {
+			state = "open"
+		}
+		textTitle, htmlTitle := formatAttribute(result.Author, result.Subject)
+		textState, htmlState := formatItalic(fmt.Sprintf("(%s, %s)", state, formatTime(result.Timestamp, c.client.Config.Timezone)))
+		builder.WriteLine(
+			fmt.Sprintf("%s %s - %s", textTitle, textState, link),
+			fmt.Sprintf("%s %s - %s", htmlTitle, htmlState, link),
+		)
+		textSnippet, htmlSnippet := formatSnippet(result.Snippet)
+		builder.Write(textSnippet, wrapHtmlItalic(htmlSnippet))
+		if i < len(results)-1 {
+			builder.NewLine()
+			builder.NewLine()
+		}
+	}
 	text, html := builder.String()
 	c.reportStateMessageFormatted(text, html, false)
+	return true
 }
 
 func (c *Command) Run(ctx context.Context) {
@@ -208,6 +697,15 @@ func (c *Command) Run(ctx context.Context) {
 		text, html := convertMdCode(fmt.Sprintf("The command `!%s` is expected to be used in a thread.", c.Name))
 		c.reportStateMessageFormatted(text, html, true)
 	}
+	if ok && !c.permitted(c.Config) {
+		ok = false
+		log.Warnf("Denied command %v of %v", c.Name, c.event.Sender)
+		text, html := convertMdCode(fmt.Sprintf(
+			"You are not allowed to use `!%s` in this room. Ask an admin to raise your power level or to add you to the configuration.",
+			c.Name,
+		))
+		c.reportStateMessageFormatted(text, html, true)
+	}
 
 	if ok {
 		switch c.Name {
@@ -219,33 +717,170 @@ func (c *Command) Run(ctx context.Context) {
 			ok = c.actions.CloseThread(ctx, c.roomId, c.threadId)
 		case "forceclose":
 			ok = c.actions.ForceCloseThread(ctx, c.roomId, c.threadId)
+		case "snooze":
+			zone, _ := time.LoadLocation(c.client.Config.Timezone) // timezone has already been validated
+			if until, valid := ParseSnoozeTime(c.Arg, time.Now().In(zone)); valid {
+				ok = c.actions.SnoozeThread(ctx, c.roomId, c.threadId, until)
+				if ok {
+					c.reportStateMessage(fmt.Sprintf("snoozed until %s", until.Format("Mon 2 Jan 2006 15:04")), false)
+				}
+			} else {
+				ok = false
+				text, html := convertMdCode(
+					"Please specify a future point in time like `!snooze 3d`, `!snooze 2026-11-01` or `!snooze friday`.",
+				)
+				c.reportStateMessageFormatted(text, html, true)
+			}
+		case "claim":
+			ok = c.actions.AssignThread(ctx, c.roomId, c.threadId, c.event.Sender.String())
+		case "assign":
+			if assignee := c.mentionedUser(); assignee != "" {
+				ok = c.actions.AssignThread(ctx, c.roomId, c.threadId, assignee)
+			} else {
+				ok = false
+				text, html := convertMdCode("Please specify a user like `!assign @user:matrix.org`.")
+				c.reportStateMessageFormatted(text, html, true)
+			}
+		case "unassign":
+			ok = c.actions.UnassignThread(ctx, c.roomId, c.threadId)
+		case "tag", "untag":
+			labels := ParseLabels(c.Args)
+			if len(labels) == 0 {
+				ok = false
+				text, html := convertMdCode(fmt.Sprintf("Please specify at least one label like `!%s finance`.", c.Name))
+				c.reportStateMessageFormatted(text, html, true)
+			} else if c.Name == "tag" {
+				ok = c.actions.TagThread(ctx, c.roomId, c.threadId, labels)
+			} else {
+				ok = c.actions.UntagThread(ctx, c.roomId, c.threadId, labels)
+			}
+		case "note":
+			if text := strings.TrimSpace(c.Arg); text != "" {
+				ok = c.actions.AddNote(ctx, c.roomId, c.threadId, c.event.Sender.String(), text)
+			} else {
+				ok = false
+				text, html := convertMdCode("Please specify the note like `!note called them, waiting for the invoice`.")
+				c.reportStateMessageFormatted(text, html, true)
+			}
 		case "move":
 			c.reportState(Pending)
 			ok = c.actions.MoveThread(ctx, c.roomId, c.threadId, c.Arg)
+		case "merge":
+			if otherThreadId, valid := ParseMessageLink(c.Arg); valid {
+				c.reportState(Pending)
+				ok = c.actions.MergeThread(ctx, c.roomId, c.threadId, otherThreadId)
+			} else {
+				ok = false
+				text, html := convertMdCode(
+					"Please specify the thread to merge using its link like `!merge https://matrix.to/#/!room:example.com/$event`.",
+				)
+				c.reportStateMessageFormatted(text, html, true)
+			}
+		case "split":
+			if c.Arg != "" && c.Arg != "all" {
+				ok = false
+				text, html := convertMdCode("Please use either `!split` or `!split all`.")
+				c.reportStateMessageFormatted(text, html, true)
+				break
+			}
+			c.reportState(Pending)
+			err := c.actions.SplitThread(ctx, c.roomId, c.threadId, c.replyToId, c.Arg == "all")
+			ok = err == nil
+			if !ok {
+				c.reportStateMessage(err.Error(), true)
+			}
+		case "seen":
+			ok = c.seenCommand(ctx)
+		case "search":
+			c.reportState(Pending)
+			ok = c.searchCommand(ctx)
 		case "resendoverview":
 			c.reportState(Pending)
 			ok = c.actions.ResendThreadOverview(ctx, c.roomId)
 		case "resendoverviewall":
 			c.reportState(Pending)
 			ok = c.actions.ResendThreadOverviewAll(ctx)
-		case "reply", "send":
+		case "status":
+			c.reportState(Pending)
+			text, html := formatStatus(c.actions.GetStatus(ctx))
+			c.reportStateMessageFormatted(text, html, false)
+		case "reply", "send", "replyall":
+			c.reportState(Pending)
+			cite := c.Name != "send"
+			replyAll := c.Name == "replyall"
+			text, attach := ParseAttachFlag(c.Arg)
+			state, err := c.actions.ReplyToMailInThread(
+				ctx, c.roomId, c.threadId, c.originalId, c.replyToId, c.event.Sender.String(), text, cite, replyAll,
+				c.replyFiles(ctx, attach),
+			)
+			ok = err == nil
+			if !ok {
+				log.Errorf("Error handling command %s: %v", c.Name, err)
+				c.reportStateMessage(err.Error(), true)
+			} else if state == AwaitingApproval {
+				c.reportState(AwaitingApproval)
+			} else {
+				c.delayed = state == Pending
+			}
+		case "replyat", "sendat":
+			zone, _ := time.LoadLocation(c.client.Config.Timezone) // timezone has already been validated
+			sendAt, text, valid := ParseScheduleArgs(c.Arg, time.Now().In(zone))
+			if !valid {
+				ok = false
+				text, html := convertMdCode(fmt.Sprintf(
+					"Please specify a future point in time and your reply like `!%s 9:00 <text>` or `!%s tomorrow 8:30 <text>`.",
+					c.Name, c.Name,
+				))
+				c.reportStateMessageFormatted(text, html, true)
+				break
+			}
+			c.reportState(Pending)
+			text, attach := ParseAttachFlag(text)
+			awaitingApproval, err := c.actions.ScheduleReply(
+				ctx, c.roomId, c.threadId, c.originalId, c.replyToId, c.event.Sender.String(), text,
+				c.Name == "replyat", false, c.replyFiles(ctx, attach), sendAt,
+			)
+			ok = err == nil
+			if !ok {
+				log.Errorf("Error handling command %s: %v", c.Name, err)
+				c.reportStateMessage(err.Error(), true)
+			} else if awaitingApproval {
+				c.reportState(AwaitingApproval)
+			} else {
+				c.reportState(Scheduled)
+				c.reportStateMessage(fmt.Sprintf(
+					"the reply will be sent %s. Delete your message or react with %s to cancel it",
+					sendAt.Format("Mon 2 Jan 2006 15:04"), CommandStateReactions[Error],
+				), false)
+			}
+		case "forward":
+			addr, comment, valid := ParseForwardArgs(c.Arg)
+			if !valid {
+				ok = false
+				text, html := convertMdCode("Please specify a recipient like `!forward mail@example.com [comment]`.")
+				c.reportStateMessageFormatted(text, html, true)
+				break
+			}
 			c.reportState(Pending)
-			cite := c.Name == "reply"
-			err := c.actions.ReplyToMailInThread(ctx, c.roomId, c.originalId, c.replyToId, c.Arg, cite)
+			awaitingApproval, err := c.actions.ForwardMail(
+				ctx, c.roomId, c.threadId, c.originalId, c.replyToId, c.event.Sender.String(), addr, comment,
+			)
 			ok = err == nil
 			if !ok {
 				log.Errorf("Error handling command %s: %v", c.Name, err)
 				c.reportStateMessage(err.Error(), true)
+			} else if awaitingApproval {
+				c.reportState(AwaitingApproval)
 			}
 		default:
 			ok = false
 		}
 	}
 
-	if ok {
-		c.reportState(Done)
-	} else {
+	if !ok {
 		c.reportState(Error)
+	} else if c.state != AwaitingApproval && c.state != Scheduled && !c.delayed {
+		c.reportState(Done)
 	}
 	log.Infof("Done handling command %v", c.Name)
 }
@@ -272,9 +907,33 @@ func NewCommand(config *CommandConfig, arg string, args []string, edited bool,
 	}
 }
 
+func NewReactionCommand(config *CommandConfig, threadId string,
+	evt *event.Event, client *MatrixClient, actions Actions,
+) *Command {
+	return &Command{
+		Name:       config.name,
+		Config:     config,
+		Args:       []string{},
+		state:      Default,
+		event:      evt,
+		roomId:     evt.RoomID.String(),
+		messageId:  evt.ID.String(),
+		reactionTo: threadId,
+		content:    &event.MessageEventContent{},
+		client:     client,
+		actions:    actions,
+	}
+}
+
+type threadReaction struct {
+	threadId string
+	command  string
+}
+
 type CommandHandler struct {
-	Actions Actions
-	client  *MatrixClient
+	Actions   Actions
+	client    *MatrixClient
+	reactions sync.Map // reaction id -> *threadReaction; reactions from before a restart can't be undone
 }
 
 func NewCommandHandler(
@@ -288,6 +947,117 @@ func NewCommandHandler(
 	return &CommandHandler{Actions: actions, client: client}
 }
 
+func (ch *CommandHandler) ProcessReaction(ctx context.Context, evt *event.Event) {
+	relation := evt.Content.AsReaction().RelatesTo
+	roomId := evt.RoomID.String()
+	lock, ok := roomMutexes[roomId]
+	if !ok {
+		return
+	}
+	switch relation.Key {
+	case ch.client.Config.ApprovalReaction:
+		go func() {
+			sender := evt.Sender.String()
+			if !MayRun(ch.client.Config, "reply", roomId, sender, func() int {
+				return ch.client.GetPowerLevel(roomId, sender)
+			}) {
+				log.Warnf("Ignoring approval of %v who isn't allowed to send mails", sender)
+				return
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			ch.Actions.ApproveReply(ctx, roomId, relation.EventID.String(), sender)
+		}()
+	case CommandStateReactions[Error]:
+		go func() {
+			lock.Lock()
+			defer lock.Unlock()
+			sender := evt.Sender.String()
+			ch.Actions.CancelScheduledReply(
+				ctx, roomId, relation.EventID.String(), sender, ch.mayCancelOthers(roomId, sender), false,
+			)
+		}()
+	default:
+		if command, ok := ch.client.Config.ThreadReactions[relation.Key]; ok {
+			go func() {
+				threadId := relation.EventID.String()
+				if !ch.Actions.IsThreadRoot(ctx, roomId, threadId) { // e.g. overview pages, digests or replies
+					return
+				}
+				ch.reactions.Store(evt.ID.String(), &threadReaction{threadId: threadId, command: command})
+				ch.runReactionCommand(ctx, command, threadId, evt)
+			}()
+		}
+	}
+}
+
+// get the command reverting a thread reaction command
+func UndoCommand(command string) string {
+	return undoCommands[command]
+}
+
+func (ch *CommandHandler) runReactionCommand(ctx context.Context, command string, threadId string, evt *event.Event) {
+	if cfg := findCommand(command); cfg != nil {
+		NewReactionCommand(cfg, threadId, evt, ch.client, ch.Actions).Run(ctx)
+	}
+}
+
+// get the config of a command by its name or alias
+func findCommand(name string) *CommandConfig {
+	for i, cfg := range commands {
+		if cfg.name == name || slices.Contains(cfg.aliases, name) {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+func (ch *CommandHandler) ProcessRedaction(ctx context.Context, evt *event.Event) {
+	redacted := evt.Redacts
+	if redacted == "" {
+		redacted = evt.Content.AsRedaction().Redacts
+	}
+	roomId := evt.RoomID.String()
+	if value, ok := ch.reactions.LoadAndDelete(redacted.String()); ok { // undo a thread reaction
+		reaction := value.(*threadReaction)
+		go ch.runReactionCommand(ctx, UndoCommand(reaction.command), reaction.threadId, evt)
+		return
+	}
+	if lock, ok := roomMutexes[roomId]; ok && redacted != "" {
+		go func() {
+			lock.Lock()
+			defer lock.Unlock()
+			sender := evt.Sender.String()
+			ch.Actions.CancelScheduledReply(ctx, roomId, redacted.String(), sender, ch.mayCancelOthers(roomId, sender), true)
+		}()
+	}
+}
+
+// whether `user` may cancel the replies of other members, evaluated lazily to only fetch power levels if needed
+func (ch *CommandHandler) mayCancelOthers(roomId string, user string) func() bool {
+	return func() bool {
+		return MayRun(ch.client.Config, "reply", roomId, user, func() int {
+			return ch.client.GetPowerLevel(roomId, user)
+		})
+	}
+}
+
+// cancel the delayed or scheduled reply of a command whose message has been edited
+func (ch *CommandHandler) cancelEditedReply(ctx context.Context, evt *event.Event) {
+	originalId := evt.Content.AsMessage().RelatesTo.GetReplaceID()
+	roomId := evt.RoomID.String()
+	if lock, ok := roomMutexes[roomId]; ok && originalId != "" {
+		go func() {
+			lock.Lock()
+			defer lock.Unlock()
+			sender := evt.Sender.String()
+			ch.Actions.CancelScheduledReply(
+				ctx, roomId, originalId.String(), sender, ch.mayCancelOthers(roomId, sender), false,
+			)
+		}()
+	}
+}
+
 func ParseCommand(message string) (command string, arg string, args []string) {
 	nonCitedLines := slices.DeleteFunc(strings.Split(message, "\n"), func(line string) bool {
 		return strings.HasPrefix(strings.TrimSpace(line), ">")
@@ -313,17 +1083,15 @@ func (ch *CommandHandler) ProcessMessage(ctx context.Context, evt *event.Event)
 		message = evt.Content.AsMessage().Body
 	}
 	cmd, arg, args := ParseCommand(message)
+	if edited && !slices.Contains(outboxCommands, cmd) { // edited into something else than a pending reply
+		ch.cancelEditedReply(ctx, evt)
+	}
 	if cmd == "" {
 		return
 	}
 
 	// run command if available
-	for _, cfg := range commands {
-		if cfg.name == cmd || slices.Contains(cfg.aliases, cmd) {
-			if !edited || cfg.triggerOnEdit {
-				go NewCommand(&cfg, arg, args, edited, evt, ch.client, ch.Actions).Run(ctx)
-			}
-			break
-		}
+	if cfg := findCommand(cmd); cfg != nil && (!edited || cfg.triggerOnEdit) {
+		go NewCommand(cfg, arg, args, edited, evt, ch.client, ch.Actions).Run(ctx)
 	}
 }
@@ -2,8 +2,11 @@ package matrix_test
 
 import (
 	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/arne314/inbox-collab/internal/config"
 	"github.com/arne314/inbox-collab/internal/matrix"
 )
 
@@ -143,3 +146,676 @@ func TestFormatStateMessage(t *testing.T) {
 		})
 	}
 }
+
+func TestParseUserId(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  string
+		want string
+	}{
+		{
+			"empty",
+			"",
+			"",
+		},
+		{
+			"simple",
+			"@user:matrix.org",
+			"@user:matrix.org",
+		},
+		{
+			"port",
+			"@user.name:example.com:8448",
+			"@user.name:example.com:8448",
+		},
+		{
+			"surrounded",
+			"please @some_user:example.com thanks",
+			"@some_user:example.com",
+		},
+		{
+			"link",
+			"https://matrix.to/#/@user:example.com",
+			"@user:example.com",
+		},
+		{
+			"display_name",
+			"Some User",
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := matrix.ParseUserId(tt.arg)
+			if got != tt.want {
+				t.Errorf("ParseUserId() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMessageLink(t *testing.T) {
+	tests := []struct {
+		name   string
+		arg    string
+		want   string
+		wantOk bool
+	}{
+		{
+			"empty",
+			"",
+			"",
+			false,
+		},
+		{
+			"simple",
+			"https://matrix.to/#/!room:example.com/$event123?via=example.com",
+			"$event123",
+			true,
+		},
+		{
+			"escaped",
+			"https://matrix.to/#/%21room%3Aexample.com/%24event123%3Aexample.com",
+			"$event123:example.com",
+			true,
+		},
+		{
+			"surrounded",
+			"please merge https://matrix.to/#/!room:example.com/$event123 thanks",
+			"$event123",
+			true,
+		},
+		{
+			"room_only",
+			"https://matrix.to/#/!room:example.com?via=example.com",
+			"",
+			false,
+		},
+		{
+			"user",
+			"https://matrix.to/#/@user:example.com",
+			"",
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := matrix.ParseMessageLink(tt.arg)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("ParseMessageLink() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestParseForwardArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		arg         string
+		wantAddr    string
+		wantComment string
+		wantOk      bool
+	}{
+		{
+			"empty",
+			"",
+			"",
+			"",
+			false,
+		},
+		{
+			"address",
+			"venue@example.com",
+			"venue@example.com",
+			"",
+			true,
+		},
+		{
+			"comment",
+			"accounting@example.com  please have a look\nthanks",
+			"accounting@example.com",
+			"please have a look\nthanks",
+			true,
+		},
+		{
+			"newline",
+			"accounting@example.com\nfyi",
+			"accounting@example.com",
+			"fyi",
+			true,
+		},
+		{
+			"angles",
+			"<venue@example.com> fyi",
+			"venue@example.com",
+			"fyi",
+			true,
+		},
+		{
+			"invalid",
+			"please forward this",
+			"",
+			"",
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, comment, ok := matrix.ParseForwardArgs(tt.arg)
+			if addr != tt.wantAddr || comment != tt.wantComment || ok != tt.wantOk {
+				t.Errorf("ParseForwardArgs() = %v, %v, %v, want %v, %v, %v",
+					addr, comment, ok, tt.wantAddr, tt.wantComment, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestParseAttachFlag(t *testing.T) {
+	tests := []struct {
+		name       string
+		arg        string
+		wantText   string
+		wantAttach bool
+	}{
+		{
+			"plain",
+			"Thanks for your mail",
+			"Thanks for your mail",
+			false,
+		},
+		{
+			"attach",
+			"--attach  Please find the invoice attached",
+			"Please find the invoice attached",
+			true,
+		},
+		{
+			"attach_only",
+			"--attach",
+			"",
+			true,
+		},
+		{
+			"newline",
+			"--attach\nSee attachments",
+			"See attachments",
+			true,
+		},
+		{
+			"other_flag",
+			"--attachment is missing",
+			"--attachment is missing",
+			false,
+		},
+		{
+			"within_text",
+			"I can't use --attach here",
+			"I can't use --attach here",
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, attach := matrix.ParseAttachFlag(tt.arg)
+			if text != tt.wantText || attach != tt.wantAttach {
+				t.Errorf("ParseAttachFlag() = %v, %v, want %v, %v", text, attach, tt.wantText, tt.wantAttach)
+			}
+		})
+	}
+}
+
+func TestParseSnoozeTime(t *testing.T) {
+	now := time.Date(2026, time.October, 14, 18, 30, 0, 0, time.UTC) // wednesday
+	tests := []struct {
+		name   string
+		arg    string
+		want   time.Time
+		wantOk bool
+	}{
+		{
+			"empty",
+			"",
+			time.Time{},
+			false,
+		},
+		{
+			"days",
+			"3d",
+			time.Date(2026, time.October, 17, 18, 30, 0, 0, time.UTC),
+			true,
+		},
+		{
+			"combined",
+			"1w1d12h30m",
+			time.Date(2026, time.October, 23, 7, 0, 0, 0, time.UTC),
+			true,
+		},
+		{
+			"zero",
+			"0h",
+			time.Time{},
+			false,
+		},
+		{
+			"date",
+			"2026-11-01",
+			time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC),
+			true,
+		},
+		{
+			"date_time",
+			"2026-11-01 14:00",
+			time.Date(2026, time.November, 1, 14, 0, 0, 0, time.UTC),
+			true,
+		},
+		{
+			"iso_date_time",
+			"2026-11-01T14:00",
+			time.Date(2026, time.November, 1, 14, 0, 0, 0, time.UTC),
+			true,
+		},
+		{
+			"iso_date_time_lowercase",
+			"2026-11-01t08:15",
+			time.Date(2026, time.November, 1, 8, 15, 0, 0, time.UTC),
+			true,
+		},
+		{
+			"past_date",
+			"2026-10-01",
+			time.Time{},
+			false,
+		},
+		{
+			"weekday",
+			"Friday",
+			time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC),
+			true,
+		},
+		{
+			"same_weekday",
+			"wed",
+			time.Date(2026, time.October, 21, 0, 0, 0, 0, time.UTC),
+			true,
+		},
+		{
+			"invalid",
+			"soon",
+			time.Time{},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotOk := matrix.ParseSnoozeTime(tt.arg, now)
+			if gotOk != tt.wantOk {
+				t.Errorf("ok ParseSnoozeTime() = %v, want %v", gotOk, tt.wantOk)
+			}
+			if gotOk && !got.Equal(tt.want) {
+				t.Errorf("time ParseSnoozeTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{
+			"empty",
+			[]string{},
+			[]string{},
+		},
+		{
+			"lower",
+			[]string{"Finance"},
+			[]string{"finance"},
+		},
+		{
+			"hashtag",
+			[]string{"#events", "#"},
+			[]string{"events"},
+		},
+		{
+			"duplicates",
+			[]string{"b,", "a", "B"},
+			[]string{"a", "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := matrix.ParseLabels(tt.args)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParseLabels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		arg    string
+		want   matrix.SearchQuery
+		wantOk bool
+	}{
+		{
+			"empty",
+			"",
+			matrix.SearchQuery{},
+			false,
+		},
+		{
+			"text",
+			"annual  meeting",
+			matrix.SearchQuery{Text: "annual meeting"},
+			true,
+		},
+		{
+			"phrase",
+			"\"annual meeting\" -cancelled",
+			matrix.SearchQuery{Text: "\"annual meeting\" -cancelled"},
+			true,
+		},
+		{
+			"filters",
+			"invoice from:alice@example.com room:board before:2026-01-31 after:2025-12-01",
+			matrix.SearchQuery{
+				Text:   "invoice",
+				From:   "alice@example.com",
+				Room:   "board",
+				Before: time.Date(2026, time.January, 31, 0, 0, 0, 0, time.UTC),
+				After:  time.Date(2025, time.December, 1, 0, 0, 0, 0, time.UTC),
+			},
+			true,
+		},
+		{
+			"filter_only",
+			"From:bob",
+			matrix.SearchQuery{From: "bob"},
+			true,
+		},
+		{
+			"unknown_filter",
+			"time:12:00",
+			matrix.SearchQuery{Text: "time:12:00"},
+			true,
+		},
+		{
+			"invalid_date",
+			"invoice before:yesterday",
+			matrix.SearchQuery{},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotOk := matrix.ParseSearchQuery(tt.arg, time.UTC)
+			if gotOk != tt.wantOk {
+				t.Errorf("ok ParseSearchQuery() = %v, want %v", gotOk, tt.wantOk)
+			}
+			if gotOk && got != tt.want {
+				t.Errorf("ParseSearchQuery() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScheduleArgs(t *testing.T) {
+	now := time.Date(2026, time.October, 14, 18, 30, 0, 0, time.UTC) // wednesday
+	tests := []struct {
+		name     string
+		arg      string
+		wantTime time.Time
+		wantText string
+		wantOk   bool
+	}{
+		{
+			"empty",
+			"",
+			time.Time{},
+			"",
+			false,
+		},
+		{
+			"no_text",
+			"9:00",
+			time.Date(2026, time.October, 15, 9, 0, 0, 0, time.UTC),
+			"",
+			false,
+		},
+		{
+			"clock_tomorrow",
+			"9:00 Good morning!",
+			time.Date(2026, time.October, 15, 9, 0, 0, 0, time.UTC),
+			"Good morning!",
+			true,
+		},
+		{
+			"clock_today",
+			"20.15 See you\ntonight",
+			time.Date(2026, time.October, 14, 20, 15, 0, 0, time.UTC),
+			"See you\ntonight",
+			true,
+		},
+		{
+			"duration",
+			"1h30m Thanks",
+			time.Date(2026, time.October, 14, 20, 0, 0, 0, time.UTC),
+			"Thanks",
+			true,
+		},
+		{
+			"tomorrow",
+			"Tomorrow 8:30 Thanks",
+			time.Date(2026, time.October, 15, 8, 30, 0, 0, time.UTC),
+			"Thanks",
+			true,
+		},
+		{
+			"weekday",
+			"fri 14:00 Thanks",
+			time.Date(2026, time.October, 16, 14, 0, 0, 0, time.UTC),
+			"Thanks",
+			true,
+		},
+		{
+			"date",
+			"2026-11-01 09:00 Thanks",
+			time.Date(2026, time.November, 1, 9, 0, 0, 0, time.UTC),
+			"Thanks",
+			true,
+		},
+		{
+			"date_without_time",
+			"2026-11-01 Thanks",
+			time.Time{},
+			"",
+			false,
+		},
+		{
+			"past",
+			"today 9:00 Thanks",
+			time.Date(2026, time.October, 14, 9, 0, 0, 0, time.UTC),
+			"Thanks",
+			false,
+		},
+		{
+			"invalid",
+			"Thanks for the mail",
+			time.Time{},
+			"",
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, text, ok := matrix.ParseScheduleArgs(tt.arg, now)
+			if ok != tt.wantOk || (ok && (!got.Equal(tt.wantTime) || text != tt.wantText)) {
+				t.Errorf("ParseScheduleArgs() = %v, %q, %v, want %v, %q, %v",
+					got, text, ok, tt.wantTime, tt.wantText, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestMayRun(t *testing.T) {
+	cfg := &config.MatrixConfig{Admins: []string{"@admin:example.com"}, AdminPowerLevel: 50, SendPowerLevel: 10}
+	tests := []struct {
+		name          string
+		command       string
+		user          string
+		powerLevel    int
+		want          bool
+		wantRequested bool
+	}{
+		{"regular", "close", "@user:example.com", 0, true, false},
+		{"admin_low_level", "status", "@user:example.com", 0, false, true},
+		{"admin_high_level", "status", "@user:example.com", 50, true, true},
+		{"admin_listed", "resendoverviewall", "@admin:example.com", 0, true, false},
+		{"send_low_level", "reply", "@user:example.com", 5, false, true},
+		{"send_high_level", "forward", "@user:example.com", 10, true, true},
+		{"unknown", "unknown", "@admin:example.com", 100, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requested := false
+			got := matrix.MayRun(cfg, tt.command, "!room:example.com", tt.user, func() int {
+				requested = true
+				return tt.powerLevel
+			})
+			if got != tt.want || requested != tt.wantRequested {
+				t.Errorf("MayRun() = %v (requested %v), want %v (requested %v)", got, requested, tt.want, tt.wantRequested)
+			}
+		})
+	}
+}
+
+func TestUndoCommand(t *testing.T) {
+	cfg := &config.MatrixConfig{}
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"open", "close"},
+		{"close", "open"},
+		{"forceclose", "open"},
+		{"claim", "unassign"},
+		{"reply", ""},
+		{"unknown", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			got := matrix.UndoCommand(tt.command)
+			if got != tt.want {
+				t.Errorf("UndoCommand() = %v, want %v", got, tt.want)
+			}
+			// undoing must be possible for everyone who could react in the first place
+			if got != "" && !matrix.MayRun(cfg, got, "!room:example.com", "@user:example.com", func() int { return 0 }) {
+				t.Errorf("UndoCommand() = %v, which is not a regular command", got)
+			}
+		})
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			"plain",
+			"Thanks",
+			"Thanks",
+		},
+		{
+			"formatting",
+			"**Thanks**\nfor the [invite](https://example.com)",
+			"<strong>Thanks</strong><br>\nfor the <a href=\"https://example.com\">invite</a>",
+		},
+		{
+			"list",
+			"- one\n- two",
+			"<ul>\n<li>one</li>\n<li>two</li>\n</ul>",
+		},
+		{
+			"escape",
+			"<b>no html</b>",
+			"&lt;b&gt;no html&lt;/b&gt;",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := strings.TrimSpace(matrix.RenderMarkdown(tt.text))
+			if got != tt.want {
+				t.Errorf("RenderMarkdown() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderOverviewPages(t *testing.T) {
+	entry := func(room, roomName, subject string) *matrix.OverviewEntry {
+		return &matrix.OverviewEntry{
+			RoomId: room, RoomName: roomName, ThreadId: "$thread", Author: "Alice", Subject: subject,
+			LastAuthor: "Bob", FirstTimestamp: time.Now().Add(-50 * time.Hour), LastTimestamp: time.Now().Add(-2 * time.Hour),
+			MailCount: 2,
+		}
+	}
+	many := make([]*matrix.OverviewEntry, 30)
+	for i := range many {
+		many[i] = entry("!a:example.com", "Support", "Question")
+	}
+	tests := []struct {
+		name      string
+		entries   []*matrix.OverviewEntry
+		pageSize  int
+		wantPages int
+		wantRooms []string // room headings in order of the first page
+	}{
+		{"empty", []*matrix.OverviewEntry{}, 10000, 1, []string{}},
+		{
+			"grouped",
+			[]*matrix.OverviewEntry{
+				entry("!b:example.com", "sales", "Offer"),
+				entry("!a:example.com", "Support", "Help"),
+				entry("!b:example.com", "sales", "Order"),
+			},
+			10000, 1, []string{"<h3>sales (2)</h3>", "<h3>Support (1)</h3>"},
+		},
+		{"paginated", many, 2000, 5, []string{"<h3>Support (30)</h3>"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pages := matrix.RenderOverviewPages(tt.entries, "https://matrix.example.com", "UTC", tt.pageSize)
+			if len(pages) != tt.wantPages {
+				t.Fatalf("RenderOverviewPages() returned %v pages, want %v", len(pages), tt.wantPages)
+			}
+			rows := 0
+			for _, page := range pages {
+				if len(page.Html()) > tt.pageSize {
+					t.Errorf("RenderOverviewPages() page length %v exceeds %v", len(page.Html()), tt.pageSize)
+				}
+				if strings.Count(page.Html(), "<table>") != strings.Count(page.Html(), "</table>") {
+					t.Errorf("RenderOverviewPages() page with unclosed table: %q", page.Html())
+				}
+				rows += strings.Count(page.Html(), "<tr><td>")
+			}
+			if rows != len(tt.entries) {
+				t.Errorf("RenderOverviewPages() rendered %v rows, want %v", rows, len(tt.entries))
+			}
+			last := -1
+			for _, room := range tt.wantRooms {
+				index := strings.Index(pages[0].Html(), room)
+				if index <= last {
+					t.Errorf("RenderOverviewPages() heading %q missing or out of order", room)
+				}
+				last = index
+			}
+		})
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"regexp"
 	"strings"
 	"time"
+
+	"maunium.net/go/mautrix/format"
 )
 
 const (
@@ -94,6 +96,11 @@ func formatCode(message string) (string, string) {
 	return message, wrapHtmlCode(message)
 }
 
+func formatQuote(message string) (string, string) {
+	return "> " + strings.ReplaceAll(message, textNewline, textNewline+"> "),
+		wrapHtmlTag(formatHtml(message), "blockquote")
+}
+
 var mdCodeRegex *regexp.Regexp = regexp.MustCompile("`([^`]+)`")
 
 // replace `code` with html code tags
@@ -106,6 +113,35 @@ func formatHtml(text string) string {
 	return strings.ReplaceAll(html.EscapeString(text), textNewline, htmlNewline)
 }
 
+// render markdown written on matrix into html, raw html is escaped
+func RenderMarkdown(text string) string {
+	rendered := format.RenderMarkdown(text, true, false)
+	if rendered.FormattedBody == "" {
+		return formatHtml(text)
+	}
+	return rendered.FormattedBody
+}
+
+var snippetHighlightRegex *regexp.Regexp = regexp.MustCompile(`\*\*(.+?)\*\*`)
+
+// convert a search snippet with **highlighted** words into a single line
+func formatSnippet(snippet string) (string, string) {
+	snippet = strings.Join(strings.Fields(snippet), " ")
+	return snippetHighlightRegex.ReplaceAllString(snippet, "$1"),
+		snippetHighlightRegex.ReplaceAllString(html.EscapeString(snippet), wrapHtmlStrong("$1"))
+}
+
+// preview an internal note in a single line
+func formatNoteSnippet(author, body string) (string, string) {
+	const maxLength = 120
+	body = strings.Join(strings.Fields(body), " ")
+	if runes := []rune(body); len(runes) > maxLength {
+		body = string(runes[:maxLength]) + "…"
+	}
+	text := fmt.Sprintf("📝 %s: %s", author, body)
+	return text, wrapHtmlItalic(html.EscapeString(text))
+}
+
 func formatTime(timestamp time.Time, timezone string) string {
 	var formatTime string
 	zone, _ := time.LoadLocation(timezone) // timezone has already been validated
@@ -123,6 +159,12 @@ func formatTime(timestamp time.Time, timezone string) string {
 	return formatTime
 }
 
+// absolute time that stays correct in messages which aren't updated regularly
+func formatDate(timestamp time.Time, timezone string) string {
+	zone, _ := time.LoadLocation(timezone) // timezone has already been validated
+	return timestamp.In(zone).Format("2 Jan 15:04")
+}
+
 func formatMessageLink(roomId, messageId, homeServer string) string {
 	parsedUrl, err := url.Parse(homeServer)
 	if err == nil {
@@ -134,6 +176,25 @@ func formatMessageLink(roomId, messageId, homeServer string) string {
 	)
 }
 
+func formatMention(userId string) (string, string) {
+	return userId, fmt.Sprintf(`<a href="https://matrix.to/#/%s">%s</a>`, userId, html.EscapeString(userId))
+}
+
+// format a duration in whole days and hours like `2d 3h`
+func formatDuration(d time.Duration) string {
+	hours := int(d.Hours())
+	if hours < 1 {
+		return "<1h"
+	}
+	if hours < 24 {
+		return fmt.Sprintf("%dh", hours)
+	}
+	if hours%24 == 0 {
+		return fmt.Sprintf("%dd", hours/24)
+	}
+	return fmt.Sprintf("%dd %dh", hours/24, hours%24)
+}
+
 func truncateString(s string) string {
 	runes := []rune(s)
 	return string(runes[:len(runes)-max(1, len(runes)/10)])
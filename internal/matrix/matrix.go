@@ -3,7 +3,10 @@ package matrix
 import (
 	"context"
 	"fmt"
+	"html"
+	"math"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -18,6 +21,8 @@ type MatrixHandler struct {
 	client *MatrixClient
 	ctx    context.Context
 	Config *config.MatrixConfig
+
+	overviewPages sync.Map // last content of each overview message to skip unchanged edits
 }
 
 func (mh *MatrixHandler) Setup(actions Actions, wg *sync.WaitGroup) {
@@ -99,8 +104,9 @@ func (mh *MatrixHandler) CreateThread(
 }
 
 func (mh *MatrixHandler) AddReply(
-	roomId string, threadId string, author string, authorAddr string, subject string,
-	timestamp time.Time, attachments []string, conversation model.ExtractedMessages, isFirst bool,
+	roomId string, threadId string, author string, replyAddr string, subject string,
+	timestamp time.Time, attachments []string, conversation model.ExtractedMessages,
+	bodyHtml string, isFirst bool,
 ) (ok bool, redacted bool, matrixId string) {
 	builder := NewTextHtmlBuilder()
 	hasHead := false
@@ -120,13 +126,17 @@ func (mh *MatrixHandler) AddReply(
 		hasHead = true
 	}
 	if mh.Config.GetRoomSender(roomId) != "" {
-		builder.WriteLine(formatAttribute("Reply To", authorAddr))
+		builder.WriteLine(formatAttribute("Reply To", replyAddr))
 		hasHead = true
 	}
 	if hasHead {
 		builder.NewLine()
 	}
 
+	send := func(text, html string) (ok bool, eventId string, err error) {
+		ok, redacted, eventId, err = mh.client.SendThreadMessage(roomId, threadId, text, html, false)
+		return
+	}
 	if conversation.Forwarded { // post entire history
 		for i, message := range conversation.Messages {
 			builder.WriteLine(formatBold(fmt.Sprintf("%s %s", message.Author, formatTime(*message.Timestamp, mh.Config.Timezone))))
@@ -141,64 +151,300 @@ func (mh *MatrixHandler) AddReply(
 		}
 	} else {
 		content := *conversation.Messages[0].Content
+		if bodyHtml != "" && content != "" { // html of the extracted message
+			var err error
+			ok, matrixId, err = send(builder.Text()+content, builder.Html()+bodyHtml)
+			if err == nil || !strings.Contains(err.Error(), "M_TOO_LARGE") {
+				return
+			}
+			// formatted html can't be truncated by lines
+		}
 		if content != "" {
 			builder.Write(content, formatHtml(content))
 		} else {
 			builder.Write(formatItalic("Empty message"))
 		}
 	}
+	ok, matrixId, _ = truncateLarge(builder.Text(), builder.Html(), send, truncateLines)
+	return
+}
+
+func (mh *MatrixHandler) AddNote(
+	roomId string, threadId string, author string, timestamp time.Time, body string,
+) (ok bool, matrixId string) {
+	builder := NewTextHtmlBuilder()
+	title := fmt.Sprintf("📝 Internal note by %s", author)
+	if time := formatTime(timestamp, mh.Config.Timezone); time != "" {
+		title = fmt.Sprintf("%s %s", title, time)
+	}
+	builder.WriteLine(formatBold(title))
+	builder.Write(formatQuote(body))
 	ok, matrixId, _ = truncateLarge(builder.Text(), builder.Html(), func(text, html string) (ok bool, eventId string, err error) {
-		ok, redacted, eventId, err = mh.client.SendThreadMessage(roomId, threadId, text, html, false)
+		ok, _, eventId, err = mh.client.SendThreadMessage(roomId, threadId, text, html, true)
 		return
 	}, truncateLines)
 	return
 }
 
-func (mh *MatrixHandler) UpdateThreadOverview(
-	overviewRoomId string, overviewMessageId string, authors []string,
-	subjects []string, rooms []string, threadMsgs []string,
+// post an attachment of the mail message `mailId` into its thread
+func (mh *MatrixHandler) AddAttachment(
+	roomId string, threadId string, mailId string, fileName string, contentType string, content []byte,
 ) (ok bool, matrixId string) {
-	builder := NewTextHtmlBuilder()
-	builder.WriteLine("Overview", "<h2>Overview</h2>")
-	nAuthors := len(authors)
+	return mh.client.SendThreadFile(roomId, threadId, mailId, fileName, contentType, content)
+}
 
-	for i := range nAuthors {
-		link := formatMessageLink(rooms[i], threadMsgs[i], mh.Config.HomeServer)
-		textTitle, htmlTitle := formatAttribute(authors[i], subjects[i])
-		textLine := fmt.Sprintf("%s - %s", textTitle, link)
-		htmlLine := fmt.Sprintf("%s - %s", htmlTitle, link)
+// post an already uploaded attachment again, e.g. once its mail has been moved into another thread
+func (mh *MatrixHandler) RepostAttachment(
+	roomId string, threadId string, mailId string, fileName string, contentType string, fileRoomId string, fileId string,
+) (ok bool, matrixId string) {
+	file, err := mh.client.DownloadFile(fileRoomId, fileId)
+	if err != nil {
+		log.Errorf("Error downloading attachment %v to repost it: %v", fileName, err)
+		return
+	}
+	return mh.client.SendThreadFile(roomId, threadId, mailId, fileName, contentType, file.Content)
+}
 
-		if builder.MaxLen()+len(htmlLine) > 10000 {
-			warning := fmt.Sprintf("%v additional threads are not listed here.", len(authors)-i)
-			builder.NewLine()
-			builder.NewLine()
-			builder.Write(warning, warning)
-			break
-		}
-		builder.Write(textLine, htmlLine)
-		if i < nAuthors-1 {
-			builder.NewLine()
+func (mh *MatrixHandler) DownloadFiles(roomId string, messageIds []string) ([]*File, error) {
+	files := make([]*File, len(messageIds))
+	for i, messageId := range messageIds {
+		file, err := mh.client.DownloadFile(roomId, messageId)
+		if err != nil {
+			log.Errorf("Error downloading file %v: %v", messageId, err)
+			return nil, err
 		}
+		files[i] = file
 	}
+	return files, nil
+}
+
+type OverviewEntry struct {
+	RoomId         string
+	RoomName       string
+	ThreadId       string // message to link to
+	Author         string
+	Subject        string
+	LastAuthor     string
+	FirstTimestamp time.Time
+	LastTimestamp  time.Time
+	MailCount      int
+	Assignee       string
+	Labels         []string
+	Readers        []string // users who have seen the latest mail
+	Answered       bool     // the last mail has been sent by us
+	Overdue        bool     // response target missed
+}
 
-	textMessage, htmlMessage := builder.String()
-	if overviewMessageId == "" {
-		ok, matrixId, _ = truncateLarge(textMessage, htmlMessage, func(text, html string) (bool, string, error) {
+// update the overview pages in place, additional pages are sent and obsolete ones removed
+func (mh *MatrixHandler) UpdateThreadOverview(
+	overviewRoomId string, messageIds []string, entries []*OverviewEntry,
+) (ok bool, newIds []string) {
+	pages := RenderOverviewPages(entries, mh.Config.HomeServer, mh.Config.Timezone, overviewPageSize)
+	newIds = make([]string, 0, len(pages))
+	for i, page := range pages {
+		send := func(text, html string) (bool, string, error) {
 			return mh.client.SendRoomMessage(overviewRoomId, text, html)
-		}, truncateLines)
-		return
-	} else {
-		ok, matrixId, _ = truncateLarge(textMessage, htmlMessage, func(text, html string) (bool, string, error) {
-			return mh.client.EditRoomMessage(overviewRoomId, overviewMessageId, text, html)
-		}, truncateLines)
-		return
+		}
+		if i < len(messageIds) && messageIds[i] != "" {
+			if previous, ok := mh.overviewPages.Load(messageIds[i]); ok && previous == page.Html() {
+				newIds = append(newIds, messageIds[i])
+				continue
+			}
+			send = func(text, html string) (bool, string, error) {
+				return mh.client.EditRoomMessage(overviewRoomId, messageIds[i], text, html)
+			}
+		}
+		ok, messageId, _ := truncateLarge(page.Text(), page.Html(), send, truncateLines)
+		if !ok { // keep tracking the remaining old pages
+			return false, append(newIds, messageIds[min(len(newIds), len(messageIds)):]...)
+		}
+		mh.overviewPages.Store(messageId, page.Html())
+		newIds = append(newIds, messageId)
+	}
+	for _, messageId := range messageIds[min(len(pages), len(messageIds)):] {
+		mh.overviewPages.Delete(messageId)
+		mh.client.RedactMessage(overviewRoomId, messageId)
+	}
+	return true, newIds
+}
+
+const overviewPageSize = 10000 // max html length of a single overview message
+
+const (
+	overviewTableStart = "<table><thead><tr><th>Thread</th><th>From</th><th>Opened</th><th>Last mail</th>" +
+		"<th>Mails</th><th>Seen by</th><th>Status</th></tr></thead><tbody>"
+	overviewTableEnd = "</tbody></table>"
+)
+
+func formatOverviewStatus(entry *OverviewEntry) (string, string) {
+	texts, htmls := []string{"awaiting reply"}, []string{"awaiting reply"}
+	if entry.Answered {
+		texts, htmls = []string{"answered"}, []string{"answered"}
+	}
+	if entry.Overdue { // response target missed
+		texts, htmls = append(texts, "⏰ overdue"), append(htmls, "⏰ overdue")
 	}
+	if entry.Assignee != "" {
+		texts = append(texts, fmt.Sprintf("(%s)", entry.Assignee))
+		htmls = append(htmls, wrapHtmlItalic(html.EscapeString(entry.Assignee)))
+	}
+	for _, label := range entry.Labels {
+		texts = append(texts, fmt.Sprintf("[%s]", label))
+		htmls = append(htmls, wrapHtmlCode(html.EscapeString(label)))
+	}
+	return strings.Join(texts, " "), strings.Join(htmls, " ")
+}
+
+// format a single thread as a line of text and a table row
+func formatOverviewRow(entry *OverviewEntry, homeServer string, timezone string) (string, string) {
+	link := formatMessageLink(entry.RoomId, entry.ThreadId, homeServer)
+	opened := formatDate(entry.FirstTimestamp, timezone)
+	lastMail := formatDate(entry.LastTimestamp, timezone)
+	if entry.LastAuthor != "" && entry.MailCount > 1 {
+		lastMail = fmt.Sprintf("%s by %s", lastMail, entry.LastAuthor)
+	}
+	textReaders, htmlReaders := formatItalic("unread by anyone")
+	if len(entry.Readers) > 0 {
+		textReaders = fmt.Sprintf("seen by %s", strings.Join(entry.Readers, ", "))
+		htmlReaders = html.EscapeString(strings.Join(entry.Readers, ", "))
+	}
+	textStatus, htmlStatus := formatOverviewStatus(entry)
+	textRow := fmt.Sprintf("%s: %s - %s | opened %s | last mail %s | %d mails | %s | %s",
+		entry.Author, entry.Subject, link, opened, lastMail, entry.MailCount, textReaders, textStatus,
+	)
+	htmlRow := fmt.Sprintf(
+		`<tr><td><a href="%s">%s</a></td><td>%s</td><td>%s</td><td>%s</td><td>%d</td><td>%s</td><td>%s</td></tr>`,
+		link, html.EscapeString(entry.Subject), html.EscapeString(entry.Author), opened,
+		html.EscapeString(lastMail), entry.MailCount, htmlReaders, htmlStatus,
+	)
+	return textRow + textNewline, htmlRow
+}
+
+// render the overview as tables grouped by room, split into pages of at most `pageSize` html characters
+func RenderOverviewPages(entries []*OverviewEntry, homeServer string, timezone string, pageSize int,
+) []*TextHtmlBuilder {
+	pages := []*TextHtmlBuilder{}
+	var page *TextHtmlBuilder
+	newPage := func() {
+		page = NewTextHtmlBuilder()
+		title := "Overview"
+		if len(pages) > 0 {
+			title = fmt.Sprintf("Overview (page %d)", len(pages)+1)
+		}
+		page.Write(title+textNewline, wrapHtmlTag(title, "h2"))
+		pages = append(pages, page)
+	}
+	newPage()
+	if len(entries) == 0 {
+		page.Write("No open threads.", "No open threads.")
+		return pages
+	}
+
+	// group by room while keeping the order within rooms
+	rooms := []string{}
+	groups := make(map[string][]*OverviewEntry)
+	for _, entry := range entries {
+		if _, ok := groups[entry.RoomId]; !ok {
+			rooms = append(rooms, entry.RoomId)
+		}
+		groups[entry.RoomId] = append(groups[entry.RoomId], entry)
+	}
+	slices.SortStableFunc(rooms, func(a, b string) int {
+		return strings.Compare(strings.ToLower(groups[a][0].RoomName), strings.ToLower(groups[b][0].RoomName))
+	})
+
+	rows := 0 // rows on the current page
+	for _, room := range rooms {
+		group := groups[room]
+		heading := fmt.Sprintf("%s (%d)", group[0].RoomName, len(group))
+		headingText := textNewline + heading + textNewline
+		headingHtml := wrapHtmlTag(html.EscapeString(heading), "h3") + overviewTableStart
+		for i, entry := range group {
+			textRow, htmlRow := formatOverviewRow(entry, homeServer, timezone)
+			if rows > 0 && page.MaxLen()+len(headingHtml)+len(htmlRow)+len(overviewTableEnd) > pageSize {
+				if i > 0 {
+					page.Write("", overviewTableEnd)
+				}
+				newPage()
+				rows = 0
+			}
+			if i == 0 || rows == 0 { // repeat the heading on continued pages
+				page.Write(headingText, headingHtml)
+			}
+			page.Write(textRow, htmlRow)
+			rows++
+		}
+		page.Write("", overviewTableEnd)
+	}
+	return pages
+}
+
+func (mh *MatrixHandler) RemoveThreadOverview(overviewRoomId string, messageIds []string) bool {
+	ok := true
+	for _, messageId := range messageIds {
+		mh.overviewPages.Delete(messageId)
+		ok = mh.client.RedactMessage(overviewRoomId, messageId) && ok
+	}
+	return ok
+}
+
+type DigestThread struct {
+	RoomId    string
+	ThreadId  string
+	Author    string
+	Subject   string
+	Timestamp time.Time // relevant point in time of the section
+
+	NoteAuthor string // of the latest internal note if there is one
+	Note       string
 }
 
-func (mh *MatrixHandler) RemoveThreadOverview(
-	overviewRoomId, overviewMessageId string,
-) bool {
-	return mh.client.RedactMessage(overviewRoomId, overviewMessageId)
+type DigestSection struct {
+	Name    string // one of config.DigestSections
+	Threads []*DigestThread
+	Total   int
+}
+
+var digestSectionTitles = map[string]string{
+	"new":        "🆕 New threads",
+	"closed":     "✅ Closed threads",
+	"unanswered": "✉️ Unanswered threads",
+	"oldest":     "🕰️ Oldest open threads",
+}
+
+// post the digest as a new message to notify the members of the overview room
+func (mh *MatrixHandler) PostDigest(overviewRoomId string, since time.Time, sections []*DigestSection) bool {
+	builder := NewTextHtmlBuilder()
+	zone, _ := time.LoadLocation(mh.Config.Timezone) // timezone has already been validated
+	title := fmt.Sprintf("Digest since %s", since.In(zone).Format("Mon 2 Jan 15:04"))
+	builder.Write(title, wrapHtmlTag(title, "h2"))
+	for _, section := range sections {
+		builder.NewLine()
+		builder.NewLine()
+		builder.Write(formatBold(fmt.Sprintf("%s (%d)", digestSectionTitles[section.Name], section.Total)))
+		for _, thread := range section.Threads {
+			link := formatMessageLink(thread.RoomId, thread.ThreadId, mh.Config.HomeServer)
+			textTitle, htmlTitle := formatAttribute(thread.Author, thread.Subject)
+			textTime, htmlTime := formatItalic(fmt.Sprintf("(%s)", formatDate(thread.Timestamp, mh.Config.Timezone)))
+			builder.NewLine()
+			builder.Write(
+				fmt.Sprintf("%s - %s %s", textTitle, link, textTime),
+				fmt.Sprintf("%s - %s %s", htmlTitle, link, htmlTime),
+			)
+			if thread.Note != "" {
+				builder.NewLine()
+				builder.Write(formatNoteSnippet(thread.NoteAuthor, thread.Note))
+			}
+		}
+		if more := section.Total - len(section.Threads); more > 0 {
+			builder.NewLine()
+			builder.Write(formatItalic(fmt.Sprintf("and %d more", more)))
+		}
+	}
+	ok, _, _ := truncateLarge(builder.Text(), builder.Html(), func(text, html string) (bool, string, error) {
+		return mh.client.SendRoomMessage(overviewRoomId, text, html)
+	}, truncateLines)
+	return ok
 }
 
 func (mh *MatrixHandler) linkOtherThread(roomId, threadId, linkRoomId, linkMessageId, noteTitle, note string) bool {
@@ -220,6 +466,137 @@ func (mh *MatrixHandler) NotifyRecreation(roomId, threadId, linkRoomId, linkMess
 	return mh.linkOtherThread(roomId, threadId, linkRoomId, linkMessageId, noteTitle, note)
 }
 
+func (mh *MatrixHandler) NotifyMerge(roomId, threadId, linkRoomId, linkMessageId string) bool {
+	const noteTitle = "🔀 Merged"
+	const note = "This thread has been merged into"
+	return mh.linkOtherThread(roomId, threadId, linkRoomId, linkMessageId, noteTitle, note)
+}
+
+const splitNoteTitle = "✂️ Split"
+
+// link the new thread in the thread mails have been split off from
+func (mh *MatrixHandler) NotifySplitOff(roomId, threadId, newRoomId, newThreadId string) bool {
+	const note = "Mails of this thread have been split off into"
+	return mh.linkOtherThread(roomId, threadId, newRoomId, newThreadId, splitNoteTitle, note)
+}
+
+// link the original thread in the new thread
+func (mh *MatrixHandler) NotifySplitFrom(newRoomId, newThreadId, roomId, threadId string) bool {
+	const note = "This thread has been split off from"
+	return mh.linkOtherThread(newRoomId, newThreadId, roomId, threadId, splitNoteTitle, note)
+}
+
+// post or update the preview of a reply that awaits approval
+func (mh *MatrixHandler) PostReplyDraft(
+	roomId, threadId, previewId, author, text, forwardTo string, nFiles int, sendAt time.Time,
+) (ok bool, eventId string) {
+	builder := NewTextHtmlBuilder()
+	kind := "reply"
+	if forwardTo != "" {
+		kind = "forward"
+		builder.WriteLine(formatBold(fmt.Sprintf("✉️ Forward to %s drafted by %s", forwardTo, author)))
+	} else {
+		builder.WriteLine(formatBold(fmt.Sprintf("✉️ Reply draft by %s", author)))
+	}
+	builder.WriteLine(formatItalic(fmt.Sprintf(
+		"Another member has to react with %s to send this %s.", mh.Config.ApprovalReaction, kind,
+	)))
+	if !sendAt.IsZero() {
+		zone, _ := time.LoadLocation(mh.Config.Timezone) // timezone has already been validated
+		builder.WriteLine(formatAttribute("Scheduled", sendAt.In(zone).Format("Mon 2 Jan 2006 15:04")))
+	}
+	if nFiles > 0 {
+		builder.WriteLine(formatAttribute("Attachments", fmt.Sprintf("%d files", nFiles)))
+	}
+	builder.Write(formatQuote(text))
+	if previewId != "" && !mh.client.MessageRedacted(roomId, previewId) {
+		ok, _, _ = mh.client.EditRoomMessage(roomId, previewId, builder.Text(), builder.Html())
+		return ok, previewId
+	}
+	ok, _, eventId, _ = mh.client.SendThreadMessage(roomId, threadId, builder.Text(), builder.Html(), true)
+	return
+}
+
+// notify about the approval of a reply that has been sent or scheduled for `sendAt`
+func (mh *MatrixHandler) NotifyReplyApproval(roomId, threadId, approver string, sendAt time.Time, err error) bool {
+	builder := NewTextHtmlBuilder()
+	if err == nil && !sendAt.IsZero() {
+		zone, _ := time.LoadLocation(mh.Config.Timezone) // timezone has already been validated
+		builder.Write(formatAttribute("✅ Approved", fmt.Sprintf(
+			"The mail has been approved by %s and will be sent %s.", approver, sendAt.In(zone).Format("Mon 2 Jan 2006 15:04"),
+		)))
+	} else if err == nil {
+		builder.Write(formatAttribute("✅ Approved", fmt.Sprintf("The mail has been approved by %s and sent.", approver)))
+	} else {
+		builder.Write(formatAttribute("❌ Error", FormatStateMessage(err.Error())))
+	}
+	ok, _, _, _ := mh.client.SendThreadMessage(roomId, threadId, builder.Text(), builder.Html(), true)
+	return ok
+}
+
+// replace the state reaction of a command that has already finished running
+func (mh *MatrixHandler) SetCommandState(roomId, commandId string, state CommandState) {
+	for reactionId := range mh.client.GetOwnReactions(roomId, commandId) {
+		mh.client.RedactMessage(roomId, reactionId)
+	}
+	mh.client.ReactToMessage(roomId, commandId, CommandStateReactions[state])
+}
+
+// post or update the countdown of a reply that is sent after the grace period
+func (mh *MatrixHandler) PostSendCountdown(roomId, threadId, countdownId string, remaining time.Duration) (ok bool, eventId string) {
+	builder := NewTextHtmlBuilder()
+	builder.Write(formatAttribute("⏳ Sending", fmt.Sprintf(
+		"The reply will be sent in %d seconds. Edit your message to change it, delete it or react with %s to cancel.",
+		int(math.Ceil(remaining.Seconds())), CommandStateReactions[Error],
+	)))
+	if countdownId != "" {
+		ok, _, _ = mh.client.EditRoomMessage(roomId, countdownId, builder.Text(), builder.Html())
+		return ok, countdownId
+	}
+	ok, _, eventId, _ = mh.client.SendThreadMessage(roomId, threadId, builder.Text(), builder.Html(), true)
+	return
+}
+
+func (mh *MatrixHandler) RemoveMessage(roomId, messageId string) bool {
+	return mh.client.RedactMessage(roomId, messageId)
+}
+
+func (mh *MatrixHandler) NotifyScheduledReplyCancelled(roomId, threadId, canceller string) bool {
+	builder := NewTextHtmlBuilder()
+	builder.Write(formatAttribute("🚫 Cancelled", fmt.Sprintf("The pending reply has been cancelled by %s.", canceller)))
+	ok, _, _, _ := mh.client.SendThreadMessage(roomId, threadId, builder.Text(), builder.Html(), true)
+	return ok
+}
+
+func (mh *MatrixHandler) NotifyScheduledReplyFailed(roomId, threadId string, err error) bool {
+	builder := NewTextHtmlBuilder()
+	builder.Write(formatAttribute("❌ Error", FormatStateMessage(fmt.Sprintf("failed to send the scheduled reply: %v", err))))
+	ok, _, _, _ := mh.client.SendThreadMessage(roomId, threadId, builder.Text(), builder.Html(), true)
+	return ok
+}
+
+// remind a thread of its unanswered mail while mentioning the assignee if there is one
+func (mh *MatrixHandler) NotifyResponseOverdue(roomId, threadId, assignee string, waiting time.Duration) bool {
+	builder := NewTextHtmlBuilder()
+	message := fmt.Sprintf("The latest mail has been waiting for a reply for %s.", formatDuration(waiting))
+	builder.Write(formatAttribute("⏰ Reminder", message))
+	var mentions []string
+	if assignee != "" {
+		builder.Write(" ", " ")
+		builder.Write(formatMention(assignee))
+		mentions = append(mentions, assignee)
+	}
+	ok, _, _, _ := mh.client.SendThreadMessage(roomId, threadId, builder.Text(), builder.Html(), true, mentions...)
+	return ok
+}
+
+func (mh *MatrixHandler) NotifySnoozeEnded(roomId, threadId string) bool {
+	builder := NewTextHtmlBuilder()
+	builder.Write(formatAttribute("⏰ Snooze ended", "This thread has been reopened."))
+	ok, _, _, _ := mh.client.SendThreadMessage(roomId, threadId, builder.Text(), builder.Html(), true)
+	return ok
+}
+
 func (mh *MatrixHandler) Stop() {
 	mh.client.Stop()
 }
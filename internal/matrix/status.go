@@ -0,0 +1,106 @@
+package matrix
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type StageStatus struct {
+	Name        string
+	Working     bool
+	LastRun     time.Time
+	LastFailure time.Time
+	LastError   string
+	Retries     int
+}
+
+type FetcherStatus struct {
+	Name         string
+	Idle         bool
+	Reconnecting bool
+	UidLast      uint32
+	LastFetch    time.Time
+}
+
+type Status struct {
+	Stages               []StageStatus
+	Fetchers             []FetcherStatus
+	LLMPassthrough       bool
+	LLMConcurrentPrompts int
+	LLMError             error
+	PendingSorting       int
+	PendingExtraction    int
+	PendingMatrixThreads int
+	PendingMatrixMails   int
+}
+
+func formatAge(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return fmt.Sprintf("%s ago", time.Since(t).Round(time.Second))
+}
+
+func formatLastError(t time.Time, reason string) string {
+	if t.IsZero() {
+		return "no errors"
+	}
+	return fmt.Sprintf("last error %s (%s)", formatAge(t), reason)
+}
+
+func formatStatus(status *Status) (string, string) {
+	builder := NewTextHtmlBuilder()
+	writeItem := func(name string, values ...string) {
+		builder.WriteLine(formatAttribute(fmt.Sprintf("- %s", name), strings.Join(values, ", ")))
+	}
+	builder.WriteLine(formatBold("Status"))
+
+	builder.WriteLine(formatItalic("Pipeline stages"))
+	for _, stage := range status.Stages {
+		state := "idle"
+		if stage.Working {
+			state = "working"
+		}
+		writeItem(
+			stage.Name, state,
+			fmt.Sprintf("last run %s", formatAge(stage.LastRun)),
+			formatLastError(stage.LastFailure, stage.LastError),
+			fmt.Sprintf("%d retries", stage.Retries),
+		)
+	}
+
+	builder.WriteLine(formatItalic("Mail fetchers"))
+	for _, fetcher := range status.Fetchers {
+		state := "busy"
+		if fetcher.Reconnecting {
+			state = "reconnecting"
+		} else if fetcher.Idle {
+			state = "idle"
+		}
+		writeItem(
+			fetcher.Name, state,
+			fmt.Sprintf("last uid %d", fetcher.UidLast),
+			fmt.Sprintf("last fetch %s", formatAge(fetcher.LastFetch)),
+		)
+	}
+
+	builder.WriteLine(formatItalic("LLM"))
+	if status.LLMPassthrough {
+		writeItem("API", "passthrough")
+	} else if status.LLMError != nil {
+		writeItem("API", fmt.Sprintf("unreachable (%v)", status.LLMError))
+	} else {
+		writeItem("API", "reachable", fmt.Sprintf("%d concurrent prompts", status.LLMConcurrentPrompts))
+	}
+
+	builder.WriteLine(formatItalic("Pending"))
+	writeItem("Sorting", fmt.Sprintf("%d mails", status.PendingSorting))
+	writeItem("Message extraction", fmt.Sprintf("%d mails", status.PendingExtraction))
+	writeItem(
+		"Matrix",
+		fmt.Sprintf("%d threads", status.PendingMatrixThreads),
+		fmt.Sprintf("%d mails", status.PendingMatrixMails),
+	)
+	return builder.String()
+}
@@ -0,0 +1,113 @@
+package matrix
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_formatStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		status *Status
+		want   []string
+	}{
+		{
+			"empty",
+			&Status{},
+			[]string{
+				"Status",
+				"Pipeline stages",
+				"Mail fetchers",
+				"LLM",
+				"- API: reachable, 0 concurrent prompts",
+				"- Sorting: 0 mails",
+				"- Matrix: 0 threads, 0 mails",
+			},
+		},
+		{
+			"stages",
+			&Status{Stages: []StageStatus{
+				{Name: "Outbox"},
+				{
+					Name: "MatrixNotification", Working: true,
+					LastFailure: time.Now().Add(-time.Minute), LastError: "posting mail 4 failed", Retries: 2,
+				},
+			}},
+			[]string{
+				"- Outbox: idle, last run never, no errors, 0 retries",
+				"- MatrixNotification: working, last run never, last error 1m0s ago (posting mail 4 failed), 2 retries",
+			},
+		},
+		{
+			"fetchers",
+			&Status{Fetchers: []FetcherStatus{
+				{Name: "support", Idle: true, UidLast: 42},
+				{Name: "info", Idle: true, Reconnecting: true},
+				{Name: "sales"},
+			}},
+			[]string{
+				"- support: idle, last uid 42, last fetch never",
+				"- info: reconnecting, last uid 0, last fetch never",
+				"- sales: busy, last uid 0, last fetch never",
+			},
+		},
+		{
+			"llm",
+			&Status{LLMError: errors.New("connection refused"), PendingExtraction: 3},
+			[]string{
+				"- API: unreachable (connection refused)",
+				"- Message extraction: 3 mails",
+			},
+		},
+		{
+			"passthrough",
+			&Status{LLMPassthrough: true, PendingMatrixThreads: 1, PendingMatrixMails: 2},
+			[]string{
+				"- API: passthrough",
+				"- Matrix: 1 threads, 2 mails",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, html := formatStatus(tt.status)
+			lines := strings.Split(text, "\n")
+			for _, want := range tt.want {
+				found := false
+				for _, line := range lines {
+					found = found || line == want
+				}
+				if !found {
+					t.Errorf("formatStatus() = %q, missing line %q", text, want)
+				}
+			}
+			if !strings.Contains(html, "<strong>Status</strong>") {
+				t.Errorf("formatStatus() html = %q, missing heading", html)
+			}
+		})
+	}
+}
+
+func Test_formatDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		duration time.Duration
+		want     string
+	}{
+		{"zero", 0, "<1h"},
+		{"minutes", 59 * time.Minute, "<1h"},
+		{"hours", 5*time.Hour + 30*time.Minute, "5h"},
+		{"almost_day", 23 * time.Hour, "23h"},
+		{"days", 48 * time.Hour, "2d"},
+		{"days_hours", 51 * time.Hour, "2d 3h"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatDuration(tt.duration); got != tt.want {
+				t.Errorf("formatDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"regexp"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 
@@ -59,6 +60,11 @@ type LLMPython struct {
 	apiUrl string
 }
 
+type LLMStatus struct {
+	Passthrough       bool
+	ConcurrentPrompts int `json:"concurrent_prompts"`
+}
+
 type ParseMessagesRequest struct {
 	Author           string `json:"author"`
 	Conversation     string `json:"conversation"`
@@ -80,10 +86,10 @@ func (llm *LLMPassthroughTest) IsPlaceholder(msg string) bool {
 	return (&LLMPython{}).IsPlaceholder(msg)
 }
 
-func (llm *LLMPython) apiRequest(ctx context.Context, endpoint string, body []byte) ([]byte, error) {
+func (llm *LLMPython) apiRequest(ctx context.Context, method string, endpoint string, body []byte) ([]byte, error) {
 	req, err := http.NewRequestWithContext(
 		ctx,
-		http.MethodPost,
+		method,
 		llm.apiUrl+"/"+endpoint,
 		bytes.NewBuffer(body),
 	)
@@ -120,7 +126,7 @@ func (llm *LLMPython) ExtractMessages(ctx context.Context, mail *model.Mail) *db
 		log.Errorf("Error encoding json: %v", err)
 		return nil
 	}
-	response, err := llm.apiRequest(ctx, "parse_messages", encoded)
+	response, err := llm.apiRequest(ctx, http.MethodPost, "parse_messages", encoded)
 	if err != nil {
 		log.Errorf("Error requesting llm api: %v", err)
 		return nil
@@ -129,3 +135,23 @@ func (llm *LLMPython) ExtractMessages(ctx context.Context, mail *model.Mail) *db
 	json.Unmarshal(response, result)
 	return result
 }
+
+func (llm *LLMPython) Status(ctx context.Context) (*LLMStatus, error) {
+	response, err := llm.apiRequest(ctx, http.MethodGet, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	status := &LLMStatus{}
+	if err = json.Unmarshal(response, status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// check whether the configured llm api is reachable
+func GetLLMStatus(ctx context.Context, apiUrl string) (*LLMStatus, error) {
+	if strings.HasPrefix(apiUrl, "passthrough") {
+		return &LLMStatus{Passthrough: true}, nil
+	}
+	return (&LLMPython{apiUrl: apiUrl}).Status(ctx)
+}